@@ -0,0 +1,205 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// aiffReadFrames is the number of sample frames ReadSamples reads at a time
+const aiffReadFrames = 1 << 16
+
+// AIFFReader reads AIFF files: big-endian PCM described by a COMM chunk,
+// with the samples in an SSND chunk
+type AIFFReader struct {
+	r             io.Reader
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16
+	numFrames     uint32
+	haveComm      bool
+}
+
+// NewAIFFReader creates a new AIFF reader, reading the header up to the
+// start of the sample data
+func NewAIFFReader(r io.Reader) (*AIFFReader, error) {
+	a := &AIFFReader{r: r}
+	if err := a.readHeader(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// readHeader reads the FORM header and the chunks up to the SSND chunk
+func (a *AIFFReader) readHeader() error {
+	formHeader := make([]byte, 12)
+	if _, err := io.ReadFull(a.r, formHeader); err != nil {
+		return err
+	}
+	if string(formHeader[0:4]) != "FORM" {
+		return errors.New("not a valid AIFF file: missing FORM header")
+	}
+	switch string(formHeader[8:12]) {
+	case "AIFF":
+	case "AIFC":
+		return errors.New("compressed AIFF-C files are not supported")
+	default:
+		return errors.New("not a valid AIFF file: missing AIFF header")
+	}
+
+	for {
+		chunkHeader := make([]byte, 8)
+		if _, err := io.ReadFull(a.r, chunkHeader); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := binary.BigEndian.Uint32(chunkHeader[4:8])
+
+		if chunkID == "COMM" {
+			if err := a.readCommChunk(chunkSize); err != nil {
+				return err
+			}
+		} else if chunkID == "SSND" {
+			if !a.haveComm {
+				return errors.New("not a valid AIFF file: SSND chunk before COMM chunk")
+			}
+
+			// The sample data starts after an offset into the chunk,
+			// normally 0, and an alignment block size
+			ssndHeader := make([]byte, 8)
+			if _, err := io.ReadFull(a.r, ssndHeader); err != nil {
+				return err
+			}
+			offset := binary.BigEndian.Uint32(ssndHeader[0:4])
+			if _, err := io.CopyN(io.Discard, a.r, int64(offset)); err != nil {
+				return err
+			}
+
+			// COMM's frame count must fit in the chunk, which bounds what
+			// ReadSamples reads
+			frameBytes := int64(a.bitsPerSample+7) / 8 * int64(a.channels)
+			if available := (int64(chunkSize) - 8 - int64(offset)) / frameBytes; int64(a.numFrames) > available {
+				return fmt.Errorf("COMM chunk declares %d sample frames but the SSND chunk holds %d", a.numFrames, max(available, 0))
+			}
+			return nil
+		} else {
+			// Skip unknown chunk
+			if _, err := io.CopyN(io.Discard, a.r, int64(chunkSize)); err != nil {
+				return err
+			}
+		}
+
+		// Chunks are word-aligned: an odd-sized chunk is followed by a
+		// pad byte
+		if chunkSize%2 == 1 {
+			if _, err := io.ReadFull(a.r, make([]byte, 1)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readCommChunk reads the common chunk
+func (a *AIFFReader) readCommChunk(size uint32) error {
+	if size < 18 {
+		return errors.New("invalid COMM chunk size")
+	}
+
+	commData := make([]byte, size)
+	if _, err := io.ReadFull(a.r, commData); err != nil {
+		return err
+	}
+
+	a.channels = binary.BigEndian.Uint16(commData[0:2])
+	a.numFrames = binary.BigEndian.Uint32(commData[2:6])
+	a.bitsPerSample = binary.BigEndian.Uint16(commData[6:8])
+	rate, err := parseExtended(commData[8:18])
+	if err != nil {
+		return err
+	}
+	a.sampleRate = rate
+
+	if a.bitsPerSample == 0 || a.bitsPerSample > 32 {
+		return errors.New("unsupported bits per sample")
+	}
+	if a.channels == 0 || a.channels > maxFLACChannels {
+		return fmt.Errorf("AIFF has %d channels but FLAC supports 1 to %d", a.channels, maxFLACChannels)
+	}
+	a.haveComm = true
+	return nil
+}
+
+// parseExtended converts an 80-bit IEEE 754 extended precision number, as
+// AIFF stores its sample rate, to an integer sample rate
+func parseExtended(b []byte) (uint32, error) {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]))
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent&0x8000 != 0 {
+		return 0, errors.New("negative AIFF sample rate")
+	}
+
+	// The mantissa has an explicit integer bit: value = mantissa * 2^(e-16383-63)
+	rate := math.Round(math.Ldexp(float64(mantissa), exponent-16383-63))
+	if rate < 1 || rate > math.MaxUint32 {
+		return 0, errors.New("invalid AIFF sample rate")
+	}
+	return uint32(rate), nil
+}
+
+// ReadSamples reads all PCM samples from the AIFF file. They are read a
+// block at a time, so memory grows with the data actually present rather
+// than the frame count COMM declares.
+func (a *AIFFReader) ReadSamples() ([][]int32, error) {
+	bytesPerSample := int(a.bitsPerSample+7) / 8
+	frameBytes := bytesPerSample * int(a.channels)
+	remaining := int(a.numFrames)
+
+	samples := make([][]int32, a.channels)
+	buf := make([]byte, min(remaining, aiffReadFrames)*frameBytes)
+	for remaining > 0 {
+		n := min(remaining, aiffReadFrames)
+		block := buf[:n*frameBytes]
+		if _, err := io.ReadFull(a.r, block); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		for i := 0; i < len(block); i += bytesPerSample {
+			// Samples are signed big-endian, left-justified in whole bytes
+			var sample int32
+			for _, b := range block[i : i+bytesPerSample] {
+				sample = sample<<8 | int32(b)
+			}
+			shift := 32 - 8*bytesPerSample
+			sample = sample << shift >> shift
+			ch := i / bytesPerSample % int(a.channels)
+			samples[ch] = append(samples[ch], sample>>(8*bytesPerSample-int(a.bitsPerSample)))
+		}
+		remaining -= n
+	}
+
+	return samples, nil
+}
+
+// Channels returns the number of channels
+func (a *AIFFReader) Channels() uint16 {
+	return a.channels
+}
+
+// SampleRate returns the sample rate
+func (a *AIFFReader) SampleRate() uint32 {
+	return a.sampleRate
+}
+
+// BitsPerSample returns the bits per sample
+func (a *AIFFReader) BitsPerSample() uint16 {
+	return a.bitsPerSample
+}
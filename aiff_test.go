@@ -0,0 +1,173 @@
+package goflac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+// appendExtended appends an integer sample rate as an 80-bit extended
+// precision number
+func appendExtended(dst []byte, rate uint32) []byte {
+	n := bits.Len32(rate)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(16383+n-1))
+	return binary.BigEndian.AppendUint64(dst, uint64(rate)<<(64-n))
+}
+
+// buildAIFF assembles an AIFF file holding samples ([channel][sample]),
+// with an odd-sized NAME chunk before the COMM chunk
+func buildAIFF(samples [][]int32, sampleRate uint32, bitsPerSample uint16) []byte {
+	bytesPerSample := int(bitsPerSample+7) / 8
+
+	comm := binary.BigEndian.AppendUint16(nil, uint16(len(samples)))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(len(samples[0])))
+	comm = binary.BigEndian.AppendUint16(comm, bitsPerSample)
+	comm = appendExtended(comm, sampleRate)
+
+	ssnd := make([]byte, 8) // offset and block size
+	for i := range samples[0] {
+		for ch := range samples {
+			v := uint32(samples[ch][i]) << (8*bytesPerSample - int(bitsPerSample))
+			for b := bytesPerSample - 1; b >= 0; b-- {
+				ssnd = append(ssnd, byte(v>>(8*b)))
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	body.WriteString("AIFF")
+	for _, chunk := range []struct {
+		id   string
+		data []byte
+	}{
+		{"NAME", []byte("abc")},
+		{"COMM", comm},
+		{"SSND", ssnd},
+	} {
+		body.WriteString(chunk.id)
+		binary.Write(&body, binary.BigEndian, uint32(len(chunk.data)))
+		body.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var aiff bytes.Buffer
+	aiff.WriteString("FORM")
+	binary.Write(&aiff, binary.BigEndian, uint32(body.Len()))
+	aiff.Write(body.Bytes())
+	return aiff.Bytes()
+}
+
+func TestAIFFReader_SineToFLAC(t *testing.T) {
+	samples := make([][]int32, 2)
+	for ch := range samples {
+		samples[ch] = make([]int32, 10000)
+		for i := range samples[ch] {
+			samples[ch][i] = int32(math.Round(30000 * math.Sin(2*math.Pi*440*float64(i+ch*10)/48000)))
+		}
+	}
+
+	aiffReader, err := NewAIFFReader(bytes.NewReader(buildAIFF(samples, 48000, 16)))
+	if err != nil {
+		t.Fatalf("Failed to read AIFF: %v", err)
+	}
+	if aiffReader.Channels() != 2 || aiffReader.SampleRate() != 48000 || aiffReader.BitsPerSample() != 16 {
+		t.Errorf("Expected 2 channels of 16-bit audio at 48000 Hz, got %d channels of %d bits at %d Hz",
+			aiffReader.Channels(), aiffReader.BitsPerSample(), aiffReader.SampleRate())
+	}
+	read, err := aiffReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, samples, read)
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, aiffReader.SampleRate(), uint8(aiffReader.Channels()), uint8(aiffReader.BitsPerSample()))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(read); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	decoded, _, err := DecodeReader(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestAIFFReader_BitDepths(t *testing.T) {
+	for _, bitsPerSample := range []uint16{8, 12, 20, 24, 32} {
+		maxValue := int32(1<<(bitsPerSample-1) - 1)
+		samples := [][]int32{{0, 1, -1, maxValue, -maxValue - 1, maxValue / 3}}
+		aiffReader, err := NewAIFFReader(bytes.NewReader(buildAIFF(samples, 44100, bitsPerSample)))
+		if err != nil {
+			t.Fatalf("%d bits: failed to read AIFF: %v", bitsPerSample, err)
+		}
+		read, err := aiffReader.ReadSamples()
+		if err != nil {
+			t.Fatalf("%d bits: failed to read samples: %v", bitsPerSample, err)
+		}
+		assertSamplesEqual(t, samples, read)
+	}
+}
+
+func TestAIFFReader_InvalidHeader(t *testing.T) {
+	// Long enough to be read in more than one block
+	samples := [][]int32{make([]int32, 3*aiffReadFrames/2)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%2000) - 1000
+	}
+	aiff := buildAIFF(samples, 44100, 16)
+	aiffReader, err := NewAIFFReader(bytes.NewReader(aiff))
+	if err != nil {
+		t.Fatalf("Failed to read AIFF: %v", err)
+	}
+	read, err := aiffReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, samples, read)
+
+	// The COMM chunk body follows the FORM header and the NAME chunk
+	const comm = 12 + 12 + 8
+	for name, patch := range map[string]func(b []byte){
+		"no channels":     func(b []byte) { binary.BigEndian.PutUint16(b[comm:], 0) },
+		"9 channels":      func(b []byte) { binary.BigEndian.PutUint16(b[comm:], 9) },
+		"too many frames": func(b []byte) { binary.BigEndian.PutUint32(b[comm+2:], math.MaxUint32) },
+	} {
+		b := bytes.Clone(aiff)
+		patch(b)
+		if _, err := NewAIFFReader(bytes.NewReader(b)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// A file cut short of its SSND chunk is reported
+	aiffReader, err = NewAIFFReader(bytes.NewReader(aiff[:len(aiff)-1000]))
+	if err != nil {
+		t.Fatalf("Failed to read AIFF: %v", err)
+	}
+	if _, err := aiffReader.ReadSamples(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a truncated file, got %v", err)
+	}
+}
+
+func TestParseExtended(t *testing.T) {
+	for _, rate := range []uint32{8000, 11025, 22050, 44100, 48000, 96000, 192000} {
+		got, err := parseExtended(appendExtended(nil, rate))
+		if err != nil || got != rate {
+			t.Errorf("Expected %d, got %d (%v)", rate, got, err)
+		}
+	}
+
+	// 44100 Hz as written by common tools
+	got, err := parseExtended([]byte{0x40, 0x0E, 0xAC, 0x44, 0, 0, 0, 0, 0, 0})
+	if err != nil || got != 44100 {
+		t.Errorf("Expected 44100, got %d (%v)", got, err)
+	}
+}
@@ -0,0 +1,128 @@
+package goflac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// unknownWAVDataSize is the data chunk size written by tools that stream a
+// WAV without knowing its length in advance
+const unknownWAVDataSize = 0xFFFFFFFF
+
+// autoEncoder is the io.WriteCloser returned by NewAutoEncoder
+type autoEncoder struct {
+	out     io.Writer
+	header  []byte
+	wav     *WAVReader
+	encoder *Encoder
+
+	// remaining counts the data chunk bytes still to come; partial holds
+	// the bytes of an incomplete inter-channel sample
+	remaining uint64
+	partial   []byte
+	samples   [][]int32
+}
+
+// NewAutoEncoder returns a writer that accepts a complete WAV file as a
+// byte stream and writes it to out as FLAC. The first bytes written must be
+// the WAV header, from which the encoder configures itself; the PCM data
+// that follows is encoded as it arrives. Bytes past the end of the data
+// chunk are ignored, unless the header declares an unknown (0xFFFFFFFF)
+// data size as piped WAVs often do. Close finishes the FLAC stream.
+func NewAutoEncoder(out io.Writer) (io.WriteCloser, error) {
+	if out == nil {
+		return nil, errors.New("output writer must not be nil")
+	}
+	return &autoEncoder{out: out}, nil
+}
+
+// Write implements io.Writer
+func (a *autoEncoder) Write(p []byte) (int, error) {
+	n := len(p)
+	if a.encoder == nil {
+		a.header = append(a.header, p...)
+		consumed, err := a.configure()
+		if err != nil || a.encoder == nil {
+			return n, err
+		}
+		p = a.header[consumed:]
+		a.header = nil
+	}
+	return n, a.encode(p)
+}
+
+// configure parses the buffered header, creating the encoder once the whole
+// header has arrived. It returns the number of header bytes.
+func (a *autoEncoder) configure() (int, error) {
+	r := bytes.NewReader(a.header)
+	wav, err := NewWAVReader(r)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// Wait for more of the header
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	encoder, err := NewEncoderFromWAV(a.out, wav)
+	if err != nil {
+		return 0, err
+	}
+	a.wav = wav
+	a.encoder = encoder
+	a.remaining = uint64(wav.dataSize)
+	if wav.dataSize == unknownWAVDataSize {
+		a.remaining = ^uint64(0)
+	}
+	a.samples = make([][]int32, wav.channels)
+	return len(a.header) - r.Len(), nil
+}
+
+// encode converts whole inter-channel samples of PCM data and pushes them
+// to the encoder, keeping any trailing partial sample for the next call
+func (a *autoEncoder) encode(p []byte) error {
+	if uint64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+	a.remaining -= uint64(len(p))
+
+	data := p
+	if len(a.partial) > 0 {
+		data = append(a.partial, p...)
+	}
+	bytesPerSample := int(a.wav.bitsPerSample / 8)
+	frameBytes := bytesPerSample * int(a.wav.channels)
+	whole := len(data) / frameBytes * frameBytes
+
+	for ch := range a.samples {
+		a.samples[ch] = a.samples[ch][:0]
+	}
+	for i := 0; i < whole; i += frameBytes {
+		for ch := range a.samples {
+			offset := i + ch*bytesPerSample
+			sample, err := a.wav.parseSample(data[offset : offset+bytesPerSample])
+			if err != nil {
+				return err
+			}
+			a.samples[ch] = append(a.samples[ch], sample)
+		}
+	}
+	a.partial = append(a.partial[:0], data[whole:]...)
+
+	if whole == 0 {
+		return nil
+	}
+	return a.encoder.WriteSamples(a.samples)
+}
+
+// Close finishes the FLAC stream
+func (a *autoEncoder) Close() error {
+	if a.encoder == nil {
+		return errors.New("incomplete WAV header")
+	}
+	if len(a.partial) > 0 {
+		return errors.New("WAV data ends part way through a sample")
+	}
+	return a.encoder.Close()
+}
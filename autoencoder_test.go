@@ -0,0 +1,76 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAutoEncoder(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 0.5, 44100, 2, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavData := wavBuf.Bytes()
+
+	wav, err := NewWAVReader(bytes.NewReader(wavData))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wav.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	// Odd sized writes split both the header and samples across calls
+	for _, chunk := range []int{len(wavData), 4096, 7} {
+		var flacBuf bytes.Buffer
+		w, err := NewAutoEncoder(&flacBuf)
+		if err != nil {
+			t.Fatalf("Failed to create auto encoder: %v", err)
+		}
+		for start := 0; start < len(wavData); start += chunk {
+			end := min(start+chunk, len(wavData))
+			if n, err := w.Write(wavData[start:end]); err != nil || n != end-start {
+				t.Fatalf("Chunk %d: failed to write: %d, %v", chunk, n, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Chunk %d: failed to close: %v", chunk, err)
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+		if err != nil {
+			t.Fatalf("Chunk %d: failed to create decoder: %v", chunk, err)
+		}
+		if decoder.SampleRate() != 44100 || decoder.Channels() != 2 || decoder.BitsPerSample() != 16 {
+			t.Errorf("Chunk %d: unexpected format %d Hz, %d channels, %d bits", chunk,
+				decoder.SampleRate(), decoder.Channels(), decoder.BitsPerSample())
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("Chunk %d: failed to decode: %v", chunk, err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+}
+
+func TestAutoEncoder_Invalid(t *testing.T) {
+	w, err := NewAutoEncoder(&bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Failed to create auto encoder: %v", err)
+	}
+	if _, err := w.Write([]byte("RIFF")); err != nil {
+		t.Fatalf("Unexpected error for a partial header: %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Expected error closing with an incomplete header")
+	}
+
+	w, err = NewAutoEncoder(&bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Failed to create auto encoder: %v", err)
+	}
+	if _, err := w.Write([]byte("NOT A WAV FILE AT ALL")); err == nil {
+		t.Error("Expected error for a non-WAV stream")
+	}
+}
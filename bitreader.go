@@ -0,0 +1,158 @@
+package goflac
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// bitReader handles reading bits from a byte source
+type bitReader struct {
+	r         io.ByteReader
+	current   uint64
+	bitCount  int
+	bytesRead int64
+}
+
+// newBitReader creates a new bit reader
+func newBitReader(r io.ByteReader) *bitReader {
+	return &bitReader{r: r}
+}
+
+// position returns the number of bits consumed so far
+func (br *bitReader) position() int64 {
+	return br.bytesRead*8 - int64(br.bitCount)
+}
+
+// readBits reads n bits (up to 64) as an unsigned value
+func (br *bitReader) readBits(n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if n > 56 {
+		// Split wide reads so the accumulator never overflows
+		hi, err := br.readBits(n - 32)
+		if err != nil {
+			return 0, err
+		}
+		lo, err := br.readBits(32)
+		if err != nil {
+			return 0, err
+		}
+		return hi<<32 | lo, nil
+	}
+
+	for br.bitCount < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		br.current = br.current<<8 | uint64(b)
+		br.bitCount += 8
+		br.bytesRead++
+	}
+
+	br.bitCount -= n
+	value := br.current >> br.bitCount
+	br.current &= (1 << br.bitCount) - 1
+	return value, nil
+}
+
+// readBitsSigned reads n bits as a two's complement signed value
+func (br *bitReader) readBitsSigned(n int) (int64, error) {
+	value, err := br.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 || n == 64 {
+		return int64(value), nil
+	}
+	// Sign extend
+	shift := 64 - n
+	return int64(value<<shift) >> shift, nil
+}
+
+// readUnary reads a unary coded value: a run of 0 bits terminated by a 1
+func (br *bitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if br.bitCount == 0 {
+			b, err := br.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return 0, io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			br.current = uint64(b)
+			br.bitCount = 8
+			br.bytesRead++
+		}
+
+		// Count the leading zeros among the pending bits
+		pending := br.current << (64 - br.bitCount)
+		if pending == 0 {
+			count += uint64(br.bitCount)
+			br.current = 0
+			br.bitCount = 0
+			continue
+		}
+
+		zeros := bits.LeadingZeros64(pending)
+		count += uint64(zeros)
+		br.bitCount -= zeros + 1
+		br.current &= (1 << br.bitCount) - 1
+		return count, nil
+	}
+}
+
+// readUTF8 reads a number in UTF-8 style encoding
+func (br *bitReader) readUTF8() (uint64, error) {
+	first, err := br.readBits(8)
+	if err != nil {
+		return 0, err
+	}
+
+	// The number of leading 1 bits gives the total byte count
+	var length int
+	switch {
+	case first&0x80 == 0:
+		return first, nil
+	case first&0xE0 == 0xC0:
+		length = 2
+	case first&0xF0 == 0xE0:
+		length = 3
+	case first&0xF8 == 0xF0:
+		length = 4
+	case first&0xFC == 0xF8:
+		length = 5
+	case first&0xFE == 0xFC:
+		length = 6
+	case first == 0xFE:
+		length = 7
+	default:
+		return 0, errors.New("invalid UTF-8 coded number")
+	}
+
+	value := first & (0xFF >> (length + 1))
+	for i := 1; i < length; i++ {
+		b, err := br.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		if b&0xC0 != 0x80 {
+			return 0, errors.New("invalid UTF-8 continuation byte")
+		}
+		value = value<<6 | (b & 0x3F)
+	}
+	return value, nil
+}
+
+// alignToByte discards bits up to the next byte boundary
+func (br *bitReader) alignToByte() {
+	br.bitCount -= br.bitCount % 8
+	br.current &= (1 << br.bitCount) - 1
+}
@@ -0,0 +1,118 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestBitReader_MixedWidths(t *testing.T) {
+	rng := rand.New(rand.NewPCG(2, 70))
+
+	// A random sequence of every kind of field the writer produces
+	type field struct {
+		kind  int
+		width int
+		value uint64
+	}
+	var fields []field
+	bw := newBitWriter()
+	var bitsWritten int64
+	for i := 0; i < 2000; i++ {
+		f := field{kind: rng.IntN(4), width: 1 + rng.IntN(64)}
+		switch f.kind {
+		case 0, 1:
+			f.value = rng.Uint64() & (1<<f.width - 1)
+			if f.width == 64 {
+				f.value = rng.Uint64()
+			}
+			bw.writeBits(f.value, f.width)
+			bitsWritten += int64(f.width)
+		case 2:
+			f.value = uint64(rng.IntN(40))
+			bw.writeBits(0, int(f.value))
+			bw.writeBits(1, 1)
+			bitsWritten += int64(f.value) + 1
+		case 3:
+			f.value = rng.Uint64N(maxSampleNumber + 1)
+			before := len(bw.bytes())*8 + bw.bitCount
+			bw.writeUTF8(f.value)
+			bitsWritten += int64(len(bw.bytes())*8 + bw.bitCount - before)
+		}
+		fields = append(fields, f)
+	}
+	bw.alignToByte()
+
+	br := newBitReader(bytes.NewReader(bw.bytes()))
+	for i, f := range fields {
+		var got uint64
+		var err error
+		switch f.kind {
+		case 0:
+			got, err = br.readBits(f.width)
+		case 1:
+			var v int64
+			v, err = br.readBitsSigned(f.width)
+			got = uint64(v)
+			if f.width < 64 {
+				got &= 1<<f.width - 1
+			}
+		case 2:
+			got, err = br.readUnary()
+		case 3:
+			got, err = br.readUTF8()
+		}
+		if err != nil {
+			t.Fatalf("Field %d: failed to read: %v", i, err)
+		}
+		if got != f.value {
+			t.Fatalf("Field %d (kind %d, width %d): expected %d, got %d", i, f.kind, f.width, f.value, got)
+		}
+	}
+	if br.position() != bitsWritten {
+		t.Errorf("Expected position %d, got %d", bitsWritten, br.position())
+	}
+
+	br.alignToByte()
+	if br.position() != int64(len(bw.bytes()))*8 {
+		t.Errorf("Expected position %d after aligning, got %d", len(bw.bytes())*8, br.position())
+	}
+	if _, err := br.readBits(1); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF past the end, got %v", err)
+	}
+}
+
+func TestBitReader_SignExtension(t *testing.T) {
+	br := newBitReader(bytes.NewReader([]byte{0xF0, 0x7F}))
+	for _, tc := range []struct {
+		width int
+		want  int64
+	}{
+		{1, -1},
+		{3, -1},
+		{4, 0},
+		{8, 127},
+	} {
+		got, err := br.readBitsSigned(tc.width)
+		if err != nil {
+			t.Fatalf("Failed to read %d bits: %v", tc.width, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d bits: expected %d, got %d", tc.width, tc.want, got)
+		}
+	}
+}
+
+func TestBitReader_InvalidUTF8(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xFF},       // no valid length prefix
+		{0x80},       // continuation byte first
+		{0xC2, 0x41}, // missing continuation marker
+	} {
+		br := newBitReader(bytes.NewReader(data))
+		if _, err := br.readUTF8(); err == nil {
+			t.Errorf("Expected an error reading % X", data)
+		}
+	}
+}
@@ -14,12 +14,27 @@ func newBitWriter() *bitWriter {
 	return &bitWriter{}
 }
 
-// writeBits writes n bits from value to the buffer
+// reset discards all written bits, keeping the allocated buffer
+func (bw *bitWriter) reset() {
+	bw.buf.Reset()
+	bw.current = 0
+	bw.bitCount = 0
+}
+
+// writeBits writes the low n bits of value to the buffer, for n up to 64
 func (bw *bitWriter) writeBits(value uint64, n int) {
 	if n == 0 {
 		return
 	}
 
+	// Up to 7 bits are pending between calls, so the accumulator only has
+	// room for 57 more; wider values are written in two halves
+	if n > 56 {
+		bw.writeBits(value>>32, n-32)
+		value &= 0xFFFFFFFF
+		n = 32
+	}
+
 	// Add new bits to current
 	bw.current = (bw.current << n) | (value & ((1 << n) - 1))
 	bw.bitCount += n
@@ -33,19 +48,15 @@ func (bw *bitWriter) writeBits(value uint64, n int) {
 	}
 }
 
-// writeBitsSigned writes n bits from a signed value
+// writeBitsSigned writes n bits from a signed value in two's complement
 func (bw *bitWriter) writeBitsSigned(value int64, n int) {
-	// Convert signed to unsigned representation
-	var uval uint64
-	if value < 0 {
-		uval = uint64((1 << n) + value)
-	} else {
-		uval = uint64(value)
-	}
-	bw.writeBits(uval, n)
+	// The two's complement bit pattern truncated to n bits is the
+	// encoding for every value in range, including the most negative one
+	bw.writeBits(uint64(value), n)
 }
 
-// writeUTF8 writes a number in UTF-8 style encoding
+// writeUTF8 writes a number in UTF-8 style encoding. The value must fit
+// in 36 bits, the most the 7-byte form can hold.
 func (bw *bitWriter) writeUTF8(value uint64) {
 	if value < 0x80 {
 		bw.writeBits(value, 8)
@@ -0,0 +1,14 @@
+package goflac
+
+// WithVariableBlockSize makes the stream use the variable-blocksize
+// strategy: every frame header codes the number of its first sample rather
+// than a frame number, so EncodeFrame may be given blocks of any size from
+// frame to frame, for example short blocks around transients. STREAMINFO
+// reports the smallest and largest block actually encoded once it is
+// complete.
+func WithVariableBlockSize(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.variableBlockSize = enabled
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package goflac
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncoder_VariableBlockSize(t *testing.T) {
+	rng := rand.New(rand.NewPCG(27, 7))
+	sizes := []int{4096, 1152, 4096, 576, 2000}
+	expected := make([][]int32, 2)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "variable.flac"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+	encoder, err := NewEncoder(f, 44100, 2, 16, WithVariableBlockSize(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	for i, size := range sizes {
+		block := make([][]int32, 2)
+		for ch := range block {
+			block[ch] = make([]int32, size)
+			for j := range block[ch] {
+				block[ch][j] = int32(rng.IntN(2000) - 1000)
+			}
+			expected[ch] = append(expected[ch], block[ch]...)
+		}
+		if err := encoder.EncodeFrame(block, uint64(i)); err != nil {
+			t.Fatalf("Failed to encode frame %d: %v", i, err)
+		}
+	}
+	if err := encoder.Finalize(); err != nil {
+		t.Fatalf("Failed to finalize: %v", err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.BlockingStrategy() != BlockingStrategyVariable {
+		t.Error("Expected a variable-blocksize stream")
+	}
+	info := decoder.StreamInfo()
+	if info.MinBlockSize != 576 || info.MaxBlockSize != 4096 {
+		t.Errorf("Expected block sizes 576 to 4096, got %d to %d", info.MinBlockSize, info.MaxBlockSize)
+	}
+
+	// Each frame header codes the number of its first sample
+	var sample uint64
+	for i, size := range sizes {
+		frame, n, err := decoder.NextRawFrame()
+		if err != nil {
+			t.Fatalf("Failed to read frame %d: %v", i, err)
+		}
+		if n != size {
+			t.Errorf("Frame %d: expected %d samples, got %d", i, size, n)
+		}
+		if frame[1] != 0xF9 {
+			t.Errorf("Frame %d: expected the variable-blocksize sync byte 0xF9, got 0x%02X", i, frame[1])
+		}
+		br := newBitReader(bytes.NewReader(frame[4:]))
+		number, err := br.readUTF8()
+		if err != nil || number != sample {
+			t.Errorf("Frame %d: expected sample number %d, got %d (%v)", i, sample, number, err)
+		}
+		sample += uint64(size)
+	}
+
+	decoded, _, err := DecodeReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
@@ -0,0 +1,173 @@
+package goflac
+
+import (
+	"crypto/md5"
+	"encoding"
+	"encoding/binary"
+	"errors"
+)
+
+// checkpointMagic identifies a serialized encoder checkpoint
+const checkpointMagic = "GFCK"
+
+// checkpointVersion is the current checkpoint format version
+const checkpointVersion = 2
+
+// MarshalCheckpoint serializes the state needed to resume the encode and
+// finalize its STREAMINFO: the samples and bytes written so far, the
+// running MD5 state, the next frame number, the min/max frame and block
+// sizes, the seek points and where the SEEKTABLE and cue sheet lead-out
+// lie in the header. Take a checkpoint after flushing the output, so the
+// file on disk holds every byte the checkpoint accounts for. Samples
+// buffered by WriteSamples are not part of the stream yet, so it is an
+// error to take a checkpoint while any are pending.
+func (e *Encoder) MarshalCheckpoint() ([]byte, error) {
+	if len(e.pending) > 0 && len(e.pending[0]) > 0 {
+		return nil, errors.New("samples are pending: checkpoint after a whole number of blocks has been written")
+	}
+	marshaler, ok := e.md5.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("MD5 state cannot be exported")
+	}
+	md5State, err := marshaler.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := []byte(checkpointMagic)
+	buf = append(buf, checkpointVersion, e.channels, e.bitsPerSample)
+	buf = binary.BigEndian.AppendUint32(buf, e.sampleRate)
+	buf = binary.BigEndian.AppendUint64(buf, e.samplesEncoded)
+	buf = binary.BigEndian.AppendUint64(buf, e.nextFrameNumber)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.bytesWritten))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.headerLength))
+	buf = binary.BigEndian.AppendUint32(buf, e.minFrameSize)
+	buf = binary.BigEndian.AppendUint32(buf, e.maxFrameSize)
+	buf = binary.BigEndian.AppendUint16(buf, e.minBlockSize)
+	buf = binary.BigEndian.AppendUint16(buf, e.maxBlockSize)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(e.seekTableSlots))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.seekTableOffset))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.leadOutOffset))
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(md5State)))
+	buf = append(buf, md5State...)
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(e.seekPoints)))
+	for _, p := range e.seekPoints {
+		buf = binary.BigEndian.AppendUint64(buf, p.SampleNumber)
+		buf = binary.BigEndian.AppendUint64(buf, p.Offset)
+		buf = binary.BigEndian.AppendUint16(buf, p.FrameSamples)
+	}
+	return buf, nil
+}
+
+// RestoreCheckpoint resumes an encode from a checkpoint made by
+// MarshalCheckpoint. The encoder must have been created with the same
+// sample rate, channels and bits per sample, on a writer that appends to
+// the partial output truncated to CheckpointLength bytes, and with the same
+// options. The stream header is treated as already written, and encoding
+// continues with frame NextFrameNumber. If the writer can seek, Close
+// completes the header as it would have for the uninterrupted encode.
+func (e *Encoder) RestoreCheckpoint(data []byte) error {
+	errTruncated := errors.New("truncated checkpoint")
+
+	const fixedLength = len(checkpointMagic) + 3 + 4 + 4*8 + 2*4 + 2*2 + 4 + 2*8
+	if len(data) < fixedLength+4 || string(data[:len(checkpointMagic)]) != checkpointMagic {
+		return errors.New("not an encoder checkpoint")
+	}
+	data = data[len(checkpointMagic):]
+	if data[0] != checkpointVersion {
+		return errors.New("unsupported checkpoint version")
+	}
+	if data[1] != e.channels || data[2] != e.bitsPerSample || binary.BigEndian.Uint32(data[3:7]) != e.sampleRate {
+		return errors.New("checkpoint stream format does not match the encoder")
+	}
+	data = data[7:]
+
+	samplesEncoded := binary.BigEndian.Uint64(data[0:8])
+	nextFrameNumber := binary.BigEndian.Uint64(data[8:16])
+	bytesWritten := int64(binary.BigEndian.Uint64(data[16:24]))
+	headerLength := int64(binary.BigEndian.Uint64(data[24:32]))
+	minFrameSize := binary.BigEndian.Uint32(data[32:36])
+	maxFrameSize := binary.BigEndian.Uint32(data[36:40])
+	minBlockSize := binary.BigEndian.Uint16(data[40:42])
+	maxBlockSize := binary.BigEndian.Uint16(data[42:44])
+	seekTableSlots := int(binary.BigEndian.Uint32(data[44:48]))
+	seekTableOffset := int64(binary.BigEndian.Uint64(data[48:56]))
+	leadOutOffset := int64(binary.BigEndian.Uint64(data[56:64]))
+	data = data[64:]
+
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return errTruncated
+	}
+	h := md5.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(data[:n]); err != nil {
+		return err
+	}
+	data = data[n:]
+
+	if len(data) < 4 {
+		return errTruncated
+	}
+	count := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	const seekPointLength = 8 + 8 + 2
+	if uint64(count)*seekPointLength != uint64(len(data)) {
+		return errTruncated
+	}
+	seekPoints := make([]SeekPoint, count)
+	for i := range seekPoints {
+		seekPoints[i] = SeekPoint{
+			SampleNumber: binary.BigEndian.Uint64(data[0:8]),
+			Offset:       binary.BigEndian.Uint64(data[8:16]),
+			FrameSamples: binary.BigEndian.Uint16(data[16:18]),
+		}
+		data = data[seekPointLength:]
+	}
+
+	// The stream starts where the writer was before the checkpointed
+	// output was written
+	offset, seekable := e.streamOffset()
+	if seekable && offset < bytesWritten {
+		return errors.New("writer holds less output than the checkpoint accounts for")
+	}
+
+	e.md5 = h
+	e.samplesEncoded = samplesEncoded
+	e.nextFrameNumber = nextFrameNumber
+	e.bytesWritten = bytesWritten
+	e.headerLength = headerLength
+	e.minFrameSize = minFrameSize
+	e.maxFrameSize = maxFrameSize
+	e.minBlockSize = minBlockSize
+	e.maxBlockSize = maxBlockSize
+	e.seekPoints = seekPoints
+	e.seekTableSlots = seekTableSlots
+	e.seekTableOffset = seekTableOffset
+	e.leadOutOffset = leadOutOffset
+	e.seekable = seekable
+	if seekable {
+		e.streamStart = offset - bytesWritten
+	}
+	e.streamInfoFinal = false
+	e.headerWritten = true
+	return nil
+}
+
+// CheckpointLength returns the length the output had when the checkpoint
+// was taken; anything a crashed encode wrote after it must be discarded
+// before resuming
+func CheckpointLength(data []byte) (int64, error) {
+	const offset = len(checkpointMagic) + 3 + 4 + 2*8
+	if len(data) < offset+8 || string(data[:len(checkpointMagic)]) != checkpointMagic {
+		return 0, errors.New("not an encoder checkpoint")
+	}
+	return int64(binary.BigEndian.Uint64(data[offset:])), nil
+}
+
+// NextFrameNumber returns the frame number the next frame should carry
+func (e *Encoder) NextFrameNumber() uint64 {
+	return e.nextFrameNumber
+}
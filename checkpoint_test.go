@@ -0,0 +1,288 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncoder_CheckpointResume(t *testing.T) {
+	const frames = 10
+	const blockSize = 4096
+	samples := [][]int32{make([]int32, frames*blockSize), make([]int32, frames*blockSize)}
+	for i := range samples[0] {
+		samples[0][i] = int32((i*7)%3000) - 1500
+		samples[1][i] = int32((i*13)%5000) - 2500
+	}
+	block := func(n int) [][]int32 {
+		return [][]int32{
+			samples[0][n*blockSize : (n+1)*blockSize],
+			samples[1][n*blockSize : (n+1)*blockSize],
+		}
+	}
+
+	// Uninterrupted reference encode
+	var reference bytes.Buffer
+	full, err := NewEncoder(&reference, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := full.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	for n := 0; n < frames; n++ {
+		if err := full.EncodeFrame(block(n), uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+
+	// Encode half, checkpoint, then crash partway through the next frame
+	var partial bytes.Buffer
+	first, err := NewEncoder(&partial, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := first.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	for n := 0; n < frames/2; n++ {
+		if err := first.EncodeFrame(block(n), uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+	checkpoint, err := first.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("Failed to marshal checkpoint: %v", err)
+	}
+	partial.Write([]byte{0xFF, 0xF8, 0x00})
+
+	// Resume on the truncated output
+	length, err := CheckpointLength(checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint length: %v", err)
+	}
+	resumed := bytes.NewBuffer(partial.Bytes()[:length])
+	second, err := NewEncoder(resumed, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := second.RestoreCheckpoint(checkpoint); err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	if second.NextFrameNumber() != frames/2 {
+		t.Fatalf("Expected to resume at frame %d, got %d", frames/2, second.NextFrameNumber())
+	}
+	for n := int(second.NextFrameNumber()); n < frames; n++ {
+		if err := second.EncodeFrame(block(n), uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+
+	if !bytes.Equal(resumed.Bytes(), reference.Bytes()) {
+		t.Error("Resumed output differs from the uninterrupted encode")
+	}
+	if second.currentStreamInfo() != full.currentStreamInfo() {
+		t.Errorf("Resumed STREAMINFO %+v differs from %+v", second.currentStreamInfo(), full.currentStreamInfo())
+	}
+	expected, err := full.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("Failed to marshal checkpoint: %v", err)
+	}
+	got, err := second.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("Failed to marshal checkpoint: %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Error("Resumed encoder state differs from the uninterrupted encode")
+	}
+
+	// The running MD5 must match the decoded audio
+	decoder, err := NewDecoder(bytes.NewReader(resumed.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+	var sum [16]byte
+	copy(sum[:], decoder.md5.Sum(nil))
+	if second.currentStreamInfo().MD5 != sum {
+		t.Error("Resumed MD5 does not match the decoded audio")
+	}
+}
+
+func TestEncoder_CheckpointResumeFile(t *testing.T) {
+	const frames = 10
+	const blockSize = 4096
+	const interval = 2 * blockSize
+	samples := [][]int32{make([]int32, frames*blockSize), make([]int32, frames*blockSize)}
+	for i := range samples[0] {
+		samples[0][i] = int32(math.Round(12000 * math.Sin(2*math.Pi*440*float64(i)/44100)))
+		samples[1][i] = int32((i*13)%5000) - 2500
+	}
+	block := func(n int) [][]int32 {
+		return [][]int32{
+			samples[0][n*blockSize : (n+1)*blockSize],
+			samples[1][n*blockSize : (n+1)*blockSize],
+		}
+	}
+
+	// newEncoder creates an encoder on f with a SEEKTABLE; the first
+	// encode also carries a cue sheet
+	newEncoder := func(f *os.File, cueSheet bool) *Encoder {
+		encoder, err := NewEncoder(f, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetSeekInterval(interval); err != nil {
+			t.Fatalf("Failed to set seek interval: %v", err)
+		}
+		if cueSheet {
+			cs, err := ParseCueSheet(strings.NewReader(testCueSheet), 44100, 16)
+			if err != nil {
+				t.Fatalf("Failed to parse cue sheet: %v", err)
+			}
+			if err := encoder.SetCueSheet(cs); err != nil {
+				t.Fatalf("Failed to set cue sheet: %v", err)
+			}
+		}
+		return encoder
+	}
+
+	// Encode half to a file, checkpoint, then crash partway through the
+	// next frame
+	path := filepath.Join(t.TempDir(), "resume.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	first := newEncoder(f, true)
+	first.totalSamples = frames * blockSize
+	if err := first.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	for n := 0; n < frames/2; n++ {
+		if err := first.EncodeFrame(block(n), uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+	checkpoint, err := first.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("Failed to marshal checkpoint: %v", err)
+	}
+	if _, err := f.Write([]byte{0xFF, 0xF8, 0x00}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	// Resume on the truncated file
+	length, err := CheckpointLength(checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint length: %v", err)
+	}
+	if err := os.Truncate(path, length); err != nil {
+		t.Fatalf("Failed to truncate file: %v", err)
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+	second := newEncoder(f, false)
+	if err := second.RestoreCheckpoint(checkpoint); err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	for n := int(second.NextFrameNumber()); n < frames; n++ {
+		if err := second.EncodeFrame(block(n), uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// The header on disk describes the whole encode
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+	info := decoder.StreamInfo()
+	if info.TotalSamples != frames*blockSize {
+		t.Errorf("Expected %d total samples in STREAMINFO, got %d", frames*blockSize, info.TotalSamples)
+	}
+	if info.MD5 == [16]byte{} {
+		t.Error("Expected the MD5 signature to be filled in")
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Failed to verify MD5: %v", err)
+	}
+	tracks := decoder.CueSheet().Tracks
+	if leadOut := tracks[len(tracks)-1]; leadOut.Offset != frames*blockSize {
+		t.Errorf("Expected the lead-out at %d, got %d", frames*blockSize, leadOut.Offset)
+	}
+	checkSeekTable(t, data, samples, interval)
+}
+
+func TestEncoder_CheckpointPending(t *testing.T) {
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples([][]int32{make([]int32, 5000)}); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+
+	// 904 samples are buffered behind the first block
+	if _, err := encoder.MarshalCheckpoint(); err == nil {
+		t.Error("Expected an error checkpointing with samples pending")
+	}
+	if err := encoder.WriteSamples([][]int32{make([]int32, 4096-904)}); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if _, err := encoder.MarshalCheckpoint(); err != nil {
+		t.Errorf("Failed to marshal checkpoint on a block boundary: %v", err)
+	}
+}
+
+func TestEncoder_RestoreCheckpointMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	mono, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	checkpoint, err := mono.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("Failed to marshal checkpoint: %v", err)
+	}
+
+	stereo, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := stereo.RestoreCheckpoint(checkpoint); err == nil {
+		t.Error("Expected error restoring a checkpoint with a different format")
+	}
+	if err := stereo.RestoreCheckpoint(checkpoint[:10]); err == nil {
+		t.Error("Expected error restoring a truncated checkpoint")
+	}
+}
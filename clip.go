@@ -0,0 +1,57 @@
+package goflac
+
+import "fmt"
+
+// WithClipping clips samples that do not fit in the encoder's bits per
+// sample to the nearest representable value instead of failing. By default
+// EncodeFrame rejects such samples, as writing them would truncate their
+// high bits and corrupt the stream. The decoded stream, its MD5 signature
+// included, is the clipped audio.
+func WithClipping(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.clip = enabled
+		return nil
+	}
+}
+
+// checkSampleRange returns samples if every value fits in the encoder's
+// bits per sample. Otherwise it returns an error naming the first sample
+// out of range or, with clipping enabled, a clipped copy held in scratch
+// space.
+func (e *Encoder) checkSampleRange(samples [][]int32, frameNumber uint64) ([][]int32, error) {
+	if e.bitsPerSample >= 32 {
+		return samples, nil
+	}
+	maxValue := int32(1)<<(e.bitsPerSample-1) - 1
+	minValue := -maxValue - 1
+
+	inRange := true
+	for ch, channel := range samples {
+		for i, v := range channel {
+			if v < minValue || v > maxValue {
+				if !e.clip {
+					return nil, fmt.Errorf("sample %d of channel %d in frame %d is out of range for %d bits: %d",
+						i, ch, frameNumber, e.bitsPerSample, v)
+				}
+				inRange = false
+				break
+			}
+		}
+	}
+	if inRange {
+		return samples, nil
+	}
+
+	if cap(e.clipped) < len(samples) {
+		e.clipped = make([][]int32, len(samples))
+	}
+	e.clipped = e.clipped[:len(samples)]
+	for ch, channel := range samples {
+		out := append(e.clipped[ch][:0], channel...)
+		for i, v := range out {
+			out[i] = max(minValue, min(maxValue, v))
+		}
+		e.clipped[ch] = out
+	}
+	return e.clipped, nil
+}
@@ -0,0 +1,63 @@
+package goflac
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncoder_SampleOutOfRange(t *testing.T) {
+	samples := [][]int32{make([]int32, 5000), make([]int32, 5000)}
+	samples[1][4100] = 40000
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	err = encoder.Encode(samples)
+	if err == nil {
+		t.Fatal("Expected an error for a sample out of range")
+	}
+	// The second frame starts at sample 4096
+	if !strings.Contains(err.Error(), "sample 4 of channel 1 in frame 1") {
+		t.Errorf("Expected the error to name the sample, got %v", err)
+	}
+
+	// The most negative value is in range
+	samples[1][4100] = -32768
+	buf.Reset()
+	encoder, err = NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Errorf("Failed to encode samples in range: %v", err)
+	}
+}
+
+func TestEncoder_Clipping(t *testing.T) {
+	samples := [][]int32{{0, 40000, -40000, 32767, -32768, 100, 1 << 30, -1 << 30}}
+	input := slices.Clone(samples[0])
+	expected := [][]int32{{0, 32767, -32768, 32767, -32768, 100, 32767, -32768}}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16, WithClipping(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if !slices.Equal(samples[0], input) {
+		t.Error("Clipping modified the caller's samples")
+	}
+
+	// DecodeAll also checks the MD5 signature of the clipped audio
+	decoded, _, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
@@ -0,0 +1,131 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SampleDifference describes the first sample at which two streams differ.
+// HasA is false when the first stream ended before Sample, and likewise
+// HasB for the second stream.
+type SampleDifference struct {
+	Sample  uint64
+	Channel int
+	A, B    int32
+	HasA    bool
+	HasB    bool
+}
+
+// Error implements the error interface
+func (d *SampleDifference) Error() string {
+	switch {
+	case !d.HasA:
+		return fmt.Sprintf("first stream ends at sample %d", d.Sample)
+	case !d.HasB:
+		return fmt.Sprintf("second stream ends at sample %d", d.Sample)
+	}
+	return fmt.Sprintf("sample %d channel %d differs: %d != %d", d.Sample, d.Channel, d.A, d.B)
+}
+
+// StreamsEquivalent decodes two FLAC streams and compares their audio
+// sample by sample, ignoring metadata and how the audio is split into
+// frames. When the audio differs it returns false along with an error
+// describing the difference; for differing samples or lengths that error
+// is a *SampleDifference locating the first mismatch. Decoding failures
+// are returned with false as well.
+func StreamsEquivalent(a, b io.Reader) (bool, error) {
+	da, err := NewDecoder(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := NewDecoder(b)
+	if err != nil {
+		return false, err
+	}
+
+	if da.Channels() != db.Channels() {
+		return false, fmt.Errorf("channel counts differ: %d != %d", da.Channels(), db.Channels())
+	}
+	if da.BitsPerSample() != db.BitsPerSample() {
+		return false, fmt.Errorf("bits per sample differ: %d != %d", da.BitsPerSample(), db.BitsPerSample())
+	}
+	if da.SampleRate() != db.SampleRate() {
+		return false, fmt.Errorf("sample rates differ: %d != %d", da.SampleRate(), db.SampleRate())
+	}
+
+	sa := &sampleQueue{d: da}
+	sb := &sampleQueue{d: db}
+	var position uint64
+	for {
+		if err := sa.fill(); err != nil {
+			return false, err
+		}
+		if err := sb.fill(); err != nil {
+			return false, err
+		}
+		na, nb := sa.pending(), sb.pending()
+		if na == 0 && nb == 0 {
+			return true, nil
+		}
+		if na == 0 || nb == 0 {
+			return false, &SampleDifference{Sample: position, HasA: na > 0, HasB: nb > 0}
+		}
+
+		n := min(na, nb)
+		for i := 0; i < n; i++ {
+			for ch := range sa.frame {
+				x, y := sa.frame[ch][sa.pos+i], sb.frame[ch][sb.pos+i]
+				if x != y {
+					return false, &SampleDifference{
+						Sample:  position + uint64(i),
+						Channel: ch,
+						A:       x,
+						B:       y,
+						HasA:    true,
+						HasB:    true,
+					}
+				}
+			}
+		}
+		sa.pos += n
+		sb.pos += n
+		position += uint64(n)
+	}
+}
+
+// sampleQueue holds the undelivered samples of the last decoded frame
+type sampleQueue struct {
+	d     *Decoder
+	frame [][]int32
+	pos   int
+	done  bool
+}
+
+// pending returns the number of undelivered inter-channel samples
+func (q *sampleQueue) pending() int {
+	if len(q.frame) == 0 {
+		return 0
+	}
+	return len(q.frame[0]) - q.pos
+}
+
+// fill decodes frames until samples are pending or the stream ends
+func (q *sampleQueue) fill() error {
+	for !q.done && q.pending() == 0 {
+		frame, err := q.d.ReadFrame()
+		if err == io.EOF {
+			q.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(frame) != int(q.d.Channels()) {
+			return errors.New("frame channel count does not match STREAMINFO")
+		}
+		q.frame = frame
+		q.pos = 0
+	}
+	return nil
+}
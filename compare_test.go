@@ -0,0 +1,52 @@
+package goflac
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStreamsEquivalent(t *testing.T) {
+	samples := riceTestSignals()["sine"]
+
+	// Different Rice partitioning, forced by a tight quotient limit,
+	// changes the bytes but not the audio
+	_, unlimited := rawFrameSizes(t, samples)
+	_, limited := rawFrameSizes(t, samples, WithMaxRiceQuotient(2))
+	if bytes.Equal(unlimited, limited) {
+		t.Fatal("Expected the two encodes to differ byte-wise")
+	}
+
+	equal, err := StreamsEquivalent(bytes.NewReader(unlimited), bytes.NewReader(limited))
+	if err != nil || !equal {
+		t.Errorf("Expected equivalent streams, got %v, %v", equal, err)
+	}
+}
+
+func TestStreamsEquivalent_ReportsFirstDifference(t *testing.T) {
+	samples := riceTestSignals()["sine"]
+	_, original := rawFrameSizes(t, samples)
+
+	changed := [][]int32{append([]int32(nil), samples[0]...)}
+	changed[0][5000] ^= 1
+	_, modified := rawFrameSizes(t, changed)
+
+	equal, err := StreamsEquivalent(bytes.NewReader(original), bytes.NewReader(modified))
+	if equal {
+		t.Fatal("Expected streams to differ")
+	}
+	var diff *SampleDifference
+	if !errors.As(err, &diff) {
+		t.Fatalf("Expected a *SampleDifference, got %v", err)
+	}
+	if diff.Sample != 5000 || diff.Channel != 0 || diff.A != samples[0][5000] || diff.B != changed[0][5000] {
+		t.Errorf("Unexpected difference: %+v", diff)
+	}
+
+	// A truncated stream differs where it ends
+	_, shorter := rawFrameSizes(t, [][]int32{samples[0][:4096]})
+	equal, err = StreamsEquivalent(bytes.NewReader(original), bytes.NewReader(shorter))
+	if equal || !errors.As(err, &diff) || diff.Sample != 4096 || diff.HasB {
+		t.Errorf("Expected the second stream to end at 4096, got %v, %v", equal, err)
+	}
+}
@@ -0,0 +1,79 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ConcatWithCrossfade decodes the FLAC streams in order and writes them to
+// w as a single FLAC stream, crossfading each boundary over fadeDuration.
+// The end of one stream is overlap-added with the start of the next using a
+// linear fade, so the joined audio is shorter than the sum of its parts by
+// the fade length at every seam. A fade longer than either side of a seam
+// is shortened to fit. All streams must share sample rate, channel count
+// and bit depth.
+func ConcatWithCrossfade(w io.Writer, fadeDuration time.Duration, streams ...io.Reader) error {
+	if len(streams) == 0 {
+		return errors.New("no streams to concatenate")
+	}
+	if fadeDuration < 0 {
+		return errors.New("crossfade duration must not be negative")
+	}
+
+	var (
+		info   StreamInfo
+		joined [][]int32
+	)
+	for i, r := range streams {
+		decoder, err := NewDecoder(r)
+		if err != nil {
+			return fmt.Errorf("stream %d: %w", i, err)
+		}
+		samples, err := decoder.DecodeAll()
+		if err != nil {
+			return fmt.Errorf("stream %d: %w", i, err)
+		}
+
+		if i == 0 {
+			info = decoder.StreamInfo()
+			joined = samples
+			continue
+		}
+		if decoder.SampleRate() != info.SampleRate || decoder.Channels() != info.Channels ||
+			decoder.BitsPerSample() != info.BitsPerSample {
+			return fmt.Errorf("stream %d format %d Hz/%d ch/%d bit does not match %d Hz/%d ch/%d bit",
+				i, decoder.SampleRate(), decoder.Channels(), decoder.BitsPerSample(),
+				info.SampleRate, info.Channels, info.BitsPerSample)
+		}
+
+		fade := int(uint64(fadeDuration) * uint64(info.SampleRate) / uint64(time.Second))
+		joined = crossfade(joined, samples, fade)
+	}
+
+	encoder, err := NewEncoder(w, info.SampleRate, info.Channels, info.BitsPerSample)
+	if err != nil {
+		return err
+	}
+	return encoder.Encode(joined)
+}
+
+// crossfade appends b to a, overlap-adding the last fade samples of a with
+// the first fade samples of b
+func crossfade(a, b [][]int32, fade int) [][]int32 {
+	fade = min(fade, len(a[0]), len(b[0]))
+	start := len(a[0]) - fade
+	for ch := range a {
+		// The fade-in gain rises from 1/(fade+1) to fade/(fade+1), so
+		// neither side is ever fully silent inside the overlap
+		for i := 0; i < fade; i++ {
+			in := int64(i + 1)
+			out := int64(fade+1) - in
+			mixed := (int64(a[ch][start+i])*out + int64(b[ch][i])*in) / int64(fade+1)
+			a[ch][start+i] = int32(mixed)
+		}
+		a[ch] = append(a[ch], b[ch][fade:]...)
+	}
+	return a
+}
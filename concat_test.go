@@ -0,0 +1,104 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+// encodeToneFLAC encodes a stereo sine of the given frequency and phase
+func encodeToneFLAC(t *testing.T, sampleRate uint32, freq, phase float64, n int) []byte {
+	t.Helper()
+
+	samples := [][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		v := int32(16000 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)+phase))
+		samples[0][i] = v
+		samples[1][i] = -v
+	}
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, sampleRate, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestConcatWithCrossfade(t *testing.T) {
+	const n = 44100
+	// The first tone ends at zero and the second starts at full amplitude,
+	// so a hard cut would jump by 16000
+	first := encodeToneFLAC(t, 44100, 220, 0, n)
+	second := encodeToneFLAC(t, 44100, 220, math.Pi/2, n)
+
+	var out bytes.Buffer
+	fade := 50 * time.Millisecond
+	if err := ConcatWithCrossfade(&out, fade, bytes.NewReader(first), bytes.NewReader(second)); err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	fadeSamples := 2205
+	if len(decoded[0]) != 2*n-fadeSamples {
+		t.Fatalf("Expected %d samples, got %d", 2*n-fadeSamples, len(decoded[0]))
+	}
+
+	// A 220 Hz sine at 16000 moves at most 2*pi*220/44100*16000 per sample,
+	// and the fade adds at most the full 32000 span spread over its length
+	maxDelta := int32(math.Ceil(2*math.Pi*220/44100*16000)) + 32000/int32(fadeSamples) + 2
+	for ch := range decoded {
+		for i := n - fadeSamples - 100; i < n+100; i++ {
+			delta := decoded[ch][i+1] - decoded[ch][i]
+			if delta > maxDelta || delta < -maxDelta {
+				t.Fatalf("Channel %d: discontinuity of %d at sample %d", ch, delta, i)
+			}
+		}
+	}
+}
+
+func TestConcatWithCrossfade_NoFade(t *testing.T) {
+	first := encodeToneFLAC(t, 44100, 440, 0, 1000)
+	second := encodeToneFLAC(t, 44100, 440, 0, 3000)
+
+	var out bytes.Buffer
+	if err := ConcatWithCrossfade(&out, 0, bytes.NewReader(first), bytes.NewReader(second)); err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded[0]) != 4000 {
+		t.Errorf("Expected 4000 samples, got %d", len(decoded[0]))
+	}
+}
+
+func TestConcatWithCrossfade_FormatMismatch(t *testing.T) {
+	first := encodeToneFLAC(t, 44100, 440, 0, 1000)
+	second := encodeToneFLAC(t, 48000, 440, 0, 1000)
+
+	err := ConcatWithCrossfade(io.Discard, time.Millisecond, bytes.NewReader(first), bytes.NewReader(second))
+	if err == nil {
+		t.Error("Expected error for mismatched sample rates")
+	}
+	if err := ConcatWithCrossfade(io.Discard, time.Millisecond); err == nil {
+		t.Error("Expected error for no streams")
+	}
+}
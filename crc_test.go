@@ -0,0 +1,154 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// referenceCRC8 computes the frame header CRC-8 (polynomial x^8+x^2+x+1,
+// initial value 0) one message bit at a time, as the shift register the
+// specification describes
+func referenceCRC8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			feedback := crc>>7 ^ b>>i&1
+			crc <<= 1
+			if feedback != 0 {
+				crc ^= 0x07
+			}
+		}
+	}
+	return crc
+}
+
+// referenceCRC16 computes the frame CRC-16 (polynomial
+// x^16+x^15+x^2+1, initial value 0, not reflected) one message bit at a
+// time
+func referenceCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			feedback := crc>>15 ^ uint16(b>>i&1)
+			crc <<= 1
+			if feedback != 0 {
+				crc ^= 0x8005
+			}
+		}
+	}
+	return crc
+}
+
+// frameHeaderLength returns the length of a frame header up to, but not
+// including, its CRC-8, from the codes in its fixed part
+func frameHeaderLength(frame []byte) int {
+	n := 4
+
+	// The coded number's first byte gives its length in leading ones
+	length := 0
+	for b := frame[4]; b&0x80 != 0; b <<= 1 {
+		length++
+	}
+	n += max(length, 1)
+
+	switch frame[2] >> 4 {
+	case 0x06:
+		n++
+	case 0x07:
+		n += 2
+	}
+	switch frame[2] & 0x0F {
+	case 0x0C:
+		n++
+	case 0x0D, 0x0E:
+		n += 2
+	}
+	return n
+}
+
+// encodeCRCTestFrames encodes frames with every shape of header: block
+// sizes and sample rates stored in the header or as codes, and frame
+// numbers of every coded length. It returns the frames as encoded.
+func encodeCRCTestFrames(t *testing.T) [][]byte {
+	t.Helper()
+
+	var frames [][]byte
+	for _, tc := range []struct {
+		sampleRate    uint32
+		channels      uint8
+		bitsPerSample uint8
+		blockSize     uint32
+	}{
+		{44100, 2, 16, 4096}, // rate and block size coded
+		{22000, 1, 8, 200},   // kHz rate, 8-bit block size
+		{44056, 3, 24, 1000}, // Hz rate, 16-bit block size
+		{65540, 2, 20, 192},  // tens of Hz rate
+		{96000, 8, 12, 4608},
+	} {
+		encoder, err := NewEncoder(io.Discard, tc.sampleRate, tc.channels, tc.bitsPerSample,
+			WithPacketCallback(func(frame []byte, samples int) {
+				frames = append(frames, bytes.Clone(frame))
+			}))
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetBlockSize(tc.blockSize); err != nil {
+			t.Fatalf("Failed to set block size: %v", err)
+		}
+		if err := encoder.WriteStreamInfo(); err != nil {
+			t.Fatalf("Failed to write stream info: %v", err)
+		}
+
+		block := make([][]int32, tc.channels)
+		for ch := range block {
+			block[ch] = make([]int32, tc.blockSize)
+			for i := range block[ch] {
+				block[ch][i] = int32((i*(ch+3))%101) - 50 + int32(i*i%7)
+			}
+		}
+		for _, number := range []uint64{0, 0x7F, 0x80, 0x7FF, 0x800, 0xFFFF, 0x10000, 0x1FFFFF, 0x200000, 0x3FFFFFF, 0x4000000, maxFrameNumber} {
+			if err := encoder.EncodeFrame(block, number); err != nil {
+				t.Fatalf("Failed to encode frame %d: %v", number, err)
+			}
+		}
+		// A short final block codes its size in the header
+		short := make([][]int32, tc.channels)
+		for ch := range short {
+			short[ch] = block[ch][:17]
+		}
+		if err := encoder.EncodeFrame(short, 1); err != nil {
+			t.Fatalf("Failed to encode short frame: %v", err)
+		}
+	}
+	return frames
+}
+
+func TestFrameHeaderCRC8(t *testing.T) {
+	// The check value of CRC-8 with this polynomial
+	if crc := calculateCRC8([]byte("123456789")); crc != 0xF4 {
+		t.Errorf("Expected check value 0xF4, got 0x%02X", crc)
+	}
+
+	for i, frame := range encodeCRCTestFrames(t) {
+		n := frameHeaderLength(frame)
+		if expected := referenceCRC8(frame[:n]); frame[n] != expected {
+			t.Errorf("Frame %d: header of %d bytes has CRC-8 0x%02X, expected 0x%02X", i, n, frame[n], expected)
+		}
+	}
+}
+
+func TestFrameCRC16(t *testing.T) {
+	// The check value of CRC-16 with this polynomial, unreflected
+	if crc := calculateCRC16([]byte("123456789")); crc != 0xFEE8 {
+		t.Errorf("Expected check value 0xFEE8, got 0x%04X", crc)
+	}
+
+	for i, frame := range encodeCRCTestFrames(t) {
+		body := frame[:len(frame)-2]
+		got := uint16(frame[len(frame)-2])<<8 | uint16(frame[len(frame)-1])
+		if expected := referenceCRC16(body); got != expected {
+			t.Errorf("Frame %d: %d bytes have CRC-16 0x%04X, expected 0x%04X", i, len(body), got, expected)
+		}
+	}
+}
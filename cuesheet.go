@@ -0,0 +1,365 @@
+package goflac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// cdSampleRate and cdBitsPerSample are the format of CD audio, the only
+// format a cue sheet may be marked as CD-DA for
+const (
+	cdSampleRate    = 44100
+	cdBitsPerSample = 16
+)
+
+// cdFramesPerSecond is the number of CD frames in one second of audio
+const cdFramesPerSecond = 75
+
+// cdLeadIn is the lead-in written for CD cue sheets: two seconds of audio
+const cdLeadIn = 2 * cdSampleRate
+
+// cueSheetTrackLength is the length of a CUESHEET track entry without its
+// index points
+const cueSheetTrackLength = 8 + 1 + 12 + 14 + 1
+
+// Lead-out track numbers, for CD and non-CD cue sheets
+const (
+	cdLeadOutTrack    = 170
+	otherLeadOutTrack = 255
+)
+
+// CueSheet holds the contents of a CUESHEET metadata block
+type CueSheet struct {
+	MediaCatalogNumber string
+	LeadIn             uint64
+	IsCD               bool
+	Tracks             []CueSheetTrack
+}
+
+// CueSheetTrack is a single track of a cue sheet. Offset is in samples from
+// the start of the stream. Title is kept for convenience but the CUESHEET
+// block has no room for it, so it is not written to the stream.
+type CueSheetTrack struct {
+	Offset      uint64
+	Number      uint8
+	ISRC        string
+	Title       string
+	NonAudio    bool
+	PreEmphasis bool
+	Indices     []CueSheetIndex
+}
+
+// CueSheetIndex is an index point of a track. Offset is in samples relative
+// to the track offset.
+type CueSheetIndex struct {
+	Offset uint64
+	Number uint8
+}
+
+// ParseCueSheet reads a textual .cue file into a CueSheet for a stream of
+// the given sample rate and bits per sample. TRACK, INDEX, ISRC, TITLE,
+// FLAGS and CATALOG lines are understood and other commands are ignored.
+// MM:SS:FF timings, where FF counts 1/75 second CD frames, are converted to
+// samples at sampleRate. Each track's offset is its first index point, and
+// its indices are relative to that. The sheet is marked as CD-DA, with a
+// two second lead-in, only for 44100 Hz 16-bit audio.
+func ParseCueSheet(r io.Reader, sampleRate uint32, bitsPerSample uint8) (*CueSheet, error) {
+	if sampleRate == 0 {
+		return nil, errors.New("sample rate must be positive")
+	}
+	cs := &CueSheet{}
+	if sampleRate == cdSampleRate && bitsPerSample == cdBitsPerSample {
+		cs.IsCD = true
+		cs.LeadIn = cdLeadIn
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields, err := splitCueLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("cue sheet line %d: %w", lineNumber, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if err := cs.applyCueCommand(fields, sampleRate); err != nil {
+			return nil, fmt.Errorf("cue sheet line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cs.Tracks) == 0 {
+		return nil, errors.New("cue sheet has no tracks")
+	}
+	for _, track := range cs.Tracks {
+		if len(track.Indices) == 0 {
+			return nil, fmt.Errorf("cue sheet track %d has no INDEX", track.Number)
+		}
+	}
+	return cs, nil
+}
+
+// applyCueCommand applies a single cue sheet command, converting times to
+// samples at sampleRate
+func (cs *CueSheet) applyCueCommand(fields []string, sampleRate uint32) error {
+	var track *CueSheetTrack
+	if len(cs.Tracks) > 0 {
+		track = &cs.Tracks[len(cs.Tracks)-1]
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "CATALOG":
+		if len(fields) != 2 {
+			return errors.New("CATALOG expects a media catalog number")
+		}
+		cs.MediaCatalogNumber = fields[1]
+
+	case "TRACK":
+		if len(fields) != 3 {
+			return errors.New("TRACK expects a number and a type")
+		}
+		number, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil || number == 0 || number >= cdLeadOutTrack {
+			return fmt.Errorf("invalid track number %q", fields[1])
+		}
+		cs.Tracks = append(cs.Tracks, CueSheetTrack{
+			Number:   uint8(number),
+			NonAudio: !strings.EqualFold(fields[2], "AUDIO"),
+		})
+
+	case "INDEX":
+		if track == nil {
+			return errors.New("INDEX before TRACK")
+		}
+		if len(fields) != 3 {
+			return errors.New("INDEX expects a number and a time")
+		}
+		number, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil || number > 99 {
+			return fmt.Errorf("invalid index number %q", fields[1])
+		}
+		offset, err := parseCueTime(fields[2], sampleRate)
+		if err != nil {
+			return err
+		}
+		if len(track.Indices) == 0 {
+			track.Offset = offset
+		}
+		if offset < track.Offset {
+			return errors.New("INDEX times must increase within a track")
+		}
+		track.Indices = append(track.Indices, CueSheetIndex{
+			Offset: offset - track.Offset,
+			Number: uint8(number),
+		})
+
+	case "ISRC":
+		if track == nil {
+			return errors.New("ISRC before TRACK")
+		}
+		if len(fields) != 2 || len(fields[1]) != 12 {
+			return errors.New("ISRC expects a 12 character code")
+		}
+		track.ISRC = fields[1]
+
+	case "TITLE":
+		if track != nil && len(fields) == 2 {
+			track.Title = fields[1]
+		}
+
+	case "FLAGS":
+		if track == nil {
+			return errors.New("FLAGS before TRACK")
+		}
+		for _, flag := range fields[1:] {
+			if strings.EqualFold(flag, "PRE") {
+				track.PreEmphasis = true
+			}
+		}
+	}
+	return nil
+}
+
+// parseCueTime converts an MM:SS:FF cue sheet time to a sample offset at
+// sampleRate, rounding down where a CD frame is not a whole number of
+// samples
+func parseCueTime(s string, sampleRate uint32) (uint64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid cue time %q", s)
+	}
+	var values [3]uint64
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cue time %q", s)
+		}
+		values[i] = v
+	}
+	minutes, seconds, frames := values[0], values[1], values[2]
+	if seconds >= 60 || frames >= cdFramesPerSecond {
+		return 0, fmt.Errorf("invalid cue time %q", s)
+	}
+
+	cdFrames := (minutes*60+seconds)*cdFramesPerSecond + frames
+	return cdFrames * uint64(sampleRate) / cdFramesPerSecond, nil
+}
+
+// splitCueLine splits a cue sheet line into whitespace separated fields,
+// keeping double quoted strings together
+func splitCueLine(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated quoted string")
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t\r")
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+// marshal serializes the CUESHEET block body, appending a lead-out track at
+// totalSamples
+func (cs *CueSheet) marshal(totalSamples uint64) []byte {
+	var buf []byte
+
+	// Media catalog number (128 bytes, NUL padded)
+	var catalog [128]byte
+	copy(catalog[:], cs.MediaCatalogNumber)
+	buf = append(buf, catalog[:]...)
+
+	// Lead-in samples (64 bits)
+	buf = binary.BigEndian.AppendUint64(buf, cs.LeadIn)
+
+	// CD flag (1 bit) + reserved (7 + 258*8 bits)
+	var flags [259]byte
+	if cs.IsCD {
+		flags[0] = 0x80
+	}
+	buf = append(buf, flags[:]...)
+
+	leadOut := CueSheetTrack{Offset: totalSamples, Number: otherLeadOutTrack}
+	if cs.IsCD {
+		leadOut.Number = cdLeadOutTrack
+	}
+
+	// Number of tracks (8 bits), including the lead-out
+	buf = append(buf, byte(len(cs.Tracks)+1))
+	for _, track := range append(cs.Tracks[:len(cs.Tracks):len(cs.Tracks)], leadOut) {
+		buf = binary.BigEndian.AppendUint64(buf, track.Offset)
+		buf = append(buf, track.Number)
+
+		var isrc [12]byte
+		copy(isrc[:], track.ISRC)
+		buf = append(buf, isrc[:]...)
+
+		// Track type (1 bit) + pre-emphasis (1 bit) + reserved (6 + 13*8 bits)
+		var trackFlags [14]byte
+		if track.NonAudio {
+			trackFlags[0] |= 0x80
+		}
+		if track.PreEmphasis {
+			trackFlags[0] |= 0x40
+		}
+		buf = append(buf, trackFlags[:]...)
+
+		buf = append(buf, byte(len(track.Indices)))
+		for _, index := range track.Indices {
+			buf = binary.BigEndian.AppendUint64(buf, index.Offset)
+			buf = append(buf, index.Number, 0, 0, 0)
+		}
+	}
+	return buf
+}
+
+// validate checks that the cue sheet fits in a CUESHEET block
+func (cs *CueSheet) validate() error {
+	if len(cs.MediaCatalogNumber) > 128 {
+		return errors.New("media catalog number longer than 128 bytes")
+	}
+	if len(cs.Tracks) > 99 {
+		return errors.New("cue sheet has more than 99 tracks")
+	}
+	for _, track := range cs.Tracks {
+		if track.Number == 0 || track.Number >= cdLeadOutTrack {
+			return fmt.Errorf("invalid track number %d", track.Number)
+		}
+		if len(track.ISRC) != 0 && len(track.ISRC) != 12 {
+			return errors.New("ISRC must be 12 characters")
+		}
+		if len(track.Indices) == 0 || len(track.Indices) > 100 {
+			return fmt.Errorf("track %d must have between 1 and 100 index points", track.Number)
+		}
+	}
+	return nil
+}
+
+// parseCueSheet parses a CUESHEET block body. The lead-out track is kept
+// as the final entry of Tracks.
+func parseCueSheet(data []byte) (*CueSheet, error) {
+	truncated := errors.New("truncated CUESHEET block")
+	const headerLength = 128 + 8 + 259 + 1
+	if len(data) < headerLength {
+		return nil, truncated
+	}
+
+	cs := &CueSheet{
+		MediaCatalogNumber: strings.TrimRight(string(data[:128]), "\x00"),
+		LeadIn:             binary.BigEndian.Uint64(data[128:136]),
+		IsCD:               data[136]&0x80 != 0,
+	}
+	count := int(data[headerLength-1])
+	data = data[headerLength:]
+
+	const indexLength = 8 + 1 + 3
+	for i := 0; i < count; i++ {
+		if len(data) < cueSheetTrackLength {
+			return nil, truncated
+		}
+		track := CueSheetTrack{
+			Offset:      binary.BigEndian.Uint64(data[0:8]),
+			Number:      data[8],
+			ISRC:        strings.TrimRight(string(data[9:21]), "\x00"),
+			NonAudio:    data[21]&0x80 != 0,
+			PreEmphasis: data[21]&0x40 != 0,
+		}
+		indices := int(data[cueSheetTrackLength-1])
+		data = data[cueSheetTrackLength:]
+
+		for j := 0; j < indices; j++ {
+			if len(data) < indexLength {
+				return nil, truncated
+			}
+			track.Indices = append(track.Indices, CueSheetIndex{
+				Offset: binary.BigEndian.Uint64(data[0:8]),
+				Number: data[8],
+			})
+			data = data[indexLength:]
+		}
+		cs.Tracks = append(cs.Tracks, track)
+	}
+	return cs, nil
+}
@@ -0,0 +1,244 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testCueSheet = `REM GENRE Rock
+CATALOG 1234567890123
+PERFORMER "Some Band"
+TITLE "Some Album"
+FILE "album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "First Song"
+    ISRC USABC1234567
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Second Song"
+    FLAGS PRE
+    INDEX 00 00:01:50
+    INDEX 01 00:02:00
+`
+
+func TestParseCueSheet(t *testing.T) {
+	cs, err := ParseCueSheet(strings.NewReader(testCueSheet), 44100, 16)
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+
+	if cs.MediaCatalogNumber != "1234567890123" {
+		t.Errorf("Expected catalog number, got %q", cs.MediaCatalogNumber)
+	}
+	if len(cs.Tracks) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(cs.Tracks))
+	}
+
+	first := cs.Tracks[0]
+	if first.Number != 1 || first.Title != "First Song" || first.ISRC != "USABC1234567" || first.Offset != 0 {
+		t.Errorf("Unexpected first track: %+v", first)
+	}
+
+	// 00:01:50 is 125 CD frames of 588 samples each
+	second := cs.Tracks[1]
+	if second.Offset != 125*588 || !second.PreEmphasis {
+		t.Errorf("Unexpected second track: %+v", second)
+	}
+	expected := []CueSheetIndex{{Offset: 0, Number: 0}, {Offset: 25 * 588, Number: 1}}
+	if len(second.Indices) != 2 || second.Indices[0] != expected[0] || second.Indices[1] != expected[1] {
+		t.Errorf("Expected indices %v, got %v", expected, second.Indices)
+	}
+}
+
+func TestParseCueSheet_SampleRate(t *testing.T) {
+	for _, tc := range []struct {
+		sampleRate    uint32
+		bitsPerSample uint8
+		frameSamples  uint64
+		isCD          bool
+	}{
+		{44100, 16, 588, true},
+		{44100, 24, 588, false},
+		{48000, 16, 640, false},
+		{96000, 24, 1280, false},
+	} {
+		cs, err := ParseCueSheet(strings.NewReader(testCueSheet), tc.sampleRate, tc.bitsPerSample)
+		if err != nil {
+			t.Fatalf("Failed to parse cue sheet at %d Hz: %v", tc.sampleRate, err)
+		}
+		if cs.IsCD != tc.isCD {
+			t.Errorf("%d Hz %d-bit: expected IsCD %v", tc.sampleRate, tc.bitsPerSample, tc.isCD)
+		}
+		leadIn := uint64(0)
+		if tc.isCD {
+			leadIn = 2 * 44100
+		}
+		if cs.LeadIn != leadIn {
+			t.Errorf("%d Hz %d-bit: expected lead-in %d, got %d", tc.sampleRate, tc.bitsPerSample, leadIn, cs.LeadIn)
+		}
+
+		// 00:01:50 is 125 CD frames, 00:00:25 of them to index 01
+		second := cs.Tracks[1]
+		if second.Offset != 125*tc.frameSamples || second.Indices[1].Offset != 25*tc.frameSamples {
+			t.Errorf("%d Hz: expected offsets of %d samples per CD frame, got %+v", tc.sampleRate, tc.frameSamples, second)
+		}
+	}
+
+	if _, err := ParseCueSheet(strings.NewReader(testCueSheet), 0, 16); err == nil {
+		t.Error("Expected error for sample rate 0")
+	}
+}
+
+func TestCueSheet_EmbedAndReadBack(t *testing.T) {
+	cs, err := ParseCueSheet(strings.NewReader(testCueSheet), 44100, 16)
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetCueSheet(cs); err != nil {
+		t.Fatalf("Failed to set cue sheet: %v", err)
+	}
+	samples := [][]int32{make([]int32, 3*44100), make([]int32, 3*44100)}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	got := decoder.CueSheet()
+	if got == nil {
+		t.Fatal("Expected a CUESHEET block")
+	}
+	if got.MediaCatalogNumber != cs.MediaCatalogNumber || got.LeadIn != cs.LeadIn || !got.IsCD {
+		t.Errorf("Cue sheet header not preserved: %+v", got)
+	}
+
+	// The lead-out track follows the parsed tracks
+	if len(got.Tracks) != 3 || got.Tracks[2].Number != 170 {
+		t.Fatalf("Expected 2 tracks and a lead-out, got %+v", got.Tracks)
+	}
+	if got.Tracks[2].Offset != 3*44100 {
+		t.Errorf("Expected the lead-out at %d, got %d", 3*44100, got.Tracks[2].Offset)
+	}
+	for i, track := range cs.Tracks {
+		g := got.Tracks[i]
+		if g.Offset != track.Offset || g.Number != track.Number || g.ISRC != track.ISRC ||
+			g.PreEmphasis != track.PreEmphasis || len(g.Indices) != len(track.Indices) {
+			t.Errorf("Track %d not preserved: expected %+v, got %+v", i, track, g)
+			continue
+		}
+		for j := range track.Indices {
+			if g.Indices[j] != track.Indices[j] {
+				t.Errorf("Track %d index %d: expected %v, got %v", i, j, track.Indices[j], g.Indices[j])
+			}
+		}
+	}
+
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestCueSheet_LeadOutStreamed(t *testing.T) {
+	samples := [][]int32{make([]int32, 50000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 1000)
+	}
+
+	// newEncoder returns an encoder with a cue sheet, at 48 kHz so the
+	// lead-out track is numbered 255
+	newEncoder := func(w io.Writer) *Encoder {
+		cs, err := ParseCueSheet(strings.NewReader(testCueSheet), 48000, 16)
+		if err != nil {
+			t.Fatalf("Failed to parse cue sheet: %v", err)
+		}
+		encoder, err := NewEncoder(w, 48000, 1, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetCueSheet(cs); err != nil {
+			t.Fatalf("Failed to set cue sheet: %v", err)
+		}
+		return encoder
+	}
+
+	for _, tc := range []struct {
+		name   string
+		encode func(e *Encoder) error
+	}{
+		{"WriteSamples", func(e *Encoder) error {
+			return e.WriteSamples(samples)
+		}},
+		{"EncodeFrame", func(e *Encoder) error {
+			if err := e.WriteStreamInfo(); err != nil {
+				return err
+			}
+			for i := 0; i*4096 < len(samples[0]); i++ {
+				block := [][]int32{samples[0][i*4096 : min((i+1)*4096, len(samples[0]))]}
+				if err := e.EncodeFrame(block, uint64(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	} {
+		// A seekable writer has the lead-out completed at Close
+		out := &memSeeker{}
+		encoder := newEncoder(out)
+		if err := tc.encode(encoder); err != nil {
+			t.Fatalf("%s: Failed to encode: %v", tc.name, err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatalf("%s: Failed to close: %v", tc.name, err)
+		}
+		decoder, err := NewDecoder(bytes.NewReader(out.data))
+		if err != nil {
+			t.Fatalf("%s: Failed to create decoder: %v", tc.name, err)
+		}
+		tracks := decoder.CueSheet().Tracks
+		leadOut := tracks[len(tracks)-1]
+		if leadOut.Number != 255 || leadOut.Offset != uint64(len(samples[0])) {
+			t.Errorf("%s: expected lead-out 255 at %d, got %d at %d",
+				tc.name, len(samples[0]), leadOut.Number, leadOut.Offset)
+		}
+
+		// Without seeking, the length is unknown when the header is
+		// written, so the audio is refused
+		encoder = newEncoder(&bytes.Buffer{})
+		err = tc.encode(encoder)
+		if err == nil {
+			err = encoder.Close()
+		}
+		if err == nil {
+			t.Errorf("%s: expected error for a cue sheet on an unseekable stream", tc.name)
+		}
+	}
+}
+
+func TestParseCueSheet_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"no tracks":      "FILE \"a.wav\" WAVE\n",
+		"index first":    "INDEX 01 00:00:00\n",
+		"bad time":       "TRACK 01 AUDIO\nINDEX 01 00:61:00\n",
+		"no index":       "TRACK 01 AUDIO\n",
+		"unterminated":   "TRACK 01 AUDIO\nTITLE \"oops\nINDEX 01 00:00:00\n",
+		"short ISRC":     "TRACK 01 AUDIO\nISRC ABC\nINDEX 01 00:00:00\n",
+		"invalid number": "TRACK 00 AUDIO\nINDEX 01 00:00:00\n",
+	}
+	for name, input := range cases {
+		if _, err := ParseCueSheet(strings.NewReader(input), 44100, 16); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package goflac
+
+// dcRemover subtracts the mean of each channel from every block
+type dcRemover struct {
+	report func(frame uint64, channel int, offset int32)
+	block  [][]int32
+}
+
+// WithDCRemoval removes any DC offset before encoding by subtracting the
+// mean of each channel from every block. This alters the audio: besides
+// the offset itself, the very lowest frequencies within a block are
+// attenuated, and results are clipped to the sample range. The decoded
+// stream, its MD5 signature included, is the DC-removed audio.
+func WithDCRemoval(enabled bool) Option {
+	return func(e *Encoder) error {
+		if !enabled {
+			e.dc = nil
+			return nil
+		}
+		if e.dc == nil {
+			e.dc = &dcRemover{}
+		}
+		return nil
+	}
+}
+
+// WithDCOffsetReport calls fn with the offset removed from each channel of
+// every frame. It enables DC removal if it is not already enabled.
+func WithDCOffsetReport(fn func(frame uint64, channel int, offset int32)) Option {
+	return func(e *Encoder) error {
+		if e.dc == nil {
+			e.dc = &dcRemover{}
+		}
+		e.dc.report = fn
+		return nil
+	}
+}
+
+// apply returns a copy of samples with each channel's mean removed. The
+// copy uses the remover's scratch space.
+func (r *dcRemover) apply(samples [][]int32, frameNumber uint64, bitsPerSample uint8) [][]int32 {
+	maxValue := int64(1)<<(bitsPerSample-1) - 1
+	minValue := -maxValue - 1
+
+	if cap(r.block) < len(samples) {
+		r.block = make([][]int32, len(samples))
+	}
+	r.block = r.block[:len(samples)]
+
+	for ch, channel := range samples {
+		if cap(r.block[ch]) < len(channel) {
+			r.block[ch] = make([]int32, len(channel))
+		}
+		out := r.block[ch][:len(channel)]
+		r.block[ch] = out
+
+		var sum int64
+		for _, v := range channel {
+			sum += int64(v)
+		}
+		var offset int64
+		if len(channel) > 0 {
+			offset = sum / int64(len(channel))
+		}
+
+		for i, v := range channel {
+			out[i] = int32(min(maxValue, max(minValue, int64(v)-offset)))
+		}
+		if r.report != nil {
+			r.report(frameNumber, ch, int32(offset))
+		}
+	}
+	return r.block
+}
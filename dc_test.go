@@ -0,0 +1,58 @@
+package goflac
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEncoder_DCRemoval(t *testing.T) {
+	const dc = 3000
+	samples := [][]int32{make([]int32, 10*4096)}
+	for i := range samples[0] {
+		samples[0][i] = int32(10000*math.Sin(2*math.Pi*441*float64(i)/44100)) + dc
+	}
+	original := append([]int32(nil), samples[0]...)
+
+	var offsets []int32
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16,
+		WithDCRemoval(true),
+		WithDCOffsetReport(func(frame uint64, channel int, offset int32) {
+			offsets = append(offsets, offset)
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	// The caller's samples are left alone
+	assertSamplesEqual(t, [][]int32{original}, samples)
+
+	if len(offsets) != 10 {
+		t.Fatalf("Expected an offset for each of 10 frames, got %d", len(offsets))
+	}
+	for i, offset := range offsets {
+		if offset < dc-100 || offset > dc+100 {
+			t.Errorf("Frame %d: expected an offset near %d, got %d", i, dc, offset)
+		}
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	var sum int64
+	for _, v := range decoded[0] {
+		sum += int64(v)
+	}
+	if mean := float64(sum) / float64(len(decoded[0])); math.Abs(mean) > 10 {
+		t.Errorf("Expected the decoded DC component near zero, got %.1f", mean)
+	}
+}
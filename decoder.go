@@ -0,0 +1,926 @@
+package goflac
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+)
+
+// Decoder reads a FLAC stream
+type Decoder struct {
+	r     *bufio.Reader
+	info  StreamInfo
+	frame frameRecorder
+
+	vendor     string
+	comments   []VorbisComment
+	cueSheet   *CueSheet
+	seekPoints []SeekPoint
+
+	// streamInfoOffset is the position of the STREAMINFO block body
+	streamInfoOffset int64
+
+	blockingStrategy BlockingStrategy
+
+	// md5 accumulates the signature of the decoded audio; it is only
+	// complete if every frame went through ReadFrame
+	md5        hash.Hash
+	md5Buf     []byte
+	md5Skipped bool
+
+	// Scratch space reused across frames; the slices returned by ReadFrame
+	// alias samples
+	samples   [][]int32
+	residuals []int64
+
+	// header, maxPartitionOrder and maxLPCOrder describe the last frame
+	// read, for checks such as CheckSubset
+	header            frameHeader
+	maxPartitionOrder int
+	maxLPCOrder       int
+
+	// Limits enforced on frame headers before any sample buffers are
+	// allocated, to defend against hostile streams
+	maxBlockSize int
+	maxChannels  int
+
+	// checkFrameNumbers enables WithFrameNumberCheck; nextNumber is the
+	// frame or sample number the next frame should code
+	checkFrameNumbers bool
+	nextNumber        uint64
+}
+
+// DecoderOption configures optional Decoder behavior
+type DecoderOption func(*Decoder) error
+
+// WithMaxBlockSize limits the block size a frame header may declare. The
+// default is 65535, the largest block size the FLAC format allows.
+func WithMaxBlockSize(n int) DecoderOption {
+	return func(d *Decoder) error {
+		if n < 1 || n > 65535 {
+			return errors.New("max block size must be between 1 and 65535")
+		}
+		d.maxBlockSize = n
+		return nil
+	}
+}
+
+// WithMaxChannels limits the number of channels a frame header may declare.
+// The default is 8, the most channels the FLAC format allows.
+func WithMaxChannels(n int) DecoderOption {
+	return func(d *Decoder) error {
+		if n < 1 || n > 8 {
+			return errors.New("max channels must be between 1 and 8")
+		}
+		d.maxChannels = n
+		return nil
+	}
+}
+
+// frameRecorder is a byte source that keeps a copy of every byte read for
+// the current frame, so the CRCs can be checked and raw frames returned
+type frameRecorder struct {
+	r   io.ByteReader
+	buf []byte
+}
+
+// ReadByte reads and records the next byte
+func (fr *frameRecorder) ReadByte() (byte, error) {
+	b, err := fr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	fr.buf = append(fr.buf, b)
+	return b, nil
+}
+
+// reset starts recording a new frame
+func (fr *frameRecorder) reset() {
+	fr.buf = fr.buf[:0]
+}
+
+// NewDecoder creates a new FLAC decoder and reads the stream metadata. As a
+// compatibility accommodation for files mangled by taggers, an ID3v2 tag
+// before the fLaC signature is skipped.
+func NewDecoder(r io.Reader, opts ...DecoderOption) (*Decoder, error) {
+	d := &Decoder{
+		r:            bufio.NewReader(r),
+		md5:          md5.New(),
+		maxBlockSize: 65535,
+		maxChannels:  8,
+	}
+	d.frame.r = d.r
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DecodeReader decodes a whole FLAC stream, returning its samples as
+// [channel][sample] together with its STREAMINFO
+func DecodeReader(r io.Reader, opts ...DecoderOption) ([][]int32, StreamInfo, error) {
+	d, err := NewDecoder(r, opts...)
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	samples, err := d.DecodeAll()
+	if err != nil {
+		return nil, StreamInfo{}, err
+	}
+	return samples, d.StreamInfo(), nil
+}
+
+// readHeader reads the FLAC signature and all metadata blocks
+func (d *Decoder) readHeader() error {
+	signature := make([]byte, 4)
+	if _, err := io.ReadFull(d.r, signature); err != nil {
+		return err
+	}
+
+	// Some taggers wrongly prepend an ID3v2 tag to FLAC files. As a
+	// compatibility accommodation, skip it and look for the signature after.
+	offset := int64(0)
+	if string(signature[:3]) == "ID3" {
+		skipped, err := d.skipID3v2(signature)
+		if err != nil {
+			return err
+		}
+		offset += skipped
+		if _, err := io.ReadFull(d.r, signature); err != nil {
+			return err
+		}
+	}
+	if string(signature) != "fLaC" {
+		return errors.New("not a valid FLAC stream: missing fLaC signature")
+	}
+
+	seenStreamInfo := false
+	offset += int64(len(signature))
+	for {
+		blockHeader := make([]byte, 4)
+		if _, err := io.ReadFull(d.r, blockHeader); err != nil {
+			return err
+		}
+
+		last := blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7F
+		length := uint32(blockHeader[1])<<16 | uint32(blockHeader[2])<<8 | uint32(blockHeader[3])
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(d.r, data); err != nil {
+			return err
+		}
+		offset += int64(len(blockHeader))
+
+		if blockType == blockTypeStreamInfo {
+			d.streamInfoOffset = offset
+			info, err := parseStreamInfo(data)
+			if err != nil {
+				return err
+			}
+			d.info = info
+			seenStreamInfo = true
+		} else if !seenStreamInfo {
+			return errors.New("not a valid FLAC stream: STREAMINFO must be the first metadata block")
+		} else if blockType == blockTypeSeekTable {
+			seekPoints, err := parseSeekTable(data)
+			if err != nil {
+				return err
+			}
+			d.seekPoints = seekPoints
+		} else if blockType == blockTypeVorbisComment {
+			vendor, comments, err := parseVorbisComments(data)
+			if err != nil {
+				return err
+			}
+			d.vendor = vendor
+			d.comments = comments
+		} else if blockType == blockTypeCueSheet {
+			cueSheet, err := parseCueSheet(data)
+			if err != nil {
+				return err
+			}
+			d.cueSheet = cueSheet
+		}
+
+		offset += int64(length)
+		if last {
+			break
+		}
+	}
+
+	if !seenStreamInfo {
+		return errors.New("not a valid FLAC stream: missing STREAMINFO")
+	}
+
+	// The blocking strategy bit of the first frame header is authoritative;
+	// without any frames, STREAMINFO's block size bounds are the best hint
+	d.blockingStrategy = BlockingStrategyFixed
+	if peek, err := d.r.Peek(2); err == nil && peek[0] == 0xFF && peek[1]&0xFE == 0xF8 {
+		if peek[1]&0x01 != 0 {
+			d.blockingStrategy = BlockingStrategyVariable
+		}
+	} else if d.info.MinBlockSize != d.info.MaxBlockSize {
+		d.blockingStrategy = BlockingStrategyVariable
+	}
+	return nil
+}
+
+// skipID3v2 skips an ID3v2 tag whose first four bytes have already been
+// read into start, returning the tag's total length
+func (d *Decoder) skipID3v2(start []byte) (int64, error) {
+	// The 10-byte header: "ID3", version (2 bytes), flags, then the tag
+	// size as a 28-bit synchsafe integer excluding header and footer
+	header := make([]byte, 10)
+	copy(header, start)
+	if _, err := io.ReadFull(d.r, header[len(start):]); err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, b := range header[6:10] {
+		if b&0x80 != 0 {
+			return 0, errors.New("invalid ID3v2 tag size")
+		}
+		size = size<<7 | int64(b)
+	}
+	if header[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+
+	if _, err := d.r.Discard(int(size)); err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return int64(len(header)) + size, nil
+}
+
+// StreamInfo returns the parsed STREAMINFO metadata block
+func (d *Decoder) StreamInfo() StreamInfo {
+	return d.info
+}
+
+// Vendor returns the vendor string of the VORBIS_COMMENT block
+func (d *Decoder) Vendor() string {
+	return d.vendor
+}
+
+// Comments returns the VORBIS_COMMENT tags in stream order
+func (d *Decoder) Comments() []VorbisComment {
+	return d.comments
+}
+
+// SeekPoints returns the seek points of the SEEKTABLE block, without
+// placeholders, or nil if the stream has none
+func (d *Decoder) SeekPoints() []SeekPoint {
+	return d.seekPoints
+}
+
+// CueSheet returns the CUESHEET block, including its lead-out track, or
+// nil if the stream has none
+func (d *Decoder) CueSheet() *CueSheet {
+	return d.cueSheet
+}
+
+// SampleRate returns the sample rate
+func (d *Decoder) SampleRate() uint32 {
+	return d.info.SampleRate
+}
+
+// Channels returns the number of channels
+func (d *Decoder) Channels() uint8 {
+	return d.info.Channels
+}
+
+// BitsPerSample returns the bits per sample
+func (d *Decoder) BitsPerSample() uint8 {
+	return d.info.BitsPerSample
+}
+
+// TotalSamples returns the total number of inter-channel samples declared
+// in STREAMINFO, or 0 if unknown
+func (d *Decoder) TotalSamples() uint64 {
+	return d.info.TotalSamples
+}
+
+// BlockingStrategy is the blocking strategy of a FLAC stream
+type BlockingStrategy int
+
+const (
+	// BlockingStrategyFixed streams use one block size for every frame but
+	// the last, and number frames by index
+	BlockingStrategyFixed BlockingStrategy = iota
+	// BlockingStrategyVariable streams may change block size from frame to
+	// frame, and number frames by their first sample
+	BlockingStrategyVariable
+)
+
+// BlockingStrategy returns whether the stream is fixed or variable
+// blocksize, as declared by its first frame header. It is known as soon as
+// the decoder is created, without decoding any audio.
+func (d *Decoder) BlockingStrategy() BlockingStrategy {
+	return d.blockingStrategy
+}
+
+// MD5 returns the MD5 signature of the unencoded audio declared in STREAMINFO
+func (d *Decoder) MD5() [16]byte {
+	return d.info.MD5
+}
+
+// frameHeader holds the fields of a parsed frame header
+type frameHeader struct {
+	variableBlockSize bool
+	blockSize         int
+	sampleRate        uint32
+	channelAssignment uint8
+	channels          int
+	bitsPerSample     uint8
+	number            uint64 // frame number, or sample number if variable
+
+	// The coded sample rate and sample size; 0 defers to STREAMINFO
+	sampleRateCode uint8
+	sampleSizeCode uint8
+}
+
+// ReadFrame decodes the next frame, returning its samples as [channel][sample].
+// It returns io.EOF when there are no more frames. The returned slices are
+// reused by the next call to ReadFrame, so they are only valid until then;
+// use ReadFrameCopy to keep a frame.
+func (d *Decoder) ReadFrame() ([][]int32, error) {
+	if _, err := d.r.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+
+	d.frame.reset()
+	header, err := d.readFrameHeader(&d.frame)
+	if err != nil {
+		return nil, err
+	}
+	d.header = header
+	d.maxPartitionOrder = 0
+	d.maxLPCOrder = 0
+
+	br := newBitReader(&d.frame)
+
+	// The side channel of a stereo decorrelated frame has an extra bit
+	var sideBits [2]uint8
+	switch header.channelAssignment {
+	case channelLeftSide, channelMidSide:
+		sideBits[1] = 1
+	case channelRightSide:
+		sideBits[0] = 1
+	}
+	if sideBits != [2]uint8{} && header.bitsPerSample >= 32 {
+		return nil, errors.New("stereo decorrelation of 32-bit samples is not supported")
+	}
+
+	samples := d.frameBuffers(header.channels, header.blockSize)
+	for ch := range samples {
+		bitsPerSample := header.bitsPerSample
+		if ch < len(sideBits) {
+			bitsPerSample += sideBits[ch]
+		}
+		if err := d.readSubframe(br, samples[ch], bitsPerSample); err != nil {
+			return nil, err
+		}
+	}
+	restoreStereo(samples, header.channelAssignment)
+
+	// Zero padding to byte boundary, then frame CRC-16
+	br.alignToByte()
+	crcOffset := len(d.frame.buf)
+	crc16, err := br.readBits(16)
+	if err != nil {
+		return nil, err
+	}
+	if uint16(crc16) != calculateCRC16(d.frame.buf[:crcOffset]) {
+		return nil, errors.New("frame CRC-16 mismatch")
+	}
+
+	d.md5Buf = writeMD5Samples(d.md5, samples, header.bitsPerSample, d.md5Buf)
+	if d.checkFrameNumbers {
+		if err := d.checkFrameNumber(); err != nil {
+			return nil, err
+		}
+	}
+	return samples, nil
+}
+
+// Frames returns an iterator over the remaining frames, each as
+// [channel][sample]. As with ReadFrame, the samples are only valid until the
+// next iteration. The sequence ends after the last frame; a decoding error
+// is yielded once with nil samples and also ends it.
+func (d *Decoder) Frames() iter.Seq2[[][]int32, error] {
+	return func(yield func([][]int32, error) bool) {
+		for {
+			samples, err := d.ReadFrame()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(samples, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ReadFrameCopy is like ReadFrame but returns freshly allocated slices
+// that remain valid after further reads
+func (d *Decoder) ReadFrameCopy() ([][]int32, error) {
+	frame, err := d.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([][]int32, len(frame))
+	for ch := range frame {
+		samples[ch] = append([]int32(nil), frame[ch]...)
+	}
+	return samples, nil
+}
+
+// frameBuffers returns the decoder's per-channel sample buffers resliced
+// to the frame size, growing them as needed
+func (d *Decoder) frameBuffers(channels, blockSize int) [][]int32 {
+	if cap(d.samples) < channels {
+		grown := make([][]int32, channels)
+		copy(grown, d.samples[:cap(d.samples)])
+		d.samples = grown
+	}
+	d.samples = d.samples[:channels]
+	for ch := range d.samples {
+		if cap(d.samples[ch]) < blockSize {
+			d.samples[ch] = make([]int32, blockSize)
+		}
+		d.samples[ch] = d.samples[ch][:blockSize]
+	}
+	return d.samples
+}
+
+// restoreStereo undoes stereo decorrelation in place, leaving left and
+// right in samples[0] and samples[1]
+func restoreStereo(samples [][]int32, channelAssignment uint8) {
+	switch channelAssignment {
+	case channelLeftSide:
+		left, side := samples[0], samples[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case channelRightSide:
+		side, right := samples[0], samples[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case channelMidSide:
+		mid, side := samples[0], samples[1]
+		for i := range side {
+			// Restore the low bit of L+R dropped from mid
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+}
+
+// DecodeAll decodes all remaining frames, returning the samples as
+// [channel][sample]. If STREAMINFO declares a total number of samples, a
+// stream that decodes to a different length is reported as an error.
+func (d *Decoder) DecodeAll() ([][]int32, error) {
+	samples := make([][]int32, d.info.Channels)
+	for {
+		frame, err := d.ReadFrame()
+		if err == io.EOF {
+			// A nonzero total in STREAMINFO catches a truncated stream
+			decoded := uint64(len(samples[0]))
+			if d.info.TotalSamples != 0 && decoded != d.info.TotalSamples {
+				return nil, fmt.Errorf("expected %d samples, decoded %d", d.info.TotalSamples, decoded)
+			}
+			if d.info.MD5 != [16]byte{} {
+				if err := d.VerifyMD5(); err != nil {
+					return nil, err
+				}
+			}
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) != len(samples) {
+			return nil, errors.New("frame channel count does not match STREAMINFO")
+		}
+		for ch := range frame {
+			samples[ch] = append(samples[ch], frame[ch]...)
+		}
+	}
+}
+
+// VerifyMD5 checks the MD5 signature in STREAMINFO against the audio
+// decoded so far. It is meaningful once every frame has been read with
+// ReadFrame.
+func (d *Decoder) VerifyMD5() error {
+	if d.info.MD5 == [16]byte{} {
+		return errors.New("stream has no MD5 signature")
+	}
+	if d.md5Skipped {
+		return errors.New("cannot verify MD5: frames were read without decoding")
+	}
+
+	var sum [16]byte
+	copy(sum[:], d.md5.Sum(nil))
+	if sum != d.info.MD5 {
+		return errors.New("MD5 signature mismatch")
+	}
+	return nil
+}
+
+// NextRawFrame returns the bytes of the next frame without decoding its
+// audio, along with the number of inter-channel samples it holds. The end
+// of the frame is found by scanning for the next frame sync code at which
+// the running CRC-16 checks out. It returns io.EOF when there are no more
+// frames.
+func (d *Decoder) NextRawFrame() ([]byte, int, error) {
+	if _, err := d.r.Peek(1); err == io.EOF {
+		return nil, 0, io.EOF
+	}
+
+	d.md5Skipped = true
+	d.frame.reset()
+	header, err := d.readFrameHeader(&d.frame)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	crc := calculateCRC16(d.frame.buf)
+	for {
+		// The CRC-16 of a whole frame, footer included, is zero
+		if crc == 0 && d.atFrameBoundary(header.variableBlockSize) {
+			break
+		}
+
+		b, err := d.frame.ReadByte()
+		if err == io.EOF {
+			if crc != 0 {
+				return nil, 0, errors.New("frame CRC-16 mismatch")
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		crc = updateCRC16(crc, []byte{b})
+	}
+
+	frame := make([]byte, len(d.frame.buf))
+	copy(frame, d.frame.buf)
+	return frame, header.blockSize, nil
+}
+
+// atFrameBoundary reports whether the unread input starts with a valid
+// frame header of the given blocking strategy
+func (d *Decoder) atFrameBoundary(variableBlockSize bool) bool {
+	// A frame header is at most 16 bytes long
+	peek, _ := d.r.Peek(16)
+	if len(peek) < 2 || peek[0] != 0xFF {
+		return false
+	}
+	if variableBlockSize && peek[1] != 0xF9 || !variableBlockSize && peek[1] != 0xF8 {
+		return false
+	}
+
+	// Parse the candidate header from the peeked bytes so nothing is consumed
+	_, err := d.readFrameHeader(&frameRecorder{r: bytes.NewReader(peek)})
+	return err == nil
+}
+
+// readFrameHeader parses a frame header from rec and checks its CRC-8
+func (d *Decoder) readFrameHeader(rec *frameRecorder) (frameHeader, error) {
+	var h frameHeader
+	br := newBitReader(rec)
+
+	// Sync code (14 bits) + reserved (1 bit) + blocking strategy (1 bit)
+	sync, err := br.readBits(16)
+	if err != nil {
+		return h, err
+	}
+	if sync&0xFFFE != 0xFFF8 {
+		return h, errors.New("frame sync code not found")
+	}
+	h.variableBlockSize = sync&0x01 != 0
+
+	codes, err := br.readBits(16)
+	if err != nil {
+		return h, err
+	}
+	blockSizeCode := uint8(codes >> 12)
+	sampleRateCode := uint8(codes>>8) & 0x0F
+	h.channelAssignment = uint8(codes>>4) & 0x0F
+	sampleSizeCode := uint8(codes>>1) & 0x07
+	h.sampleRateCode = sampleRateCode
+	h.sampleSizeCode = sampleSizeCode
+	if codes&0x01 != 0 {
+		return h, errors.New("reserved frame header bit is set")
+	}
+
+	// Channel assignment
+	switch {
+	case h.channelAssignment < channelLeftSide:
+		h.channels = int(h.channelAssignment) + 1
+	case h.channelAssignment <= channelMidSide:
+		h.channels = 2
+	default:
+		return h, fmt.Errorf("unsupported channel assignment %d", h.channelAssignment)
+	}
+
+	// Sample size
+	switch sampleSizeCode {
+	case 0x00:
+		h.bitsPerSample = d.info.BitsPerSample
+	case 0x01:
+		h.bitsPerSample = 8
+	case 0x02:
+		h.bitsPerSample = 12
+	case 0x04:
+		h.bitsPerSample = 16
+	case 0x05:
+		h.bitsPerSample = 20
+	case 0x06:
+		h.bitsPerSample = 24
+	case 0x07:
+		h.bitsPerSample = 32
+	default:
+		// 0b011 is reserved
+		return h, fmt.Errorf("reserved sample size code 0b%03b", sampleSizeCode)
+	}
+
+	// Frame or sample number (UTF-8 coded)
+	h.number, err = br.readUTF8()
+	if err != nil {
+		return h, err
+	}
+	if err := validateCodedNumber(h.number, h.variableBlockSize); err != nil {
+		return h, err
+	}
+
+	// Block size
+	switch {
+	case blockSizeCode == 0x00:
+		return h, errors.New("reserved block size code")
+	case blockSizeCode == 0x01:
+		h.blockSize = 192
+	case blockSizeCode <= 0x05:
+		h.blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 0x06:
+		v, err := br.readBits(8)
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(v) + 1
+	case blockSizeCode == 0x07:
+		v, err := br.readBits(16)
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(v) + 1
+	default:
+		h.blockSize = 256 << (blockSizeCode - 8)
+	}
+
+	// Sample rate
+	switch sampleRateCode {
+	case 0x00:
+		h.sampleRate = d.info.SampleRate
+	case 0x0C:
+		v, err := br.readBits(8)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = uint32(v) * 1000
+	case 0x0D:
+		v, err := br.readBits(16)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = uint32(v)
+	case 0x0E:
+		v, err := br.readBits(16)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = uint32(v) * 10
+	case 0x0F:
+		return h, errors.New("invalid sample rate code")
+	default:
+		h.sampleRate = sampleRateTable[sampleRateCode]
+	}
+
+	// Header CRC-8 covers every header byte before it
+	crcOffset := len(rec.buf)
+	crc8, err := br.readBits(8)
+	if err != nil {
+		return h, err
+	}
+	if uint8(crc8) != calculateCRC8(rec.buf[:crcOffset]) {
+		return h, errors.New("frame header CRC-8 mismatch")
+	}
+
+	if h.blockSize > d.maxBlockSize {
+		return h, fmt.Errorf("frame block size %d exceeds limit of %d", h.blockSize, d.maxBlockSize)
+	}
+	if h.channels > d.maxChannels {
+		return h, fmt.Errorf("frame channel count %d exceeds limit of %d", h.channels, d.maxChannels)
+	}
+
+	return h, nil
+}
+
+// sampleRateTable maps the fixed frame header sample rate codes to rates
+var sampleRateTable = [12]uint32{
+	0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000,
+}
+
+// readSubframe decodes one subframe into samples
+func (d *Decoder) readSubframe(br *bitReader, samples []int32, bitsPerSample uint8) error {
+	// Subframe header: 0 (padding) + subframe type (6 bits) + wasted bits flag (1 bit)
+	header, err := br.readBits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return errors.New("invalid subframe header padding")
+	}
+	subframeType := uint8(header>>1) & 0x3F
+
+	// Wasted bits-per-sample count, unary coded
+	wasted := 0
+	if header&0x01 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = int(k) + 1
+		if wasted >= int(bitsPerSample) {
+			return errors.New("invalid wasted bits count")
+		}
+	}
+	sampleBits := int(bitsPerSample) - wasted
+
+	switch {
+	case subframeType == 0x00:
+		// CONSTANT
+		v, err := br.readBitsSigned(sampleBits)
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = int32(v)
+		}
+	case subframeType == 0x01:
+		// VERBATIM
+		for i := range samples {
+			v, err := br.readBitsSigned(sampleBits)
+			if err != nil {
+				return err
+			}
+			samples[i] = int32(v)
+		}
+	case subframeType >= 0x08 && subframeType <= 0x0C:
+		// FIXED
+		order := int(subframeType & 0x07)
+		if err := d.readFixedSubframe(br, samples, sampleBits, order); err != nil {
+			return err
+		}
+	case subframeType >= 0x20:
+		// LPC
+		order := int(subframeType&0x1F) + 1
+		if err := d.readLPCSubframe(br, samples, sampleBits, order); err != nil {
+			return err
+		}
+		d.maxLPCOrder = max(d.maxLPCOrder, order)
+	default:
+		return fmt.Errorf("unsupported subframe type 0x%02X", subframeType)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// readFixedSubframe decodes the body of a FIXED subframe
+func (d *Decoder) readFixedSubframe(br *bitReader, samples []int32, sampleBits, order int) error {
+	if order > len(samples) {
+		return errors.New("predictor order exceeds block size")
+	}
+
+	// Unencoded warm-up samples
+	for i := 0; i < order; i++ {
+		v, err := br.readBitsSigned(sampleBits)
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+
+	residuals, err := d.readResidual(br, len(samples), order)
+	if err != nil {
+		return err
+	}
+
+	// Restore the signal from prediction plus residual
+	for i := order; i < len(samples); i++ {
+		samples[i] = int32(fixedPredict(samples, i, order) + residuals[i-order])
+	}
+	return nil
+}
+
+// readResidual decodes the partitioned Rice coded residual of a subframe
+func (d *Decoder) readResidual(br *bitReader, blockSize, predictorOrder int) ([]int64, error) {
+	method, err := br.readBits(2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Method 0 has 4-bit Rice parameters, method 1 has 5-bit parameters
+	var paramBits int
+	switch method {
+	case 0:
+		paramBits = 4
+	case 1:
+		paramBits = 5
+	default:
+		return nil, errors.New("reserved residual coding method")
+	}
+	escapeParam := uint64(1)<<paramBits - 1
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return nil, err
+	}
+	d.maxPartitionOrder = max(d.maxPartitionOrder, int(partitionOrder))
+	partitions := 1 << partitionOrder
+	if blockSize%partitions != 0 || blockSize>>partitionOrder < predictorOrder {
+		return nil, errors.New("invalid residual partition order")
+	}
+
+	residuals := d.residuals[:0]
+	for p := 0; p < partitions; p++ {
+		count := blockSize >> partitionOrder
+		if p == 0 {
+			count -= predictorOrder
+		}
+
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return nil, err
+		}
+
+		if param == escapeParam {
+			// Escaped partition: residuals stored as raw signed values
+			n, err := br.readBits(5)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < count; i++ {
+				v, err := br.readBitsSigned(int(n))
+				if err != nil {
+					return nil, err
+				}
+				residuals = append(residuals, v)
+			}
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			quotient, err := br.readUnary()
+			if err != nil {
+				return nil, err
+			}
+			remainder, err := br.readBits(int(param))
+			if err != nil {
+				return nil, err
+			}
+			// Undo the zigzag encoding
+			uval := quotient<<param | remainder
+			residuals = append(residuals, int64(uval>>1)^-int64(uval&1))
+		}
+	}
+
+	d.residuals = residuals
+	return residuals, nil
+}
@@ -0,0 +1,615 @@
+package goflac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// encodeSineFLAC generates a sine wave and encodes it, returning the input
+// samples and the FLAC stream
+func encodeSineFLAC(t *testing.T, duration float64, channels uint16) ([][]int32, []byte) {
+	t.Helper()
+
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, duration, 44100, channels, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, 44100, uint8(channels), 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	return samples, flacBuf.Bytes()
+}
+
+// assertSamplesEqual fails the test if the two sample sets differ
+func assertSamplesEqual(t *testing.T, expected, got [][]int32) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d channels, got %d", len(expected), len(got))
+	}
+	for ch := range expected {
+		if len(got[ch]) != len(expected[ch]) {
+			t.Fatalf("Channel %d: expected %d samples, got %d", ch, len(expected[ch]), len(got[ch]))
+		}
+		for i := range expected[ch] {
+			if got[ch][i] != expected[ch][i] {
+				t.Fatalf("Channel %d sample %d: expected %d, got %d", ch, i, expected[ch][i], got[ch][i])
+			}
+		}
+	}
+}
+
+func TestDecoder_RoundTrip(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.Channels() != 2 || decoder.BitsPerSample() != 16 || decoder.SampleRate() != 44100 {
+		t.Errorf("Unexpected stream parameters: %d channels, %d bits, %d Hz",
+			decoder.Channels(), decoder.BitsPerSample(), decoder.SampleRate())
+	}
+
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestDecodeReader(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	decoded, info, err := DecodeReader(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if info.Channels != 2 || info.BitsPerSample != 16 || info.SampleRate != 44100 {
+		t.Errorf("Unexpected stream parameters: %d channels, %d bits, %d Hz",
+			info.Channels, info.BitsPerSample, info.SampleRate)
+	}
+	if info.TotalSamples != uint64(len(samples[0])) {
+		t.Errorf("Expected %d total samples, got %d", len(samples[0]), info.TotalSamples)
+	}
+	assertSamplesEqual(t, samples, decoded)
+
+	if _, _, err := DecodeReader(bytes.NewReader([]byte("RIFF"))); err == nil {
+		t.Error("Expected an error for a stream without the fLaC signature")
+	}
+}
+
+func TestDecoder_CorruptFrame(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 0.1, 1)
+
+	// Flip a bit in the middle of the first frame's audio data
+	corrupt := append([]byte(nil), flacData...)
+	corrupt[len(corrupt)/2] ^= 0x10
+
+	decoder, err := NewDecoder(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.DecodeAll(); err == nil {
+		t.Error("Expected error decoding a corrupted frame")
+	}
+}
+
+func TestDecoder_DecodeAllChecksTotalSamples(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	// A clean stream decodes to the declared length
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.DecodeAll(); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	// Drop the last frame, leaving a stream that ends cleanly on a frame
+	// boundary but short of the STREAMINFO total
+	decoder, err = NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	truncated := len(flacData)
+	for {
+		frame, _, err := decoder.NextRawFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read raw frame: %v", err)
+		}
+		truncated = len(flacData) - len(frame)
+	}
+
+	decoder, err = NewDecoder(bytes.NewReader(flacData[:truncated]))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	_, err = decoder.DecodeAll()
+	if err == nil {
+		t.Fatal("Expected an error decoding a truncated stream")
+	}
+	expected := fmt.Sprintf("expected %d samples, decoded %d", 22050, 22050/4096*4096)
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err)
+	}
+}
+
+func TestDecoder_NextRawFrame(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 1.0, 2)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	var frames [][]byte
+	totalSamples := 0
+	for {
+		frame, sampleCount, err := decoder.NextRawFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read raw frame: %v", err)
+		}
+		frames = append(frames, frame)
+		totalSamples += sampleCount
+	}
+
+	expectedFrames := (len(samples[0]) + 4095) / 4096
+	if len(frames) != expectedFrames {
+		t.Errorf("Expected %d frames, got %d", expectedFrames, len(frames))
+	}
+	if totalSamples != len(samples[0]) {
+		t.Errorf("Expected %d samples, got %d", len(samples[0]), totalSamples)
+	}
+
+	// The raw frames must be exactly the encoded frame bytes
+	var joined []byte
+	for _, frame := range frames {
+		joined = append(joined, frame...)
+	}
+	if !bytes.Equal(joined, flacData[42:]) {
+		t.Error("Raw frames do not match the encoded frame bytes")
+	}
+
+	// Repackage the frames into a new stream and decode it
+	var assembled bytes.Buffer
+	if err := AssembleStream(&assembled, decoder.StreamInfo(), frames); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+
+	repackaged, err := NewDecoder(bytes.NewReader(assembled.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := repackaged.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode repackaged stream: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestDecoder_RejectsIllegalBlockSize(t *testing.T) {
+	// Frame header declaring a 65536-sample block via the 16-bit block
+	// size field, one more than the format allows
+	bw := newBitWriter()
+	bw.writeBits(0xFFF8, 16) // sync code, fixed blocking strategy
+	bw.writeBits(0x07, 4)    // block size: 16-bit value follows
+	bw.writeBits(0x09, 4)    // 44.1kHz
+	bw.writeBits(0x07, 4)    // 8 independent channels
+	bw.writeBits(0x04, 3)    // 16 bits per sample
+	bw.writeBits(0, 1)
+	bw.writeUTF8(0)
+	bw.writeBits(0xFFFF, 16) // block size - 1
+	bw.writeBits(uint64(calculateCRC8(bw.bytes())), 8)
+	frame := append(bw.bytes(), make([]byte, 64)...)
+
+	info := StreamInfo{
+		MinBlockSize:  4096,
+		MaxBlockSize:  4096,
+		SampleRate:    44100,
+		Channels:      8,
+		BitsPerSample: 16,
+	}
+	var stream bytes.Buffer
+	if err := AssembleStream(&stream, info, [][]byte{frame}); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = decoder.ReadFrame()
+	runtime.ReadMemStats(&after)
+
+	if err == nil || !strings.Contains(err.Error(), "block size") {
+		t.Fatalf("Expected block size error, got %v", err)
+	}
+	// Decoding the frame would need 8 channels x 65536 samples x 4 bytes
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 256*1024 {
+		t.Errorf("Rejecting the frame allocated %d bytes", allocated)
+	}
+}
+
+func TestDecoder_MaxBlockSizeOption(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 0.1, 1)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData), WithMaxBlockSize(1024))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.ReadFrame(); err == nil {
+		t.Error("Expected error for a 4096-sample frame with a 1024 limit")
+	}
+
+	decoder, err = NewDecoder(bytes.NewReader(flacData), WithMaxChannels(1))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.ReadFrame(); err != nil {
+		t.Errorf("Unexpected error for a mono stream with a 1-channel limit: %v", err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(flacData), WithMaxBlockSize(70000)); err == nil {
+		t.Error("Expected error for a max block size above 65535")
+	}
+}
+
+func TestDecoder_RejectsOversizedFrameNumber(t *testing.T) {
+	// A fixed-blocksize frame header coding a frame number of 2^31
+	bw := newBitWriter()
+	bw.writeBits(0xFFF8, 16)
+	bw.writeBits(0x0C, 4) // 4096 samples
+	bw.writeBits(0x09, 4) // 44.1kHz
+	bw.writeBits(0x00, 4) // mono
+	bw.writeBits(0x04, 3) // 16 bits per sample
+	bw.writeBits(0, 1)
+	bw.writeUTF8(maxFrameNumber + 1)
+	bw.writeBits(uint64(calculateCRC8(bw.bytes())), 8)
+
+	info := StreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	var stream bytes.Buffer
+	if err := AssembleStream(&stream, info, [][]byte{bw.bytes()}); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.ReadFrame(); err == nil {
+		t.Error("Expected error for a frame number above 31 bits")
+	}
+}
+
+func TestDecoder_Frames(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 1.0, 2)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	total := 0
+	frames := 0
+	for frame, err := range decoder.Frames() {
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if len(frame) != 2 {
+			t.Fatalf("Expected 2 channels, got %d", len(frame))
+		}
+		total += len(frame[0])
+		frames++
+	}
+	if total != len(samples[0]) {
+		t.Errorf("Expected %d samples, got %d", len(samples[0]), total)
+	}
+	if frames != (len(samples[0])+4095)/4096 {
+		t.Errorf("Expected %d frames, got %d", (len(samples[0])+4095)/4096, frames)
+	}
+}
+
+func TestDecoder_FramesError(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 0.5, 1)
+
+	// Corrupt the CRC-16 at the end of the last frame
+	corrupted := append([]byte(nil), flacData...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	decoder, err := NewDecoder(bytes.NewReader(corrupted))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	var errs []error
+	for frame, err := range decoder.Frames() {
+		if err != nil {
+			if frame != nil {
+				t.Error("Expected nil samples alongside an error")
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected exactly one error to end the sequence, got %v", errs)
+	}
+}
+
+func TestDecoder_StereoDecorrelation(t *testing.T) {
+	modes := map[string]uint8{
+		"left/side":  channelLeftSide,
+		"right/side": channelRightSide,
+		"mid/side":   channelMidSide,
+	}
+
+	for _, bits := range []uint8{16, 24} {
+		maxValue := int32(1)<<(bits-1) - 1
+		minValue := -maxValue - 1
+
+		// Full scale extremes give side the extra bit, and odd L+R sums
+		// exercise the bit mid/side drops
+		samples := [][]int32{make([]int32, 5000), make([]int32, 5000)}
+		for i := range samples[0] {
+			samples[0][i] = int32(i*37%2001) - 1000
+			samples[1][i] = int32(i*53%3001) - 1500 + int32(i%2)
+		}
+		samples[0][10], samples[1][10] = maxValue, minValue
+		samples[0][11], samples[1][11] = minValue, maxValue
+		samples[0][12], samples[1][12] = maxValue, maxValue-1
+
+		for name, mode := range modes {
+			var buf bytes.Buffer
+			encoder, err := NewEncoder(&buf, 44100, 2, bits)
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			encoder.stereoMode = mode
+			if err := encoder.Encode(samples); err != nil {
+				t.Fatalf("%s: failed to encode: %v", name, err)
+			}
+
+			// The first frame header follows the 42-byte stream header
+			if code := buf.Bytes()[42+3] >> 4; code != mode {
+				t.Errorf("%s: expected channel assignment %d, got %d", name, mode, code)
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: failed to create decoder: %v", name, err)
+			}
+			decoded, err := decoder.DecodeAll()
+			if err != nil {
+				t.Fatalf("%s %d-bit: failed to decode: %v", name, bits, err)
+			}
+			assertSamplesEqual(t, samples, decoded)
+		}
+	}
+}
+
+func TestDecoder_ReadFrameReusesBuffers(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	first, err := decoder.ReadFrameCopy()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	reused, err := decoder.ReadFrame()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	second := &reused[0][0]
+	if _, err := decoder.ReadFrame(); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+
+	if second != &decoder.samples[0][0] {
+		t.Error("Expected ReadFrame to reuse its sample buffers")
+	}
+
+	// The copy is unaffected by later reads
+	assertSamplesEqual(t, [][]int32{samples[0][:4096], samples[1][:4096]}, first)
+}
+
+func benchmarkDecodeFrames(b *testing.B, read func(*Decoder) ([][]int32, error)) {
+	samples := [][]int32{make([]int32, 20*4096), make([]int32, 20*4096)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%500) - 250
+		samples[1][i] = int32(i%300) - 150
+	}
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, 44100, 2, 16)
+	if err != nil {
+		b.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		b.Fatalf("Failed to encode: %v", err)
+	}
+	flacData := flacBuf.Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder, err := NewDecoder(bytes.NewReader(flacData))
+		if err != nil {
+			b.Fatalf("Failed to create decoder: %v", err)
+		}
+		for {
+			if _, err := read(decoder); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatalf("Failed to decode: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecoder_ReadFrame(b *testing.B) {
+	benchmarkDecodeFrames(b, (*Decoder).ReadFrame)
+}
+
+func BenchmarkDecoder_ReadFrameCopy(b *testing.B) {
+	benchmarkDecodeFrames(b, (*Decoder).ReadFrameCopy)
+}
+
+func TestDecoder_SkipsID3v2Tag(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	// A 200 byte tag body: the size is 200 as a synchsafe integer (1<<7 | 72)
+	tag := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 1, 72}
+	tag = append(tag, bytes.Repeat([]byte{0xAB}, 200)...)
+	prefixed := append(tag, flacData...)
+
+	decoder, err := NewDecoder(bytes.NewReader(prefixed))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.SampleRate() != 44100 || decoder.Channels() != 2 {
+		t.Errorf("Unexpected stream format: %d Hz, %d channels", decoder.SampleRate(), decoder.Channels())
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+
+	// A footer adds another 10 bytes after the tag body
+	withFooter := []byte{'I', 'D', '3', 4, 0, 0x10, 0, 0, 0, 0}
+	withFooter = append(withFooter, []byte{'3', 'D', 'I', 4, 0, 0x10, 0, 0, 0, 0}...)
+	withFooter = append(withFooter, flacData...)
+	if _, err := NewDecoder(bytes.NewReader(withFooter)); err != nil {
+		t.Errorf("Failed to skip ID3v2 tag with footer: %v", err)
+	}
+
+	// A tag that runs past the end of the stream
+	if _, err := NewDecoder(bytes.NewReader(tag[:50])); err == nil {
+		t.Error("Expected error for truncated ID3v2 tag")
+	}
+}
+
+func TestDecoder_BlockingStrategy(t *testing.T) {
+	samples := [][]int32{make([]int32, 4096)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%200) - 100
+	}
+	sizes, flacData := rawFrameSizes(t, samples)
+	if len(sizes) != 1 {
+		t.Fatalf("Expected a single frame, got %d", len(sizes))
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if got := decoder.BlockingStrategy(); got != BlockingStrategyFixed {
+		t.Errorf("Expected fixed blocking strategy, got %d", got)
+	}
+
+	// Recode the frame as variable-blocksize. The first frame's sample
+	// number and frame number are both 0, so only the sync code and CRCs
+	// change.
+	decoder, err = NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	frame, _, err := decoder.NextRawFrame()
+	if err != nil {
+		t.Fatalf("Failed to read raw frame: %v", err)
+	}
+	frame = append([]byte(nil), frame...)
+	frame[1] = 0xF9
+	frame[5] = calculateCRC8(frame[:5]) // 4096 samples at 44.1kHz need no extra header bytes
+	crc := calculateCRC16(frame[:len(frame)-2])
+	frame[len(frame)-2], frame[len(frame)-1] = byte(crc>>8), byte(crc)
+
+	var stream bytes.Buffer
+	if err := AssembleStream(&stream, decoder.StreamInfo(), [][]byte{frame}); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+	decoder, err = NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if got := decoder.BlockingStrategy(); got != BlockingStrategyVariable {
+		t.Errorf("Expected variable blocking strategy, got %d", got)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode variable-blocksize stream: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+
+	// With no frames, differing STREAMINFO block sizes imply variable
+	stream.Reset()
+	info := StreamInfo{MinBlockSize: 1024, MaxBlockSize: 4096, SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	if err := AssembleStream(&stream, info, nil); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+	decoder, err = NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if got := decoder.BlockingStrategy(); got != BlockingStrategyVariable {
+		t.Errorf("Expected variable blocking strategy from STREAMINFO, got %d", got)
+	}
+}
+
+func TestDecoder_RejectsReservedSampleSize(t *testing.T) {
+	bw := newBitWriter()
+	bw.writeBits(0xFFF8, 16)
+	bw.writeBits(0x0C, 4) // 4096 samples
+	bw.writeBits(0x09, 4) // 44.1kHz
+	bw.writeBits(0x00, 4) // mono
+	bw.writeBits(0x03, 3) // reserved sample size code
+	bw.writeBits(0, 1)
+	bw.writeUTF8(0)
+	bw.writeBits(uint64(calculateCRC8(bw.bytes())), 8)
+	frame := append(bw.bytes(), make([]byte, 64)...)
+
+	info := StreamInfo{MinBlockSize: 4096, MaxBlockSize: 4096, SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	var stream bytes.Buffer
+	if err := AssembleStream(&stream, info, [][]byte{frame}); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	_, err = decoder.ReadFrame()
+	if err == nil || !strings.Contains(err.Error(), "reserved sample size code 0b011") {
+		t.Errorf("Expected reserved sample size error, got %v", err)
+	}
+}
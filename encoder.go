@@ -1,10 +1,15 @@
 package goflac
 
 import (
+	"bytes"
+	"crypto/md5"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
-	"math"
+	"math/bits"
+	"sort"
 )
 
 // Encoder represents a FLAC stream encoder
@@ -18,93 +23,556 @@ type Encoder struct {
 	minFrameSize  uint32
 	maxFrameSize  uint32
 	md5sum        [16]byte
+
+	// advertisedRate, when non-zero, replaces sampleRate in STREAMINFO
+	// and frame headers
+	advertisedRate uint32
+
+	// eosCallback is called once the stream has been closed and flushed
+	eosCallback func()
+	closed      bool
+
+	// headerWritten records that the stream header and metadata blocks
+	// have been written, so they are never emitted twice
+	headerWritten bool
+
+	// seekable records that the header went to a writer that can seek, so
+	// STREAMINFO can be rewritten at streamStart; streamInfoFinal that the
+	// STREAMINFO written describes all the audio encoded
+	seekable        bool
+	streamInfoFinal bool
+
+	// zeroFill pads channels shorter than the longest one with silence
+	zeroFill bool
+
+	// comments are written to a VORBIS_COMMENT block in order
+	comments []VorbisComment
+
+	// cueSheet, if set, is written to a CUESHEET block
+	cueSheet *CueSheet
+
+	// extraBlocks are written after the built-in metadata blocks in the
+	// order added
+	extraBlocks []metadataBlock
+
+	// padding is the length of the PADDING block written after all other
+	// metadata, or 0 for none
+	padding int
+
+	// Running state of the encoded audio, needed to finalize STREAMINFO
+	// and saved by MarshalCheckpoint
+	md5             hash.Hash
+	md5Buf          []byte
+	samplesEncoded  uint64
+	minBlockSize    uint16
+	maxBlockSize    uint16
+	nextFrameNumber uint64
+	bytesWritten    int64
+	headerLength    int64
+	streamStart     int64
+	seekPoints      []SeekPoint
+	seekInterval    uint64
+
+	// seekTable enables the SEEKTABLE block, written with seekTableSlots
+	// entries at seekTableOffset from the start of the stream
+	seekTable       bool
+	seekTableSlots  int
+	seekTableOffset int64
+
+	// leadOutOffset is where the CUESHEET block's lead-out track offset is
+	// written, from the start of the stream, so Close can complete it
+	leadOutOffset int64
+
+	// overview, if set, collects waveform peaks from every encoded block
+	overview *waveformOverview
+
+	// usedBits, if set, reports the bits each channel needed at the end
+	usedBits *usedBitsTracker
+
+	// progress, if set, reports completion after every frame
+	progress *progressTracker
+
+	// inputChecksum detects callers mutating the input during Encode
+	inputChecksum bool
+
+	// subset restricts the stream to the FLAC streamable subset
+	subset bool
+
+	// dc, if set, removes the DC offset of every block before encoding
+	dc *dcRemover
+
+	// clip clips out-of-range samples instead of rejecting them, copying
+	// the block to clipped
+	clip    bool
+	clipped [][]int32
+
+	// stereoMode, if non-zero, is the stereo channel assignment used for
+	// two-channel frames; otherwise stereoDecorrelation picks the
+	// assignment for each frame
+	stereoMode          uint8
+	stereoDecorrelation bool
+
+	// riceSearch selects how Rice partitions and parameters are chosen,
+	// trying partition orders up to maxPartitionOrder
+	riceSearch        RicePartitionSearch
+	maxPartitionOrder int
+
+	// maxRiceQuotient bounds unary quotients; 0 means unlimited
+	maxRiceQuotient uint64
+
+	// maxLPCOrder is the highest LPC order tried; 0 disables LPC
+	maxLPCOrder int
+
+	// apodization selects the windows LPC analysis tries
+	apodization apodization
+
+	// predictor, if set, is tried before the built-in predictors
+	predictor Predictor
+
+	// pending holds samples pushed by WriteSamples that do not yet fill a
+	// block; streaming records that WriteSamples has been used
+	pending   [][]int32
+	streaming bool
+
+	// packetCallback, if set, receives every frame; WriteSamples then
+	// encodes each call as exactly one frame
+	packetCallback func(frame []byte, samples int)
+
+	// frameHook, if set, receives every frame without changing how
+	// WriteSamples blocks the audio; used by OggEncoder
+	frameHook func(frame []byte, samples int)
+
+	// stats, if set, gathers a CompressionReport
+	stats *statsCollector
+
+	// variableBlockSize selects the variable-blocksize strategy, whose
+	// frame headers code sample numbers
+	variableBlockSize bool
+
+	// frameNumberFunc, if set, replaces the coded frame numbers; testing only
+	frameNumberFunc func(blockIndex int) uint64
+
+	// Scratch space reused across frames to avoid per-frame allocations
+	frameBuf       *bitWriter
+	residuals      []int64
+	block          [][]int32
+	riceParams     []uint8
+	riceCandidate  []uint8
+	stereo         [2][]int32
+	stereoOut      [2][]int32
+	wasted         []int32
+	lpcWindows     [][]float64
+	lpcWindowed    []float64
+	predictorProbe []int32
 }
 
-// NewEncoder creates a new FLAC encoder
-func NewEncoder(w io.Writer, sampleRate uint32, channels, bitsPerSample uint8) (*Encoder, error) {
-	if channels == 0 || channels > 8 {
-		return nil, errors.New("invalid number of channels")
+// Option configures optional Encoder behavior
+type Option func(*Encoder) error
+
+// WithAdvertisedSampleRate writes rate to STREAMINFO and the frame headers
+// instead of the sample rate the encoder was created with. The samples
+// themselves are encoded unchanged, so a decoder will play them back at
+// the advertised rate.
+func WithAdvertisedSampleRate(rate uint32) Option {
+	return func(e *Encoder) error {
+		if err := validateSampleRate(rate); err != nil {
+			return err
+		}
+		e.advertisedRate = rate
+		return nil
 	}
-	if bitsPerSample == 0 || bitsPerSample > 32 {
-		return nil, errors.New("invalid bits per sample")
+}
+
+// WithEOSCallback registers fn to be called once by Close, after the last
+// frame has been written and the writer flushed. Raw FLAC has no end of
+// stream marker, so this lets streaming consumers signal the end out of band.
+func WithEOSCallback(fn func()) Option {
+	return func(e *Encoder) error {
+		e.eosCallback = fn
+		return nil
+	}
+}
+
+// WithZeroFillShortChannels controls how Encode treats channels of unequal
+// length. When enabled, shorter channels are padded with zeros up to the
+// length of the longest channel; otherwise unequal lengths are an error.
+func WithZeroFillShortChannels(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.zeroFill = enabled
+		return nil
+	}
+}
+
+// NewEncoder creates a new FLAC encoder
+func NewEncoder(w io.Writer, sampleRate uint32, channels, bitsPerSample uint8, opts ...Option) (*Encoder, error) {
+	if err := validateChannelsAndBits(channels, bitsPerSample); err != nil {
+		return nil, err
 	}
 
-	return &Encoder{
+	e := &Encoder{
 		w:             w,
 		sampleRate:    sampleRate,
 		channels:      channels,
 		bitsPerSample: bitsPerSample,
 		blockSize:     4096, // Default block size
-	}, nil
+		frameBuf:      newBitWriter(),
+		md5:           md5.New(),
+		seekInterval:  10 * uint64(sampleRate), // One seek point every 10 seconds
+
+		maxRiceQuotient:     defaultMaxRiceQuotient,
+		maxLPCOrder:         defaultMaxLPCOrder,
+		stereoDecorrelation: true,
+		maxPartitionOrder:   maxRicePartitionOrder,
+	}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.checkFormat(sampleRate, bitsPerSample); err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
-// WriteStreamInfo writes the FLAC stream header and STREAMINFO metadata block
-func (e *Encoder) WriteStreamInfo() error {
-	// Write FLAC signature
-	if _, err := e.w.Write([]byte("fLaC")); err != nil {
+// validateChannelsAndBits checks the channel count and sample width
+func validateChannelsAndBits(channels, bitsPerSample uint8) error {
+	if channels == 0 || channels > 8 {
+		return errors.New("invalid number of channels")
+	}
+	if bitsPerSample == 0 || bitsPerSample > 32 {
+		return errors.New("invalid bits per sample")
+	}
+	return nil
+}
+
+// checkFormat checks that a stream at sampleRate with bitsPerSample can be
+// encoded with the encoder's settings, including the subset restrictions
+// if enabled
+func (e *Encoder) checkFormat(sampleRate uint32, bitsPerSample uint8) error {
+	if e.advertisedRate != 0 {
+		sampleRate = e.advertisedRate
+	}
+	if err := validateSampleRate(sampleRate); err != nil {
 		return err
 	}
+	if e.subset {
+		if err := checkSubsetFormat(sampleRate, bitsPerSample); err != nil {
+			return err
+		}
+		if err := checkSubsetBlockSize(sampleRate, int(e.blockSize)); err != nil {
+			return err
+		}
+		if err := checkSubsetLPCOrder(sampleRate, e.maxLPCOrder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSampleRate checks that rate can be stored exactly both in the
+// 20-bit STREAMINFO sample rate field and in every frame header
+func validateSampleRate(rate uint32) error {
+	if rate == 0 {
+		return errors.New("sample rate must be non-zero")
+	}
+	if rate > 0xFFFFF {
+		return fmt.Errorf("sample rate %d Hz does not fit in 20 bits", rate)
+	}
+	if !frameSampleRateExact(rate) {
+		return fmt.Errorf("sample rate %d Hz cannot be represented exactly in frame headers", rate)
+	}
+	return nil
+}
+
+// frameSampleRateExact reports whether the frame header encoding chosen by
+// getSampleRateCode stores rate without rounding. Rates of 65536 Hz and up
+// that are not whole kHz fall back to tens of Hz, which drops the last
+// digit and tops out at 655350 Hz.
+func frameSampleRateExact(rate uint32) bool {
+	switch getSampleRateCode(rate) {
+	case 0x0C:
+		return rate/1000 <= 0xFF
+	case 0x0D:
+		return rate <= 0xFFFF
+	case 0x0E:
+		return rate%10 == 0 && rate/10 <= 0xFFFF
+	}
+	return true
+}
+
+// streamSampleRate returns the sample rate written to the stream headers
+func (e *Encoder) streamSampleRate() uint32 {
+	if e.advertisedRate != 0 {
+		return e.advertisedRate
+	}
+	return e.sampleRate
+}
+
+// SetBlockSize sets the number of inter-channel samples per frame, 4096 by
+// default. FLAC allows 16 to 65535; smaller blocks lower the latency of
+// streaming at some cost in compression, and sizes with a dedicated frame
+// header code, such as 1152 or 4096, save a byte or two per frame. It must
+// be called before anything is encoded.
+func (e *Encoder) SetBlockSize(n uint32) error {
+	if n < 16 || n > 65535 {
+		return errors.New("block size must be between 16 and 65535")
+	}
+	if e.headerWritten || e.samplesEncoded > 0 || e.streaming {
+		return errors.New("block size must be set before encoding")
+	}
+	if e.subset {
+		if err := checkSubsetBlockSize(e.streamSampleRate(), int(n)); err != nil {
+			return err
+		}
+	}
+	e.blockSize = n
+	return nil
+}
 
-	// Write STREAMINFO metadata block
-	// Last metadata block flag (1) + block type (0 = STREAMINFO)
-	header := byte(0x80) // 0x80 = last metadata block
-	if _, err := e.w.Write([]byte{header}); err != nil {
+// AddComment adds a KEY=value tag to the VORBIS_COMMENT block. Adding the
+// same key more than once stores every value, in the order added.
+func (e *Encoder) AddComment(key, value string) error {
+	if err := validateCommentKey(key); err != nil {
 		return err
 	}
+	e.comments = append(e.comments, VorbisComment{Key: key, Value: value})
+	return nil
+}
 
-	// Block length (34 bytes for STREAMINFO)
-	length := make([]byte, 4)
-	binary.BigEndian.PutUint32(length, 34)
-	if _, err := e.w.Write(length[1:]); err != nil {
+// SetTags replaces all tags. Keys are written in sorted order so the output
+// is deterministic, and each value of a key becomes its own comment line.
+func (e *Encoder) SetTags(tags map[string][]string) error {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		if err := validateCommentKey(key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	e.comments = e.comments[:0]
+	for _, key := range keys {
+		for _, value := range tags[key] {
+			e.comments = append(e.comments, VorbisComment{Key: key, Value: value})
+		}
+	}
+	return nil
+}
+
+// SetCueSheet embeds cs in a CUESHEET block. A lead-out track is added
+// automatically at the end of the audio. Its offset is completed at Close
+// if the writer can seek; otherwise the total sample count must be known
+// when the header is written, as it is with Encode, and streaming audio of
+// unknown length is refused.
+func (e *Encoder) SetCueSheet(cs *CueSheet) error {
+	if err := cs.validate(); err != nil {
 		return err
 	}
+	e.cueSheet = cs
+	return nil
+}
 
-	// STREAMINFO block (34 bytes)
-	streamInfo := make([]byte, 34)
+// AddMetadataBlock adds a raw metadata block of the given type, written
+// after the blocks the encoder generates itself. data is the block body,
+// without the 4-byte block header. STREAMINFO and the invalid type 127 are
+// rejected, and blocks must be added before the header is written.
+func (e *Encoder) AddMetadataBlock(blockType uint8, data []byte) error {
+	if e.headerWritten {
+		return errors.New("stream header already written")
+	}
+	if blockType == blockTypeStreamInfo || blockType >= blockTypeInvalid {
+		return fmt.Errorf("invalid metadata block type %d", blockType)
+	}
+	if len(data) >= 1<<24 {
+		return errors.New("metadata block too large")
+	}
+	e.extraBlocks = append(e.extraBlocks, metadataBlock{blockType, bytes.Clone(data)})
+	return nil
+}
 
-	// Min block size (16 bits)
-	binary.BigEndian.PutUint16(streamInfo[0:2], uint16(e.blockSize))
+// SetPadding reserves n zero bytes in a PADDING block after all other
+// metadata, so tags can later be edited in place without rewriting the
+// audio. n of 0 writes no PADDING block. It must be called before the
+// stream header is written.
+func (e *Encoder) SetPadding(n int) error {
+	if e.headerWritten {
+		return errors.New("stream header already written")
+	}
+	if n < 0 || n >= 1<<24 {
+		return errors.New("padding must be between 0 and 16777215 bytes")
+	}
+	e.padding = n
+	return nil
+}
 
-	// Max block size (16 bits)
-	binary.BigEndian.PutUint16(streamInfo[2:4], uint16(e.blockSize))
+// BytesWritten returns the number of bytes of the stream written so far,
+// header included. Completing STREAMINFO in place does not change it, so
+// once the encoder is closed it is the length of the whole stream.
+func (e *Encoder) BytesWritten() int64 {
+	return e.bytesWritten
+}
 
-	// Min frame size (24 bits) - 0 for unknown
-	streamInfo[4] = 0
-	streamInfo[5] = 0
-	streamInfo[6] = 0
+// write writes p to the output, counting the bytes written
+func (e *Encoder) write(p []byte) error {
+	n, err := e.w.Write(p)
+	e.bytesWritten += int64(n)
+	return err
+}
 
-	// Max frame size (24 bits) - 0 for unknown
-	streamInfo[7] = 0
-	streamInfo[8] = 0
-	streamInfo[9] = 0
+// writeMetadataBlock writes a metadata block header followed by data
+func (e *Encoder) writeMetadataBlock(blockType uint8, last bool, data []byte) error {
+	// Last metadata block flag (1 bit) + block type (7 bits)
+	header := blockType
+	if last {
+		header |= 0x80
+	}
 
-	// Sample rate (20 bits) + channels (3 bits) + bits per sample (5 bits)
-	// Byte 10-11-12: sample rate (20 bits)
-	streamInfo[10] = byte(e.sampleRate >> 12)
-	streamInfo[11] = byte(e.sampleRate >> 4)
-	streamInfo[12] = byte((e.sampleRate&0x0F)<<4) | byte((e.channels-1)<<1) | byte((e.bitsPerSample-1)>>4)
+	// Block length (24 bits)
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	length[0] = header
 
-	// Byte 13: bits per sample (4 bits) + total samples (4 bits)
-	streamInfo[13] = byte(((e.bitsPerSample-1)&0x0F)<<4) | byte(e.totalSamples>>32)
+	if err := e.write(length); err != nil {
+		return err
+	}
+	return e.write(data)
+}
 
-	// Bytes 14-17: total samples (32 bits)
-	binary.BigEndian.PutUint32(streamInfo[14:18], uint32(e.totalSamples))
+// WriteStreamInfo writes the FLAC stream header, the STREAMINFO metadata
+// block and any further metadata blocks. The encoding methods write the
+// header themselves if it has not been written yet; calling WriteStreamInfo
+// a second time is an error.
+func (e *Encoder) WriteStreamInfo() error {
+	if e.headerWritten {
+		return errors.New("stream header already written")
+	}
 
-	// Bytes 18-33: MD5 signature (16 bytes) - all zeros for now
-	copy(streamInfo[18:34], e.md5sum[:])
+	e.streamStart, e.seekable = e.streamOffset()
+	start := e.bytesWritten
 
-	if _, err := e.w.Write(streamInfo); err != nil {
+	// Write FLAC signature
+	if err := e.write([]byte("fLaC")); err != nil {
 		return err
 	}
 
+	// STREAMINFO block (34 bytes), complete if the audio has already been
+	// encoded
+	info := StreamInfo{
+		MinBlockSize:  uint16(e.blockSize),
+		MaxBlockSize:  uint16(e.blockSize),
+		MinFrameSize:  e.minFrameSize,
+		MaxFrameSize:  e.maxFrameSize,
+		SampleRate:    e.streamSampleRate(),
+		Channels:      e.channels,
+		BitsPerSample: e.bitsPerSample,
+		TotalSamples:  e.totalSamples,
+		MD5:           e.md5sum,
+	}
+	if e.samplesEncoded > 0 {
+		info = e.currentStreamInfo()
+	}
+	streamInfo := info.marshal()
+
+	blocks := []metadataBlock{{blockTypeStreamInfo, streamInfo}}
+	if e.seekTable {
+		slots, err := e.countSeekTableSlots()
+		if err != nil {
+			return err
+		}
+		e.seekTableSlots = slots
+		blocks = append(blocks, metadataBlock{blockTypeSeekTable, marshalSeekTable(e.seekPoints, slots)})
+	}
+	if len(e.comments) > 0 {
+		blocks = append(blocks, metadataBlock{blockTypeVorbisComment, marshalVorbisComments(vendorString, e.comments)})
+	}
+	cueSheetBlock := -1
+	if e.cueSheet != nil {
+		cueSheetBlock = len(blocks)
+		blocks = append(blocks, metadataBlock{blockTypeCueSheet, e.cueSheet.marshal(e.totalSamples)})
+	}
+	blocks = append(blocks, e.extraBlocks...)
+	if e.padding > 0 {
+		blocks = append(blocks, metadataBlock{blockTypePadding, make([]byte, e.padding)})
+	}
+
+	// Only the final metadata block carries the last-block flag
+	for i, block := range blocks {
+		if block.blockType == blockTypeSeekTable {
+			e.seekTableOffset = e.bytesWritten - start + 4
+		}
+		if i == cueSheetBlock {
+			// The lead-out is the final track, with no index points
+			e.leadOutOffset = e.bytesWritten - start + 4 + int64(len(block.data)) - cueSheetTrackLength
+		}
+		if err := e.writeMetadataBlock(block.blockType, i == len(blocks)-1, block.data); err != nil {
+			return err
+		}
+	}
+
+	e.headerWritten = true
+	e.headerLength = e.bytesWritten
+	e.streamInfoFinal = e.samplesEncoded > 0
 	return nil
 }
 
+// ensureHeader writes the stream header unless it has already been written
+func (e *Encoder) ensureHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	return e.WriteStreamInfo()
+}
+
+// WriteMetadataOnly writes a stream holding only metadata blocks, such as
+// a STREAMINFO and CUESHEET stub, and closes the encoder. STREAMINFO
+// declares zero total samples and the final block carries the last-block
+// flag, so the result is a valid FLAC stream with no audio frames. It is an
+// error if the header or any audio has already been written.
+func (e *Encoder) WriteMetadataOnly() error {
+	if e.samplesEncoded > 0 || e.streaming {
+		return errors.New("metadata-only stream must not contain audio")
+	}
+	if e.headerWritten {
+		return errors.New("stream header already written")
+	}
+	e.totalSamples = 0
+	if err := e.WriteStreamInfo(); err != nil {
+		return err
+	}
+	e.streamInfoFinal = true
+	return e.Close()
+}
+
+// currentStreamInfo returns STREAMINFO describing the audio encoded so far,
+// including the smallest and largest block actually encoded
+func (e *Encoder) currentStreamInfo() StreamInfo {
+	info := StreamInfo{
+		MinBlockSize:  e.minBlockSize,
+		MaxBlockSize:  e.maxBlockSize,
+		MinFrameSize:  e.minFrameSize,
+		MaxFrameSize:  e.maxFrameSize,
+		SampleRate:    e.streamSampleRate(),
+		Channels:      e.channels,
+		BitsPerSample: e.bitsPerSample,
+		TotalSamples:  e.samplesEncoded,
+	}
+	copy(info.MD5[:], e.md5.Sum(nil))
+	return info
+}
+
 // EncodeFrame encodes a single FLAC frame
 func (e *Encoder) EncodeFrame(samples [][]int32, frameNumber uint64) error {
+	if e.closed {
+		return errClosed
+	}
 	if len(samples) != int(e.channels) {
 		return errors.New("sample count mismatch with channels")
 	}
+	if e.cueSheet != nil && e.headerWritten && !e.seekable && e.totalSamples == 0 {
+		return errors.New("cue sheet lead-out needs the total sample count: use a seekable writer or Encode")
+	}
 
 	blockSize := len(samples[0])
 	for i := 1; i < len(samples); i++ {
@@ -113,27 +581,75 @@ func (e *Encoder) EncodeFrame(samples [][]int32, frameNumber uint64) error {
 		}
 	}
 
-	buf := newBitWriter()
+	codedNumber := frameNumber
+	if e.variableBlockSize {
+		codedNumber = e.samplesEncoded
+	}
+	if e.frameNumberFunc != nil {
+		codedNumber = e.frameNumberFunc(int(frameNumber))
+	}
+	if err := validateCodedNumber(codedNumber, e.variableBlockSize); err != nil {
+		return err
+	}
+	if e.subset {
+		if err := checkSubsetBlockSize(e.streamSampleRate(), blockSize); err != nil {
+			return err
+		}
+	}
+
+	samples, err := e.checkSampleRange(samples, frameNumber)
+	if err != nil {
+		return err
+	}
+	if e.dc != nil {
+		samples = e.dc.apply(samples, frameNumber, e.bitsPerSample)
+	}
+
+	if e.overview != nil {
+		e.overview.update(samples)
+	}
+	if e.usedBits != nil {
+		e.usedBits.update(samples)
+	}
+
+	buf := e.frameBuf
+	buf.reset()
 
 	// Frame header sync code (14 bits): 0b11111111111110
 	buf.writeBits(0x3FFE, 14)
 
 	// Reserved (1 bit) + blocking strategy (1 bit)
-	// 0 = fixed-blocksize stream
-	buf.writeBits(0, 1)
+	// 0 = fixed-blocksize stream, 1 = variable-blocksize stream
 	buf.writeBits(0, 1)
+	if e.variableBlockSize {
+		buf.writeBits(1, 1)
+	} else {
+		buf.writeBits(0, 1)
+	}
 
 	// Block size in inter-channel samples (4 bits)
 	blockSizeCode := getBlockSizeCode(uint32(blockSize))
 	buf.writeBits(uint64(blockSizeCode), 4)
 
 	// Sample rate (4 bits)
-	sampleRateCode := getSampleRateCode(e.sampleRate)
+	sampleRate := e.streamSampleRate()
+	sampleRateCode := getSampleRateCode(sampleRate)
 	buf.writeBits(uint64(sampleRateCode), 4)
 
 	// Channel assignment (4 bits)
-	// 0b0000-0b0111 = independent channels
-	buf.writeBits(uint64(e.channels-1), 4)
+	// 0b0000-0b0111 = 1 to 8 independent channels, 0b1000-0b1010 = stereo
+	// decorrelation, which needs an extra bit for the side channel. FLAC
+	// only defines decorrelation for two channels, so other layouts, such
+	// as 5.1 and 7.1, always code each channel as its own subframe.
+	channelAssignment := uint8(e.channels - 1)
+	if e.channels == 2 && e.bitsPerSample < 32 {
+		if e.stereoMode != 0 {
+			channelAssignment = e.stereoMode
+		} else if e.stereoDecorrelation {
+			channelAssignment = e.chooseStereoAssignment(samples)
+		}
+	}
+	buf.writeBits(uint64(channelAssignment), 4)
 
 	// Sample size (3 bits)
 	sampleSizeCode := getSampleSizeCode(e.bitsPerSample)
@@ -143,7 +659,7 @@ func (e *Encoder) EncodeFrame(samples [][]int32, frameNumber uint64) error {
 	buf.writeBits(0, 1)
 
 	// Frame or sample number (UTF-8 coded)
-	buf.writeUTF8(frameNumber)
+	buf.writeUTF8(codedNumber)
 
 	// Block size if code == 0b0110 or 0b0111
 	if blockSizeCode == 0x06 {
@@ -154,24 +670,29 @@ func (e *Encoder) EncodeFrame(samples [][]int32, frameNumber uint64) error {
 
 	// Sample rate if code needs it
 	if sampleRateCode == 0x0C {
-		buf.writeBits(uint64(e.sampleRate/1000), 8)
+		buf.writeBits(uint64(sampleRate/1000), 8)
 	} else if sampleRateCode == 0x0D {
-		buf.writeBits(uint64(e.sampleRate), 16)
+		buf.writeBits(uint64(sampleRate), 16)
 	} else if sampleRateCode == 0x0E {
-		buf.writeBits(uint64(e.sampleRate/10), 16)
+		buf.writeBits(uint64(sampleRate/10), 16)
 	}
 
 	// Header CRC-8
-	// Make a copy to avoid holding reference to buffer's internal slice
-	// which may be invalidated when buffer grows
-	headerBytes := make([]byte, len(buf.bytes()))
-	copy(headerBytes, buf.bytes())
-	crc8 := calculateCRC8(headerBytes)
+	// Every header field ends on a byte boundary, so no bits are pending
+	// and the buffer holds exactly the header. The CRC is computed before
+	// any more bits are written, so its internal slice can be used directly.
+	crc8 := calculateCRC8(buf.bytes())
 	buf.writeBits(uint64(crc8), 8)
 
+	subframes, sideBits := e.decorrelate(samples, channelAssignment)
+
 	// Encode subframes for each channel
 	for ch := 0; ch < int(e.channels); ch++ {
-		if err := e.encodeSubframe(buf, samples[ch]); err != nil {
+		bitsPerSample := e.bitsPerSample
+		if ch < len(sideBits) {
+			bitsPerSample += sideBits[ch]
+		}
+		if err := e.encodeSubframe(buf, subframes[ch], bitsPerSample); err != nil {
 			return err
 		}
 	}
@@ -180,139 +701,324 @@ func (e *Encoder) EncodeFrame(samples [][]int32, frameNumber uint64) error {
 	buf.alignToByte()
 
 	// Frame CRC-16
-	// Make a copy to avoid holding reference to buffer's internal slice
-	// which may be invalidated when buffer grows
-	frameBytes := make([]byte, len(buf.bytes()))
-	copy(frameBytes, buf.bytes())
-	crc16 := calculateCRC16(frameBytes)
+	// Aligning flushed the last subframe's pending bits, so the buffer
+	// holds every byte of the frame before the CRC itself
+	crc16 := calculateCRC16(buf.bytes())
 	buf.writeBits(uint64(crc16), 16)
 
 	// Write to output
-	if _, err := e.w.Write(buf.bytes()); err != nil {
+	frameOffset := uint64(e.bytesWritten - e.headerLength)
+	frame := buf.bytes()
+	if err := e.write(frame); err != nil {
 		return err
 	}
 
+	// Record a seek point at the first frame of each seek interval, once
+	// the frame is in the stream
+	if n := len(e.seekPoints); n == 0 || e.samplesEncoded >= e.seekPoints[n-1].SampleNumber+e.seekInterval {
+		e.seekPoints = append(e.seekPoints, SeekPoint{
+			SampleNumber: e.samplesEncoded,
+			Offset:       frameOffset,
+			FrameSamples: uint16(blockSize),
+		})
+	}
+
+	// Block sizes include a short final block, so STREAMINFO reports the
+	// true range
+	if e.minBlockSize == 0 || uint16(blockSize) < e.minBlockSize {
+		e.minBlockSize = uint16(blockSize)
+	}
+	if uint16(blockSize) > e.maxBlockSize {
+		e.maxBlockSize = uint16(blockSize)
+	}
+
+	frameSize := uint32(len(frame))
+	if e.minFrameSize == 0 || frameSize < e.minFrameSize {
+		e.minFrameSize = frameSize
+	}
+	if frameSize > e.maxFrameSize {
+		e.maxFrameSize = frameSize
+	}
+	e.streamInfoFinal = false
+	e.md5Buf = writeMD5Samples(e.md5, samples, e.bitsPerSample, e.md5Buf)
+	e.samplesEncoded += uint64(blockSize)
+	e.nextFrameNumber = frameNumber + 1
+
+	if e.stats != nil {
+		e.stats.frame(len(frame), blockSize)
+	}
+	if e.progress != nil {
+		e.progress.frameDone()
+	}
+	if e.packetCallback != nil {
+		e.packetCallback(frame, blockSize)
+	}
+	if e.frameHook != nil {
+		e.frameHook(frame, blockSize)
+	}
+
 	return nil
 }
 
-// encodeSubframe encodes a single subframe using fixed prediction
-func (e *Encoder) encodeSubframe(buf *bitWriter, samples []int32) error {
-	// For simplicity, use fixed predictor order 2
-	order := 2
-
-	// Subframe header: 0 (padding) + subframe type (6 bits) + wasted bits flag (1 bit)
-	buf.writeBits(0, 1)
-	// Subframe type: 0b001xxx for FIXED predictor (xxx = order)
-	buf.writeBits(0x08|uint64(order), 6)
-	buf.writeBits(0, 1) // No wasted bits
+// Limits on the UTF-8 coded number in a frame header: fixed-blocksize
+// streams code a frame number of at most 31 bits, variable-blocksize
+// streams a sample number of at most 36 bits
+const (
+	maxFrameNumber  = 1<<31 - 1
+	maxSampleNumber = 1<<36 - 1
+)
 
-	// Write unencoded warm-up samples
-	for i := 0; i < order; i++ {
-		buf.writeBitsSigned(int64(samples[i]), int(e.bitsPerSample))
+// validateCodedNumber checks that a frame or sample number fits the frame
+// header's UTF-8 coding as the FLAC format allows it
+func validateCodedNumber(number uint64, variableBlockSize bool) error {
+	if variableBlockSize {
+		if number > maxSampleNumber {
+			return errors.New("sample number exceeds 36 bits")
+		}
+	} else if number > maxFrameNumber {
+		return errors.New("frame number exceeds 31 bits")
 	}
+	return nil
+}
 
-	// Calculate residuals
-	residuals := make([]int32, len(samples)-order)
-	for i := order; i < len(samples); i++ {
-		predicted := fixedPredict(samples, i, order)
-		residuals[i-order] = samples[i] - predicted
+// Stereo channel assignments
+const (
+	channelLeftSide  = 0x08
+	channelRightSide = 0x09
+	channelMidSide   = 0x0A
+)
+
+// decorrelate returns the signals to code as subframes for a channel
+// assignment, along with the extra bits each needs over the stream's
+// bits per sample. The transformed signals use the encoder's scratch space.
+func (e *Encoder) decorrelate(samples [][]int32, channelAssignment uint8) ([][]int32, [2]uint8) {
+	if channelAssignment < channelLeftSide {
+		return samples, [2]uint8{}
 	}
 
-	// Encode residuals using Rice coding
-	return e.encodeResidual(buf, residuals)
-}
+	left, right := samples[0], samples[1]
+	n := len(left)
+	for ch := range e.stereo {
+		if cap(e.stereo[ch]) < n {
+			e.stereo[ch] = make([]int32, n)
+		}
+		e.stereo[ch] = e.stereo[ch][:n]
+	}
 
-// fixedPredict performs fixed linear prediction
-func fixedPredict(samples []int32, pos, order int) int32 {
-	switch order {
-	case 0:
-		return 0
-	case 1:
-		return samples[pos-1]
-	case 2:
-		return 2*samples[pos-1] - samples[pos-2]
-	case 3:
-		return 3*samples[pos-1] - 3*samples[pos-2] + samples[pos-3]
-	case 4:
-		return 4*samples[pos-1] - 6*samples[pos-2] + 4*samples[pos-3] - samples[pos-4]
+	switch channelAssignment {
+	case channelLeftSide:
+		for i := range left {
+			e.stereo[1][i] = left[i] - right[i]
+		}
+		e.stereoOut = [2][]int32{left, e.stereo[1]}
+		return e.stereoOut[:], [2]uint8{0, 1}
+	case channelRightSide:
+		for i := range left {
+			e.stereo[0][i] = left[i] - right[i]
+		}
+		e.stereoOut = [2][]int32{e.stereo[0], right}
+		return e.stereoOut[:], [2]uint8{1, 0}
 	default:
-		return 0
+		// Mid drops the low bit of L+R, which the decoder restores from
+		// the side channel
+		for i := range left {
+			e.stereo[0][i] = (left[i] + right[i]) >> 1
+			e.stereo[1][i] = left[i] - right[i]
+		}
+		return e.stereo[:], [2]uint8{0, 1}
 	}
 }
 
-// encodeResidual encodes residuals using Rice coding
-func (e *Encoder) encodeResidual(buf *bitWriter, residuals []int32) error {
-	// Residual coding method: 0b00 = partitioned Rice coding
-	buf.writeBits(0, 2)
+// encodeSubframe encodes a single subframe with the custom predictor if
+// one is set and can code it, else with whichever of the fixed and LPC
+// predictors is estimated to be smallest; either way raw as VERBATIM when
+// prediction would cost more than the samples themselves. Trailing zero
+// bits shared by every sample are shifted out first and signalled as
+// wasted bits.
+func (e *Encoder) encodeSubframe(buf *bitWriter, samples []int32, bitsPerSample uint8) error {
+	samples, wasted := e.removeWastedBits(samples, bitsPerSample)
+	bitsPerSample -= uint8(wasted)
+
+	if e.predictor != nil {
+		if p, bits, ok := e.customLPC(samples, bitsPerSample); ok {
+			if uint64(len(samples))*uint64(bitsPerSample) <= bits {
+				return e.encodeVerbatimSubframe(buf, samples, bitsPerSample, wasted)
+			}
+			return e.encodeLPCSubframe(buf, samples, bitsPerSample, wasted, &p)
+		}
+	}
 
-	// Partition order (4 bits) - 0 = single partition
-	partitionOrder := uint64(0)
-	buf.writeBits(partitionOrder, 4)
+	order, bits := bestFixedOrder(samples, bitsPerSample)
+	lpc, lpcBits, useLPC := e.bestLPC(samples, bitsPerSample)
+	useLPC = useLPC && lpcBits < bits
+	if useLPC {
+		bits = lpcBits
+	}
 
-	// Find optimal Rice parameter
-	riceParam := findOptimalRiceParameter(residuals)
+	// Noise-like or already compressed signals leave residuals that Rice
+	// code larger than the raw samples
+	if uint64(len(samples))*uint64(bitsPerSample) <= bits {
+		return e.encodeVerbatimSubframe(buf, samples, bitsPerSample, wasted)
+	}
+	if useLPC {
+		return e.encodeLPCSubframe(buf, samples, bitsPerSample, wasted, &lpc)
+	}
+	return e.encodeFixedSubframe(buf, samples, bitsPerSample, wasted, order)
+}
 
-	// Rice parameter (4 or 5 bits depending on coding method)
-	buf.writeBits(uint64(riceParam), 4)
+// estimateSubframe returns the estimated size in bits of the subframe
+// encodeSubframe would write for samples
+func (e *Encoder) estimateSubframe(samples []int32, bitsPerSample uint8) uint64 {
+	samples, wasted := e.removeWastedBits(samples, bitsPerSample)
+	bitsPerSample -= uint8(wasted)
 
-	// Encode residuals
-	for _, r := range residuals {
-		encodeRice(buf, r, riceParam)
+	if e.predictor != nil {
+		if _, bits, ok := e.customLPC(samples, bitsPerSample); ok {
+			return min(bits, uint64(len(samples))*uint64(bitsPerSample))
+		}
 	}
+	_, bits := bestFixedOrder(samples, bitsPerSample)
+	if _, lpcBits, ok := e.bestLPC(samples, bitsPerSample); ok {
+		bits = min(bits, lpcBits)
+	}
+	return min(bits, uint64(len(samples))*uint64(bitsPerSample))
+}
 
-	return nil
+// removeWastedBits returns samples shifted right by the number of
+// trailing zero bits they all share, using the encoder's scratch space,
+// together with that number. Samples that are all zero have none.
+func (e *Encoder) removeWastedBits(samples []int32, bitsPerSample uint8) ([]int32, int) {
+	var or int32
+	for _, s := range samples {
+		or |= s
+	}
+	if or == 0 {
+		return samples, 0
+	}
+	wasted := min(bits.TrailingZeros32(uint32(or)), int(bitsPerSample)-1)
+	if wasted == 0 {
+		return samples, 0
+	}
+
+	shifted := e.wasted[:0]
+	for _, s := range samples {
+		shifted = append(shifted, s>>wasted)
+	}
+	e.wasted = shifted
+	return shifted, wasted
 }
 
-// findOptimalRiceParameter finds the optimal Rice parameter
-func findOptimalRiceParameter(residuals []int32) uint8 {
-	if len(residuals) == 0 {
-		return 0
+// writeSubframeHeader writes the subframe header: a zero padding bit, the
+// 6-bit subframe type and the wasted bits flag, followed when set by the
+// wasted bit count minus one in unary
+func writeSubframeHeader(buf *bitWriter, subframeType uint64, wasted int) {
+	buf.writeBits(0, 1)
+	buf.writeBits(subframeType, 6)
+	if wasted == 0 {
+		buf.writeBits(0, 1)
+		return
+	}
+	buf.writeBits(1, 1)
+	for i := 1; i < wasted; i++ {
+		buf.writeBits(0, 1)
 	}
+	buf.writeBits(1, 1)
+}
 
-	// Calculate mean absolute value
-	var sum uint64
-	for _, r := range residuals {
-		if r < 0 {
-			sum += uint64(-r)
-		} else {
-			sum += uint64(r)
-		}
+// encodeVerbatimSubframe writes a VERBATIM subframe holding the samples
+// unencoded
+func (e *Encoder) encodeVerbatimSubframe(buf *bitWriter, samples []int32, bitsPerSample uint8, wasted int) error {
+	// Subframe type: 0b000001 for VERBATIM
+	writeSubframeHeader(buf, 0x01, wasted)
+	if e.stats != nil {
+		e.stats.subframe(SubframeVerbatim)
 	}
-	mean := float64(sum) / float64(len(residuals))
 
-	// Estimate optimal parameter
-	if mean < 1 {
-		return 0
+	for _, s := range samples {
+		buf.writeBitsSigned(int64(s), int(bitsPerSample))
+	}
+	return nil
+}
+
+// encodeFixedSubframe writes a FIXED subframe with the given predictor order
+func (e *Encoder) encodeFixedSubframe(buf *bitWriter, samples []int32, bitsPerSample uint8, wasted, order int) error {
+	// Subframe type: 0b001xxx for FIXED predictor (xxx = order)
+	writeSubframeHeader(buf, 0x08|uint64(order), wasted)
+	if e.stats != nil {
+		e.stats.subframe(SubframeFixed)
 	}
-	param := uint8(math.Log2(mean))
-	if param > 14 {
-		param = 14
+
+	// Write unencoded warm-up samples
+	for i := 0; i < order; i++ {
+		buf.writeBitsSigned(int64(samples[i]), int(bitsPerSample))
 	}
-	return param
+
+	// Encode residuals using Rice coding
+	e.residuals = fixedResiduals(e.residuals, samples, order)
+	return e.encodeResidual(buf, e.residuals, order)
 }
 
-// encodeRice encodes a signed integer using Rice coding
-func encodeRice(buf *bitWriter, value int32, param uint8) {
-	// Convert signed to unsigned (zigzag encoding)
-	var uval uint32
-	if value < 0 {
-		uval = uint32(-2*value - 1)
-	} else {
-		uval = uint32(2 * value)
+// maxFixedOrder is the highest order of the FIXED polynomial predictors
+const maxFixedOrder = 4
+
+// bestFixedOrder picks the fixed predictor order whose subframe is
+// estimated to be smallest: the warm-up samples plus the residuals coded
+// with the Rice parameter best suited to their total magnitude. It returns
+// the order and the estimated size in bits.
+func bestFixedOrder(samples []int32, bitsPerSample uint8) (int, uint64) {
+	bestOrder := 0
+	var bestBits uint64
+	for order := 0; order <= min(maxFixedOrder, len(samples)-1); order++ {
+		var sum uint64
+		for i := order; i < len(samples); i++ {
+			sum += zigzag(int64(samples[i]) - fixedPredict(samples, i, order))
+		}
+		bits := uint64(order)*uint64(bitsPerSample) + estimateRiceBits(sum, uint64(len(samples)-order))
+		if order == 0 || bits < bestBits {
+			bestOrder = order
+			bestBits = bits
+		}
 	}
+	return bestOrder, bestBits
+}
 
-	// Split into quotient and remainder
-	quotient := uval >> param
-	remainder := uval & ((1 << param) - 1)
+// estimateRiceBits estimates the bits needed to Rice code n residuals whose
+// zigzag encoded values add up to sum, using the best single parameter
+func estimateRiceBits(sum, n uint64) uint64 {
+	best := n*1 + sum
+	for param := uint64(1); param <= maxRice2Parameter; param++ {
+		best = min(best, n*(param+1)+sum>>param)
+	}
+	return best
+}
 
-	// Write quotient in unary
-	for i := uint32(0); i < quotient; i++ {
-		buf.writeBits(0, 1)
+// fixedResiduals calculates the fixed prediction residuals of samples,
+// reusing the storage of dst. Residuals are widened to int64 because
+// prediction on 32-bit input can exceed the int32 range.
+func fixedResiduals(dst []int64, samples []int32, order int) []int64 {
+	residuals := dst[:0]
+	for i := order; i < len(samples); i++ {
+		residuals = append(residuals, int64(samples[i])-fixedPredict(samples, i, order))
 	}
-	buf.writeBits(1, 1)
+	return residuals
+}
 
-	// Write remainder in binary
-	buf.writeBits(uint64(remainder), int(param))
+// fixedPredict performs fixed linear prediction
+func fixedPredict(samples []int32, pos, order int) int64 {
+	switch order {
+	case 0:
+		return 0
+	case 1:
+		return int64(samples[pos-1])
+	case 2:
+		return 2*int64(samples[pos-1]) - int64(samples[pos-2])
+	case 3:
+		return 3*int64(samples[pos-1]) - 3*int64(samples[pos-2]) + int64(samples[pos-3])
+	case 4:
+		return 4*int64(samples[pos-1]) - 6*int64(samples[pos-2]) + 4*int64(samples[pos-3]) - int64(samples[pos-4])
+	default:
+		return 0
+	}
 }
 
 // getBlockSizeCode returns the FLAC block size code
@@ -426,7 +1132,11 @@ func calculateCRC8(data []byte) uint8 {
 
 // calculateCRC16 calculates CRC-16 for FLAC frame
 func calculateCRC16(data []byte) uint16 {
-	crc := uint16(0)
+	return updateCRC16(0, data)
+}
+
+// updateCRC16 continues a CRC-16 computation over data
+func updateCRC16(crc uint16, data []byte) uint16 {
 	for _, b := range data {
 		crc ^= uint16(b) << 8
 		for i := 0; i < 8; i++ {
@@ -440,15 +1150,92 @@ func calculateCRC16(data []byte) uint16 {
 	return crc
 }
 
-// Encode encodes PCM audio data to FLAC
-func (e *Encoder) Encode(samples [][]int32) error {
+// Encode encodes PCM audio data to FLAC. Unless the stream header has
+// already been written, STREAMINFO is completed with the total samples,
+// block and frame sizes and the MD5 signature of the audio. These are only
+// known once every frame is encoded, so if the writer is an io.WriteSeeker
+// STREAMINFO is rewritten in place afterwards; otherwise Encode buffers
+// the encoded frames in memory and writes them after the header.
+//
+// samples must hold one slice per channel. Channels of length zero are
+// allowed and give a valid stream with no audio frames.
+func (e *Encoder) Encode(samples [][]int32) (err error) {
+	if e.closed {
+		return errClosed
+	}
+	if len(samples) == 0 {
+		return errors.New("no channels of samples to encode")
+	}
+	if e.inputChecksum {
+		input := samples
+		before := checksumSamples(input)
+		defer func() {
+			if err == nil && checksumSamples(input) != before {
+				err = errInputMutated
+			}
+		}()
+	}
+
+	if len(samples) != int(e.channels) {
+		return fmt.Errorf("got %d channels of samples, encoder has %d", len(samples), e.channels)
+	}
+	samples, err = e.equalizeChannelLengths(samples)
+	if err != nil {
+		return err
+	}
+	if !e.headerWritten {
+		e.totalSamples = uint64(len(samples[0]))
+	}
+
+	return e.encodeComplete(func() error { return e.encodeBlocks(samples) })
+}
+
+// encodeComplete runs encode, which encodes a whole stream of frames, so
+// that STREAMINFO is written complete: the header is rewritten in place
+// afterwards if the writer can seek, otherwise the frames are buffered
+// until the header has been written. If the header is already out, encode
+// simply runs.
+func (e *Encoder) encodeComplete(encode func() error) (err error) {
+	if e.headerWritten {
+		return encode()
+	}
+	if _, ok := e.streamOffset(); ok {
+		if err := e.WriteStreamInfo(); err != nil {
+			return err
+		}
+		if err := encode(); err != nil {
+			return err
+		}
+		return e.rewriteStreamInfo(e.w.(io.WriteSeeker))
+	}
+
+	// Hold the frames back until STREAMINFO is complete. Seek point
+	// offsets are relative to the first frame, so they are unaffected.
+	out := e.w
+	var frames bytes.Buffer
+	e.w = &frames
+	err = encode()
+	e.w = out
+	if err != nil {
+		return err
+	}
+	e.bytesWritten = 0
 	if err := e.WriteStreamInfo(); err != nil {
 		return err
 	}
+	return e.write(frames.Bytes())
+}
 
+// encodeBlocks splits samples into blocks and encodes each as a frame
+func (e *Encoder) encodeBlocks(samples [][]int32) error {
 	blockSize := int(e.blockSize)
 	totalBlocks := (len(samples[0]) + blockSize - 1) / blockSize
 
+	if e.progress != nil {
+		e.progress.begin(totalBlocks)
+		defer e.progress.end()
+	}
+
 	for blockNum := 0; blockNum < totalBlocks; blockNum++ {
 		start := blockNum * blockSize
 		end := start + blockSize
@@ -457,15 +1244,259 @@ func (e *Encoder) Encode(samples [][]int32) error {
 		}
 
 		// Extract block samples for all channels
-		blockSamples := make([][]int32, e.channels)
+		e.block = e.block[:0]
 		for ch := 0; ch < int(e.channels); ch++ {
-			blockSamples[ch] = samples[ch][start:end]
+			e.block = append(e.block, samples[ch][start:end])
 		}
 
-		if err := e.EncodeFrame(blockSamples, uint64(blockNum)); err != nil {
+		if err := e.EncodeFrame(e.block, uint64(blockNum)); err != nil {
 			return err
 		}
 	}
 
+	e.finish()
+	return nil
+}
+
+// equalizeChannelLengths checks that all channels hold the same number of
+// samples, zero filling short channels if the encoder is configured to
+func (e *Encoder) equalizeChannelLengths(samples [][]int32) ([][]int32, error) {
+	longest := 0
+	ragged := -1
+	for ch := range samples {
+		if ch > 0 && len(samples[ch]) != longest && ragged < 0 {
+			ragged = ch
+		}
+		longest = max(longest, len(samples[ch]))
+	}
+	if ragged < 0 {
+		return samples, nil
+	}
+	if !e.zeroFill {
+		return nil, fmt.Errorf("all channels must have the same number of samples: channel %d has %d, channel 0 has %d",
+			ragged, len(samples[ragged]), len(samples[0]))
+	}
+
+	padded := make([][]int32, len(samples))
+	for ch := range samples {
+		if len(samples[ch]) == longest {
+			padded[ch] = samples[ch]
+			continue
+		}
+		padded[ch] = make([]int32, longest)
+		copy(padded[ch], samples[ch])
+	}
+	return padded, nil
+}
+
+// AssembleStream writes a FLAC stream made of a STREAMINFO block followed by
+// already encoded frames, such as those returned by (*Decoder).NextRawFrame
+func AssembleStream(w io.Writer, info StreamInfo, frames [][]byte) error {
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+
+	// STREAMINFO is the only, and therefore last, metadata block
+	header := []byte{0x80, 0, 0, streamInfoLength}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(info.marshal()); err != nil {
+		return err
+	}
+
+	for _, frame := range frames {
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeChannel encodes blocks received from ch until it is closed. Each
+// received value is one block of samples ([channels][samples]) and becomes
+// one frame, so every block except the last must hold exactly the encoder's
+// block size.
+func (e *Encoder) EncodeChannel(ch <-chan [][]int32) error {
+	if err := e.ensureHeader(); err != nil {
+		return err
+	}
+
+	var frameNumber uint64
+	shortBlockSeen := false
+	for block := range ch {
+		if shortBlockSeen {
+			return errors.New("only the last block may be shorter than the block size")
+		}
+		if len(block) > 0 && len(block[0]) != int(e.blockSize) {
+			if len(block[0]) == 0 || len(block[0]) > int(e.blockSize) {
+				return errors.New("block length must be between 1 and the block size")
+			}
+			shortBlockSeen = true
+		}
+
+		if err := e.EncodeFrame(block, frameNumber); err != nil {
+			return err
+		}
+		frameNumber++
+	}
+
+	e.finish()
+	return nil
+}
+
+// WriteSamples pushes samples ([channels][samples]) into the encoder,
+// encoding a frame each time a full block has accumulated. Any number of
+// samples may be written per call. The stream header is written before the
+// first frame, so frames never precede STREAMINFO, and Close encodes the
+// remaining samples as a final short frame. Frame numbers run on across
+// calls, so on a seekable writer, where Close completes STREAMINFO, the
+// stream is identical to Encode of all the samples at once. In packet mode,
+// set by WithPacketCallback, each call is instead encoded as exactly one
+// frame.
+func (e *Encoder) WriteSamples(samples [][]int32) error {
+	if e.closed {
+		return errClosed
+	}
+	if len(samples) != int(e.channels) {
+		return errors.New("sample count mismatch with channels")
+	}
+	for ch := 1; ch < len(samples); ch++ {
+		if len(samples[ch]) != len(samples[0]) {
+			return errors.New("all channels must have the same number of samples")
+		}
+	}
+	if e.packetCallback != nil {
+		return e.writePacket(samples)
+	}
+
+	if e.pending == nil {
+		e.pending = make([][]int32, e.channels)
+	}
+	e.streaming = true
+
+	blockSize := int(e.blockSize)
+	for ch := range samples {
+		e.pending[ch] = append(e.pending[ch], samples[ch]...)
+	}
+	if len(e.pending[0]) < blockSize {
+		return nil
+	}
+
+	if err := e.ensureHeader(); err != nil {
+		return err
+	}
+	consumed := 0
+	for len(e.pending[0])-consumed >= blockSize {
+		e.block = e.block[:0]
+		for ch := range e.pending {
+			e.block = append(e.block, e.pending[ch][consumed:consumed+blockSize])
+		}
+		if err := e.EncodeFrame(e.block, e.nextFrameNumber); err != nil {
+			return err
+		}
+		consumed += blockSize
+	}
+	for ch := range e.pending {
+		e.pending[ch] = append(e.pending[ch][:0], e.pending[ch][consumed:]...)
+	}
+	return nil
+}
+
+// WriteSamplesSplit is WriteSamples for audio that wraps around a ring
+// buffer: the samples of first are followed by those of second, as if the
+// two were one contiguous write, without the caller joining them. second
+// may be empty when the data does not wrap.
+func (e *Encoder) WriteSamplesSplit(first, second [][]int32) error {
+	if len(second) == 0 {
+		return e.WriteSamples(first)
+	}
+	if len(first) != int(e.channels) || len(second) != int(e.channels) {
+		return errors.New("sample count mismatch with channels")
+	}
+	for ch := 1; ch < len(first); ch++ {
+		if len(first[ch]) != len(first[0]) || len(second[ch]) != len(second[0]) {
+			return errors.New("all channels must have the same number of samples")
+		}
+	}
+	if err := e.WriteSamples(first); err != nil {
+		return err
+	}
+	return e.WriteSamples(second)
+}
+
+// flushPending writes the stream header if WriteSamples has not yet done so
+// and encodes any samples it left buffered
+func (e *Encoder) flushPending() error {
+	if !e.streaming {
+		return nil
+	}
+	if err := e.ensureHeader(); err != nil {
+		return err
+	}
+	if len(e.pending[0]) == 0 {
+		return nil
+	}
+	if err := e.EncodeFrame(e.pending, e.nextFrameNumber); err != nil {
+		return err
+	}
+	for ch := range e.pending {
+		e.pending[ch] = e.pending[ch][:0]
+	}
+	return nil
+}
+
+// flusher is implemented by buffered writers such as *bufio.Writer
+type flusher interface {
+	Flush() error
+}
+
+// finish performs the end of stream bookkeeping once all frames have been
+// encoded
+func (e *Encoder) finish() {
+	if e.overview != nil {
+		e.overview.flush()
+	}
+	if e.usedBits != nil {
+		e.usedBits.flush(e.channels)
+	}
+}
+
+// errClosed reports a call made after the encoder was closed
+var errClosed = errors.New("encoder is closed")
+
+// Close finishes the stream. It encodes any samples still buffered by
+// WriteSamples, flushes the underlying writer if it is buffered, completes
+// STREAMINFO in place if the writer can seek and then calls the end of
+// stream callback, if any. Once it has succeeded the encoder accepts no
+// more audio, and Close itself must not be called again.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return errClosed
+	}
+	err := e.flushPending()
+	e.closed = true
+	if err != nil {
+		return err
+	}
+	e.finish()
+	if e.stats != nil {
+		e.stats.finalize(e.bytesWritten, e.channels)
+	}
+
+	if f, ok := e.w.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if e.seekable && !e.streamInfoFinal {
+		if err := e.rewriteStreamInfo(e.w.(io.WriteSeeker)); err != nil {
+			return err
+		}
+	}
+
+	if e.eosCallback != nil {
+		e.eosCallback()
+	}
 	return nil
 }
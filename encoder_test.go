@@ -1,8 +1,16 @@
 package goflac
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -190,3 +198,1200 @@ func TestBitWriter_AlignToByte(t *testing.T) {
 		t.Errorf("Expected 0xE0, got 0x%02X", result[0])
 	}
 }
+
+func TestBitWriter_WideWrites(t *testing.T) {
+	bw := newBitWriter()
+	rng := rand.New(rand.NewPCG(7, 32))
+
+	// Reference: one bool per bit, packed at the end
+	var bits []bool
+	widths := []int{7, 32, 7, 32, 1, 64, 7, 57, 3, 33, 7, 64}
+	for i := 0; i < 1000; i++ {
+		n := widths[i%len(widths)]
+		value := rng.Uint64()
+		bw.writeBits(value, n)
+		for b := n - 1; b >= 0; b-- {
+			bits = append(bits, value>>b&1 == 1)
+		}
+	}
+	bw.alignToByte()
+
+	expected := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			expected[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	if !bytes.Equal(bw.bytes(), expected) {
+		t.Fatalf("Bit stream mismatch: %d bytes written, %d expected", len(bw.bytes()), len(expected))
+	}
+}
+
+func TestEncoder_AdvertisedSampleRate(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 0.1, 44100, 1, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, wavReader.SampleRate(), 1, 16, WithAdvertisedSampleRate(48000))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.SampleRate() != 48000 {
+		t.Errorf("Expected advertised sample rate 48000, got %d", decoder.SampleRate())
+	}
+
+	// The first frame header follows the 42-byte stream header; the low
+	// nibble of its third byte is the sample rate code
+	frameHeader := flacBuf.Bytes()[42:]
+	if code := frameHeader[2] & 0x0F; code != 0x0A {
+		t.Errorf("Expected frame sample rate code 0x0A (48kHz), got 0x%X", code)
+	}
+}
+
+func TestEncoder_InvalidAdvertisedSampleRate(t *testing.T) {
+	var buf bytes.Buffer
+
+	if _, err := NewEncoder(&buf, 44100, 2, 16, WithAdvertisedSampleRate(0)); err == nil {
+		t.Error("Expected error for advertised sample rate 0")
+	}
+
+	if _, err := NewEncoder(&buf, 44100, 2, 16, WithAdvertisedSampleRate(1<<20)); err == nil {
+		t.Error("Expected error for advertised sample rate that does not fit in 20 bits")
+	}
+}
+
+func TestEncoder_SampleRateRepresentation(t *testing.T) {
+	cases := []struct {
+		rate  uint32
+		valid bool
+	}{
+		{0, false},
+		{8000, true},
+		{11025, true},
+		{16000, true},
+		{22050, true},
+		{24000, true},
+		{32000, true},
+		{44100, true},
+		{48000, true},
+		{88200, true},
+		{96000, true},
+		{176400, true},
+		{192000, true},
+		{44056, true},      // custom rate coded in Hz
+		{65535, true},      // largest rate coded in Hz
+		{65536, false},     // tens of Hz would round
+		{65540, true},      // exact in tens of Hz
+		{65541, false},     // tens of Hz would round
+		{255000, true},     // largest rate coded in kHz
+		{256000, true},     // exact in tens of Hz
+		{655350, true},     // largest rate coded in tens of Hz
+		{655360, false},    // tens of Hz overflows 16 bits
+		{700001, false},    // no exact frame header encoding
+		{1_000_000, false}, // too large for tens of Hz
+		{1 << 20, false},
+	}
+
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, tc.rate, 1, 16)
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("Expected error for sample rate %d", tc.rate)
+			} else if tc.rate != 0 && !strings.Contains(err.Error(), fmt.Sprint(tc.rate)) {
+				t.Errorf("Expected the error for sample rate %d to name it, got %q", tc.rate, err)
+			}
+			if _, err := NewEncoder(&buf, 44100, 1, 16, WithAdvertisedSampleRate(tc.rate)); err == nil {
+				t.Errorf("Expected error for advertised sample rate %d", tc.rate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for sample rate %d: %v", tc.rate, err)
+			continue
+		}
+
+		if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		if _, err := decoder.ReadFrame(); err != nil {
+			t.Errorf("Failed to decode frame at sample rate %d: %v", tc.rate, err)
+		}
+		if decoder.SampleRate() != tc.rate {
+			t.Errorf("Expected sample rate %d, got %d", tc.rate, decoder.SampleRate())
+		}
+	}
+}
+
+func TestEncoder_EncodeChannel(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 0.5, 44100, 2, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var batchBuf bytes.Buffer
+	batchEncoder, err := NewEncoder(&batchBuf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := batchEncoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	// Produce 4096-sample blocks from a separate goroutine
+	blocks := make(chan [][]int32)
+	go func() {
+		defer close(blocks)
+		for start := 0; start < len(samples[0]); start += 4096 {
+			end := min(start+4096, len(samples[0]))
+			blocks <- [][]int32{samples[0][start:end], samples[1][start:end]}
+		}
+	}()
+
+	var channelBuf bytes.Buffer
+	channelEncoder, err := NewEncoder(&channelBuf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := channelEncoder.EncodeChannel(blocks); err != nil {
+		t.Fatalf("Failed to encode from channel: %v", err)
+	}
+
+	// The streamed header cannot know the totals Encode fills in, but the
+	// frames must match
+	header := channelEncoder.headerLength
+	if !bytes.Equal(channelBuf.Bytes()[header:], batchBuf.Bytes()[header:]) {
+		t.Error("Channel encoding output differs from batch Encode output")
+	}
+}
+
+func TestEncoder_EncodeChannelShortBlockNotLast(t *testing.T) {
+	blocks := make(chan [][]int32, 2)
+	blocks <- [][]int32{make([]int32, 100)}
+	blocks <- [][]int32{make([]int32, 4096)}
+	close(blocks)
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeChannel(blocks); err == nil {
+		t.Error("Expected error for a short block before the last block")
+	}
+}
+
+func TestFixedResiduals_NoOverflow32Bit(t *testing.T) {
+	// Alternating full-scale 32-bit samples drive order-4 prediction far
+	// outside the int32 range
+	samples := make([]int32, 16)
+	for i := range samples {
+		if i%2 == 0 {
+			samples[i] = math.MaxInt32
+		} else {
+			samples[i] = math.MinInt32
+		}
+	}
+
+	residuals := fixedResiduals(nil, samples, 4)
+	for i, r := range residuals {
+		pos := i + 4
+		s := func(k int) int64 { return int64(samples[pos-k]) }
+		expected := int64(samples[pos]) - (4*s(1) - 6*s(2) + 4*s(3) - s(4))
+		if r != expected {
+			t.Fatalf("Residual %d: expected %d, got %d", i, expected, r)
+		}
+		if r >= math.MinInt32 && r <= math.MaxInt32 {
+			t.Fatalf("Residual %d unexpectedly fits in int32: %d", i, r)
+		}
+	}
+}
+
+func TestEncoder_32BitRoundTrip(t *testing.T) {
+	samples := [][]int32{make([]int32, 16)}
+	for i := range samples[0] {
+		if i%2 == 0 {
+			samples[0][i] = math.MaxInt32
+		} else {
+			samples[0][i] = math.MinInt32
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 32)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_EOSCallback(t *testing.T) {
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+
+	calls := 0
+	var flushedLen int
+	encoder, err := NewEncoder(out, 44100, 1, 16, WithEOSCallback(func() {
+		calls++
+		flushedLen = buf.Len()
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	samples := [][]int32{make([]int32, 10000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 100)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("Callback fired before Close")
+	}
+
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+	if err := encoder.Close(); err != errClosed {
+		t.Fatalf("Expected second Close to fail with %v, got %v", errClosed, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected callback to fire once, fired %d times", calls)
+	}
+
+	// The final frame must already be flushed when the callback runs
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()[:flushedLen]))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_UseAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	samples := [][]int32{make([]int32, 5000)}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+	closed := buf.Len()
+
+	if err := encoder.Close(); err != errClosed {
+		t.Errorf("Expected second Close to fail with %v, got %v", errClosed, err)
+	}
+	if err := encoder.WriteSamples(samples); err != errClosed {
+		t.Errorf("Expected WriteSamples to fail with %v, got %v", errClosed, err)
+	}
+	if err := encoder.EncodeFrame(samples, 2); err != errClosed {
+		t.Errorf("Expected EncodeFrame to fail with %v, got %v", errClosed, err)
+	}
+	if err := encoder.Encode(samples); err != errClosed {
+		t.Errorf("Expected Encode to fail with %v, got %v", errClosed, err)
+	}
+	if buf.Len() != closed {
+		t.Errorf("Expected nothing written after Close, output grew from %d to %d bytes", closed, buf.Len())
+	}
+
+	decoded, _, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_BytesWritten(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 1.0, 2)
+
+	// Encode to a buffer, which holds frames back until STREAMINFO is known
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if got := encoder.BytesWritten(); got != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), got)
+	}
+
+	// Stream to a seeker, where Close rewrites STREAMINFO in place
+	ws := &memSeeker{}
+	encoder, err = NewEncoder(ws, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	for start := 0; start < len(samples[0]); start += 5000 {
+		end := min(start+5000, len(samples[0]))
+		if err := encoder.WriteSamples([][]int32{samples[0][start:end], samples[1][start:end]}); err != nil {
+			t.Fatalf("Failed to write samples: %v", err)
+		}
+		if got := encoder.BytesWritten(); got != int64(len(ws.data)) {
+			t.Errorf("After %d samples: expected %d bytes written, got %d", end, len(ws.data), got)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if got := encoder.BytesWritten(); got != int64(len(ws.data)) {
+		t.Errorf("Expected %d bytes written, got %d", len(ws.data), got)
+	}
+}
+
+func TestEncoder_EncodeEmptyInput(t *testing.T) {
+	for _, samples := range [][][]int32{nil, {}} {
+		encoder, err := NewEncoder(io.Discard, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.Encode(samples); err == nil {
+			t.Errorf("Expected error for %#v", samples)
+		}
+	}
+
+	// Empty channels make a valid stream with no frames
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode([][]int32{{}, {}}); err != nil {
+		t.Fatalf("Failed to encode empty channels: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if buf.Len() != 42 {
+		t.Errorf("Expected a 42-byte stream header only, got %d bytes", buf.Len())
+	}
+	decoded, info, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if info.TotalSamples != 0 || len(decoded) != 2 || len(decoded[0]) != 0 || len(decoded[1]) != 0 {
+		t.Errorf("Expected two empty channels, got %d channels and %d total samples", len(decoded), info.TotalSamples)
+	}
+}
+
+func TestEncoder_ZeroFillShortChannels(t *testing.T) {
+	samples := [][]int32{make([]int32, 5000), make([]int32, 3000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 200)
+	}
+	for i := range samples[1] {
+		samples[1][i] = int32(-(i % 300))
+	}
+
+	var strictBuf bytes.Buffer
+	strict, err := NewEncoder(&strictBuf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := strict.Encode(samples); err == nil {
+		t.Error("Expected error for ragged channels without zero fill")
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16, WithZeroFillShortChannels(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	expected := [][]int32{samples[0], make([]int32, 5000)}
+	copy(expected[1], samples[1])
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestEncoder_EncodeFrameAllocations(t *testing.T) {
+	encoder, err := NewEncoder(io.Discard, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	block := [][]int32{make([]int32, 4096), make([]int32, 4096)}
+	for i := range block[0] {
+		block[0][i] = int32(i%500) - 250
+		block[1][i] = int32(i%300) - 150
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := encoder.EncodeFrame(block, 0); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("Expected no allocations per frame in steady state, got %.1f", allocs)
+	}
+}
+
+func BenchmarkEncodeFrame(b *testing.B) {
+	for _, bitsPerSample := range []uint8{16, 24} {
+		b.Run(fmt.Sprintf("%dbit", bitsPerSample), func(b *testing.B) {
+			encoder, err := NewEncoder(io.Discard, 44100, 2, bitsPerSample)
+			if err != nil {
+				b.Fatalf("Failed to create encoder: %v", err)
+			}
+
+			// A tone with a little noise, as music leaves after prediction
+			rng := rand.New(rand.NewPCG(4, 96))
+			scale := float64(int32(1)<<(bitsPerSample-2) - 1)
+			block := [][]int32{make([]int32, 4096), make([]int32, 4096)}
+			for i := range block[0] {
+				v := scale * math.Sin(2*math.Pi*440*float64(i)/44100)
+				block[0][i] = int32(v) + rng.Int32N(64) - 32
+				block[1][i] = int32(v*0.8) + rng.Int32N(64) - 32
+			}
+
+			b.SetBytes(int64(len(block)*len(block[0])) * int64(bitsPerSample) / 8)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := encoder.EncodeFrame(block, 0); err != nil {
+					b.Fatalf("Failed to encode frame: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoder_ScratchReuseIdenticalOutput(t *testing.T) {
+	// Blocks of different content and length exercise buffer reuse
+	blocks := [][][]int32{
+		{make([]int32, 4096)},
+		{make([]int32, 4096)},
+		{make([]int32, 1000)},
+	}
+	for b, block := range blocks {
+		for i := range block[0] {
+			block[0][i] = int32((i * (b + 3)) % 2000)
+		}
+	}
+
+	var reused bytes.Buffer
+	encoder, err := NewEncoder(&reused, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	var fresh bytes.Buffer
+	for n, block := range blocks {
+		if err := encoder.EncodeFrame(block, uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+
+		single, err := NewEncoder(&fresh, 44100, 1, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := single.EncodeFrame(block, uint64(n)); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+
+	if !bytes.Equal(reused.Bytes(), fresh.Bytes()) {
+		t.Error("Reusing scratch buffers changed the encoded output")
+	}
+}
+
+func TestEncoder_MinimumSampleValue(t *testing.T) {
+	for _, bits := range []uint8{16, 24, 32} {
+		minValue := int32(-1 << (bits - 1))
+		maxValue := int32(1<<(bits-1) - 1)
+
+		// Deep negative runs, full-scale swings and sign changes around zero.
+		// 32-bit blocks are kept short since their residuals are huge.
+		length := 4096
+		if bits == 32 {
+			length = 48
+		}
+		block := make([]int32, length)
+		pattern := []int32{minValue, minValue, maxValue, minValue, 0, -1, minValue, 1, maxValue, maxValue}
+		for i := range block {
+			block[i] = pattern[i%len(pattern)]
+		}
+		samples := [][]int32{block, make([]int32, length)}
+		for i := range samples[1] {
+			samples[1][i] = minValue
+		}
+
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 2, bits)
+		if err != nil {
+			t.Fatalf("%d-bit: failed to create encoder: %v", bits, err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("%d-bit: failed to encode FLAC: %v", bits, err)
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%d-bit: failed to create decoder: %v", bits, err)
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("%d-bit: failed to decode: %v", bits, err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+}
+
+func TestBitWriter_SignedMinimum(t *testing.T) {
+	for _, n := range []int{8, 16, 24, 32} {
+		minValue := int64(-1) << (n - 1)
+
+		bw := newBitWriter()
+		bw.writeBitsSigned(minValue, n)
+		bw.writeBitsSigned(-minValue-1, n)
+
+		br := newBitReader(bytes.NewReader(bw.bytes()))
+		got, err := br.readBitsSigned(n)
+		if err != nil || got != minValue {
+			t.Errorf("%d bits: expected %d, got %d (%v)", n, minValue, got, err)
+		}
+		got, err = br.readBitsSigned(n)
+		if err != nil || got != -minValue-1 {
+			t.Errorf("%d bits: expected %d, got %d (%v)", n, -minValue-1, got, err)
+		}
+	}
+}
+
+func TestEncodeRice_ExtremeValues(t *testing.T) {
+	values := []int64{0, -1, 1, math.MinInt32, math.MaxInt32, -1 << 35, 1<<35 - 1}
+	for _, param := range []uint8{14, 30} {
+		bw := newBitWriter()
+		for _, v := range values {
+			encodeRice(bw, v, param)
+		}
+		bw.alignToByte()
+
+		br := newBitReader(bytes.NewReader(bw.bytes()))
+		for _, v := range values {
+			quotient, err := br.readUnary()
+			if err != nil {
+				t.Fatalf("Failed to read quotient: %v", err)
+			}
+			remainder, err := br.readBits(int(param))
+			if err != nil {
+				t.Fatalf("Failed to read remainder: %v", err)
+			}
+			uval := quotient<<param | remainder
+			got := int64(uval>>1) ^ -int64(uval&1)
+			if got != v {
+				t.Errorf("Param %d: expected %d, got %d", param, v, got)
+			}
+		}
+	}
+}
+
+func TestEncoder_WriteStreamInfoOnce(t *testing.T) {
+	samples := [][]int32{make([]int32, 5000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 1000)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write stream info: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err == nil {
+		t.Error("Expected error writing stream info twice")
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	data := buf.Bytes()
+	if n := bytes.Count(data, []byte("fLaC")); n != 1 {
+		t.Errorf("Expected one fLaC signature, found %d", n)
+	}
+	// The first frame must follow the single STREAMINFO block directly
+	if data[42] != 0xFF || data[43] != 0xF8 {
+		t.Errorf("Expected frame sync after STREAMINFO, got 0x%02X%02X", data[42], data[43])
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_FrameNumberLimit(t *testing.T) {
+	block := [][]int32{make([]int32, 4096)}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write stream info: %v", err)
+	}
+	if err := encoder.EncodeFrame(block, maxFrameNumber); err != nil {
+		t.Fatalf("Failed to encode frame at the frame number limit: %v", err)
+	}
+	if err := encoder.EncodeFrame(block, maxFrameNumber+1); err == nil {
+		t.Error("Expected error for a frame number above 31 bits")
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoder.frame.reset()
+	header, err := decoder.readFrameHeader(&decoder.frame)
+	if err != nil {
+		t.Fatalf("Failed to read frame header: %v", err)
+	}
+	if header.number != maxFrameNumber {
+		t.Errorf("Expected frame number %d, got %d", maxFrameNumber, header.number)
+	}
+
+	if err := validateCodedNumber(maxSampleNumber, true); err != nil {
+		t.Errorf("Unexpected error for a sample number at the limit: %v", err)
+	}
+	if err := validateCodedNumber(maxSampleNumber+1, true); err == nil {
+		t.Error("Expected error for a sample number above 36 bits")
+	}
+}
+
+func TestBitWriter_UTF8Boundaries(t *testing.T) {
+	values := []uint64{0, 0x7F, 0x80, 0x7FF, 0x800, 0xFFFF, 0x10000, 0x1FFFFF,
+		0x200000, 0x3FFFFFF, 0x4000000, maxFrameNumber, maxFrameNumber + 1, maxSampleNumber}
+
+	bw := newBitWriter()
+	for _, v := range values {
+		bw.writeUTF8(v)
+	}
+
+	br := newBitReader(bytes.NewReader(bw.bytes()))
+	for _, v := range values {
+		got, err := br.readUTF8()
+		if err != nil {
+			t.Fatalf("Failed to read %d: %v", v, err)
+		}
+		if got != v {
+			t.Errorf("Expected %d, got %d", v, got)
+		}
+	}
+}
+
+func TestEncoder_StreamInfoBlockSizeRange(t *testing.T) {
+	for _, tc := range []struct {
+		samples  int
+		minBlock uint16
+	}{
+		{2*4096 + 904, 904}, // short final block
+		{3 * 4096, 4096},    // only full blocks
+	} {
+		path := filepath.Join(t.TempDir(), "out.flac")
+		if err := EncodeToFile(path, 44100, 16, [][]int32{make([]int32, tc.samples)}); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open output: %v", err)
+		}
+		decoder, err := NewDecoder(f)
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		info := decoder.StreamInfo()
+		f.Close()
+
+		if info.MinBlockSize != tc.minBlock || info.MaxBlockSize != 4096 {
+			t.Errorf("%d samples: expected block sizes %d-4096, got %d-%d",
+				tc.samples, tc.minBlock, info.MinBlockSize, info.MaxBlockSize)
+		}
+	}
+}
+
+func TestEncoder_WriteSamplesHeaderFirst(t *testing.T) {
+	block := [][]int32{make([]int32, 4096), make([]int32, 4096)}
+	for i := range block[0] {
+		block[0][i] = int32(i%100) - 50
+		block[1][i] = int32(i%70) - 35
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	// A full block as the very first action is encoded immediately
+	if err := encoder.WriteSamples(block); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	data := buf.Bytes()
+	if len(data) < 42 || string(data[:4]) != "fLaC" {
+		t.Fatalf("Expected output to begin with fLaC, got %q", data[:min(len(data), 4)])
+	}
+	if data[4]&0x7F != blockTypeStreamInfo || data[7] != streamInfoLength {
+		t.Fatalf("Expected a STREAMINFO block after the signature, got header %x", data[4:8])
+	}
+	if encoder.NextFrameNumber() != 1 {
+		t.Errorf("Expected one frame to be encoded, got %d", encoder.NextFrameNumber())
+	}
+
+	// A partial block waits for Close
+	tail := [][]int32{block[0][:1000], block[1][:1000]}
+	if err := encoder.WriteSamples(tail); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if encoder.NextFrameNumber() != 1 {
+		t.Errorf("Expected the partial block to be buffered")
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	expected := [][]int32{
+		append(append([]int32(nil), block[0]...), tail[0]...),
+		append(append([]int32(nil), block[1]...), tail[1]...),
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestEncoder_WriteSamplesShortStream(t *testing.T) {
+	// Fewer samples than a block still produce a header and one frame
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	samples := [][]int32{{1, 2, 3, 4, 5, 6, 7, 8}}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written before a block is ready, got %d bytes", buf.Len())
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_WriteSamplesSplit(t *testing.T) {
+	samples := [][]int32{make([]int32, 10000), make([]int32, 10000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%100) - 50
+		samples[1][i] = int32(i%70) - 35
+	}
+
+	var joined bytes.Buffer
+	encoder, err := NewEncoder(&joined, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// Wrap the ring buffer at 3000 samples, inside the first block, and
+	// again at 7000, inside the second
+	var split bytes.Buffer
+	encoder, err = NewEncoder(&split, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	first := [][]int32{samples[0][:3000], samples[1][:3000]}
+	second := [][]int32{samples[0][3000:5000], samples[1][3000:5000]}
+	if err := encoder.WriteSamplesSplit(first, second); err != nil {
+		t.Fatalf("Failed to write split samples: %v", err)
+	}
+	if encoder.NextFrameNumber() != 1 {
+		t.Errorf("Expected the block spanning the split to be encoded, got %d frames", encoder.NextFrameNumber())
+	}
+	first = [][]int32{samples[0][5000:7000], samples[1][5000:7000]}
+	second = [][]int32{samples[0][7000:], samples[1][7000:]}
+	if err := encoder.WriteSamplesSplit(first, second); err != nil {
+		t.Fatalf("Failed to write split samples: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if !bytes.Equal(split.Bytes(), joined.Bytes()) {
+		t.Error("Split writes differ from a single contiguous write")
+	}
+
+	// Mismatched channel counts are rejected before anything is buffered
+	encoder, err = NewEncoder(io.Discard, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamplesSplit(first, second[:1]); err == nil {
+		t.Error("Expected an error for mismatched channel counts")
+	}
+}
+
+func TestEncoder_TotalSamples(t *testing.T) {
+	samples := [][]int32{make([]int32, 10001), make([]int32, 10001)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%100) - 50
+		samples[1][i] = int32(i%70) - 35
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	// The 36-bit total follows sample rate, channels and bit depth in the
+	// STREAMINFO body
+	body := buf.Bytes()[8:42]
+	total := uint64(body[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(body[14:18]))
+	if total != 10001 {
+		t.Errorf("Expected 10001 total samples in STREAMINFO, got %d", total)
+	}
+
+	// Channels of different lengths are rejected before anything is written
+	buf.Reset()
+	encoder, err = NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode([][]int32{samples[0], samples[1][:100]}); err == nil {
+		t.Error("Expected an error for channels of different lengths")
+	}
+	if err := encoder.Encode(samples[:1]); err == nil {
+		t.Error("Expected an error for the wrong number of channels")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written, got %d bytes", buf.Len())
+	}
+}
+
+func TestEncoder_VerbatimFallback(t *testing.T) {
+	// Full-scale white noise cannot be predicted, so storing it raw is
+	// smaller than any Rice coded residual
+	rng := rand.New(rand.NewPCG(5, 6))
+	samples := [][]int32{make([]int32, 10000)}
+	for i := range samples[0] {
+		samples[0][i] = rng.Int32N(1<<16) - 1<<15
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16, WithStatsCollector())
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	report, err := encoder.CompressionReport()
+	if err != nil {
+		t.Fatalf("Failed to get compression report: %v", err)
+	}
+	if report.SubframeTypes[SubframeVerbatim] != report.Frames {
+		t.Errorf("Expected all %d subframes to be VERBATIM, got %v", report.Frames, report.SubframeTypes)
+	}
+
+	// The stream is no bigger than the raw PCM plus headers, and decodes
+	if maxSize := len(samples[0])*2 + 42 + report.Frames*32; buf.Len() > maxSize {
+		t.Errorf("Expected at most %d bytes, got %d", maxSize, buf.Len())
+	}
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+// fixedSubframeSize returns the size in bytes of samples coded as a FIXED
+// subframe of the given order
+func fixedSubframeSize(t *testing.T, samples []int32, order int) int {
+	t.Helper()
+
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	bw := newBitWriter()
+	if err := encoder.encodeFixedSubframe(bw, samples, 16, 0, order); err != nil {
+		t.Fatalf("Failed to encode subframe: %v", err)
+	}
+	bw.alignToByte()
+	return len(bw.bytes())
+}
+
+func TestEncoder_BestFixedOrder(t *testing.T) {
+	// A ramp with a little noise on top: order 1 removes the slope, while
+	// order 2 only amplifies the noise
+	ramp := make([]int32, 4096)
+	seed := uint32(7)
+	for i := range ramp {
+		seed = seed*1664525 + 1013904223
+		ramp[i] = int32(i*4) + int32(seed>>28) - 8
+	}
+	order1 := fixedSubframeSize(t, ramp, 1)
+	order2 := fixedSubframeSize(t, ramp, 2)
+	if order1 >= order2 {
+		t.Errorf("Expected order 1 to beat order 2 on a noisy ramp: %d vs %d bytes", order1, order2)
+	}
+	if best, _ := bestFixedOrder(ramp, 16); best != 1 {
+		t.Errorf("Expected order 1 to be chosen for a noisy ramp, got %d", best)
+	}
+
+	// A clean ramp is predicted perfectly from order 2 on
+	clean := make([]int32, 4096)
+	for i := range clean {
+		clean[i] = int32(i * 4)
+	}
+	if best, _ := bestFixedOrder(clean, 16); best != 2 {
+		t.Errorf("Expected order 2 to be chosen for a clean ramp, got %d", best)
+	}
+
+	// DC with noise needs no prediction at all
+	dc := make([]int32, 4096)
+	for i := range dc {
+		seed = seed*1664525 + 1013904223
+		dc[i] = int32(seed>>24) - 128
+	}
+	if best, _ := bestFixedOrder(dc, 16); best != 0 {
+		t.Errorf("Expected order 0 to be chosen for noise, got %d", best)
+	}
+
+	// Tiny blocks cannot use orders beyond their length
+	if best, _ := bestFixedOrder([]int32{5}, 16); best != 0 {
+		t.Errorf("Expected order 0 for a single sample, got %d", best)
+	}
+	if best, _ := bestFixedOrder([]int32{1, 2, 3}, 16); best > 2 {
+		t.Errorf("Expected at most order 2 for three samples, got %d", best)
+	}
+}
+
+func TestEncoder_WastedBits(t *testing.T) {
+	// Every sample a multiple of four, as from 14-bit audio in 16 bits
+	rng := rand.New(rand.NewPCG(7, 8))
+	samples := make([]int32, 4096)
+	for i := range samples {
+		samples[i] = int32(8000*math.Sin(float64(i)/20))&^3 + (rng.Int32N(8)-4)*4
+	}
+
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	bw := newBitWriter()
+	if err := encoder.encodeSubframe(bw, samples, 16); err != nil {
+		t.Fatalf("Failed to encode subframe: %v", err)
+	}
+	bw.alignToByte()
+	header := bw.bytes()
+
+	// The wasted bits flag ends the first byte, then the count minus one
+	// in unary: 0b01 for two bits
+	if header[0]&0x01 != 1 {
+		t.Fatalf("Expected the wasted bits flag to be set, header %08b", header[0])
+	}
+	if header[1]>>6 != 0b01 {
+		t.Errorf("Expected two wasted bits coded as 0b01, got %02b", header[1]>>6)
+	}
+
+	// Shifting out the zeros saves space, and the samples decode exactly
+	plain := make([]int32, len(samples))
+	for i, s := range samples {
+		plain[i] = s | 1
+	}
+	bwPlain := newBitWriter()
+	if err := encoder.encodeSubframe(bwPlain, plain, 16); err != nil {
+		t.Fatalf("Failed to encode subframe: %v", err)
+	}
+	bwPlain.alignToByte()
+	if len(header) >= len(bwPlain.bytes()) {
+		t.Errorf("Expected wasted bits to shrink the subframe, got %d bytes vs %d", len(header), len(bwPlain.bytes()))
+	}
+
+	var buf bytes.Buffer
+	encoder, err = NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode([][]int32{samples}); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{samples}, decoded)
+}
+
+func TestEncoder_SetBlockSize(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.2, 2)
+	samples[0], samples[1] = samples[0][:8*1024], samples[1][:8*1024]
+
+	for _, tc := range []struct {
+		blockSize uint32
+		code      byte
+	}{
+		{1024, 0x0A},
+		{1000, 0x07}, // 16-bit size follows the header
+		{192, 0x01},
+	} {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetBlockSize(tc.blockSize); err != nil {
+			t.Fatalf("Failed to set block size %d: %v", tc.blockSize, err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		if info := decoder.StreamInfo(); info.MaxBlockSize != uint16(tc.blockSize) {
+			t.Errorf("Block size %d: STREAMINFO max block size is %d", tc.blockSize, info.MaxBlockSize)
+		}
+		frame, n, err := decoder.NextRawFrame()
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		if n != int(tc.blockSize) {
+			t.Errorf("Block size %d: first frame holds %d samples", tc.blockSize, n)
+		}
+		if code := frame[2] >> 4; code != tc.code {
+			t.Errorf("Block size %d: expected block size code 0x%02X, got 0x%02X", tc.blockSize, tc.code, code)
+		}
+
+		decoded, _, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	for _, n := range []uint32{0, 15, 65536} {
+		if err := encoder.SetBlockSize(n); err == nil {
+			t.Errorf("Expected an error for block size %d", n)
+		}
+	}
+	if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if err := encoder.SetBlockSize(1024); err == nil {
+		t.Error("Expected an error setting the block size after encoding")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/schollz/goflac"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("\nSuccess! Round trip is bit-exact.")
+}
+
+// run encodes a sine wave to a FLAC file in a temporary directory, decodes
+// it back and checks the result is bit-exact
+func run() error {
+	// Generate a sine wave WAV file
+	var wavBuf bytes.Buffer
+	frequency := 1000.0 // 1 kHz
+	duration := 3.0     // 3 seconds
+	sampleRate := uint32(48000)
+	channels := uint16(2)
+	bitsPerSample := uint16(16)
+
+	fmt.Printf("Generating sine wave: %.0f Hz, %.1f seconds, %d Hz sample rate\n",
+		frequency, duration, sampleRate)
+
+	err := goflac.GenerateSineWAV(&wavBuf, frequency, duration, sampleRate, channels, bitsPerSample)
+	if err != nil {
+		return fmt.Errorf("generating sine wave: %w", err)
+	}
+
+	wavReader, err := goflac.NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		return fmt.Errorf("reading WAV: %w", err)
+	}
+	original, err := wavReader.ReadSamples()
+	if err != nil {
+		return fmt.Errorf("reading samples: %w", err)
+	}
+
+	// Encode to a FLAC file, removed again when done. The file can seek,
+	// so the encoder fills in the MD5 signature of the audio itself.
+	dir, err := os.MkdirTemp("", "verify_roundtrip")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	flacFile := filepath.Join(dir, "roundtrip.flac")
+	f, err := os.Create(flacFile)
+	if err != nil {
+		return fmt.Errorf("creating FLAC file: %w", err)
+	}
+	defer f.Close()
+
+	encoder, err := goflac.NewEncoder(f, sampleRate, uint8(channels), uint8(bitsPerSample))
+	if err != nil {
+		return fmt.Errorf("creating encoder: %w", err)
+	}
+	if err := encoder.Encode(original); err != nil {
+		return fmt.Errorf("encoding FLAC: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing FLAC file: %w", err)
+	}
+	fmt.Printf("Encoded FLAC file: %s\n", flacFile)
+
+	// Decode it back with the package's own decoder
+	flacData, err := os.ReadFile(flacFile)
+	if err != nil {
+		return fmt.Errorf("reading FLAC file: %w", err)
+	}
+	decoder, err := goflac.NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		return fmt.Errorf("reading FLAC header: %w", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		return fmt.Errorf("decoding FLAC: %w", err)
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		return fmt.Errorf("verifying MD5: %w", err)
+	}
+	fmt.Println("MD5 signature verified")
+
+	// Compare sample by sample
+	if len(decoded) != len(original) {
+		return fmt.Errorf("channel count mismatch: %d != %d", len(decoded), len(original))
+	}
+	var maxError int64
+	for ch := range original {
+		if len(decoded[ch]) != len(original[ch]) {
+			return fmt.Errorf("channel %d length mismatch: %d != %d",
+				ch, len(decoded[ch]), len(original[ch]))
+		}
+		for i := range original[ch] {
+			diff := int64(decoded[ch][i]) - int64(original[ch][i])
+			if diff < 0 {
+				diff = -diff
+			}
+			maxError = max(maxError, diff)
+		}
+	}
+
+	fmt.Printf("Decoded %d samples from %d channels, max error: %d\n",
+		len(decoded[0]), len(decoded), maxError)
+	if maxError != 0 {
+		return errors.New("round trip is not bit-exact")
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// streamInfoBodyOffset is the position of the STREAMINFO block body in a
+// stream written by the encoder: after "fLaC" and the block header
+const streamInfoBodyOffset = 8
+
+// EncodeToFile encodes samples ([channel][sample]) to a FLAC file at path.
+// The stream is written to a temporary file in the same directory, its
+// STREAMINFO is completed in place with the total samples, frame sizes and
+// MD5 signature, and the file is synced and then renamed over path. A
+// failure at any point removes the temporary file, so path never holds a
+// partially written stream.
+func EncodeToFile(path string, sampleRate uint32, bitsPerSample uint8, samples [][]int32, opts ...Option) (err error) {
+	if len(samples) == 0 {
+		return errors.New("no channels to encode")
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	encoder, err := NewEncoder(f, sampleRate, uint8(len(samples)), bitsPerSample, opts...)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(samples); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself. Not every platform can sync a directory,
+	// and the file contents are already durable, so failure is ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// NewSeekableEncoder creates an encoder writing to ws, which must be able
+// to seek. The stream is written straight through, and Close seeks back to
+// complete STREAMINFO in place with the total samples, frame sizes and MD5
+// signature, so neither Encode nor streaming has to buffer frames. It is an
+// error if ws cannot seek, as with a file opened on a pipe; NewEncoder
+// accepts such writers and buffers instead.
+func NewSeekableEncoder(ws io.WriteSeeker, sampleRate uint32, channels, bitsPerSample uint8, opts ...Option) (*Encoder, error) {
+	if _, err := ws.Seek(0, io.SeekCurrent); err != nil {
+		return nil, fmt.Errorf("writer cannot seek: %w", err)
+	}
+	return NewEncoder(ws, sampleRate, channels, bitsPerSample, opts...)
+}
+
+// rewriteStreamInfo overwrites the STREAMINFO block at the start of the
+// stream in ws with one describing all audio encoded so far, fills in the
+// reserved SEEKTABLE and the cue sheet's lead-out if there are any, then
+// returns to the end
+func (e *Encoder) rewriteStreamInfo(ws io.WriteSeeker) error {
+	if _, err := ws.Seek(e.streamStart+streamInfoBodyOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(e.currentStreamInfo().marshal()); err != nil {
+		return err
+	}
+	if e.seekTableSlots > 0 {
+		if _, err := ws.Seek(e.streamStart+e.seekTableOffset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ws.Write(marshalSeekTable(e.seekPoints, e.seekTableSlots)); err != nil {
+			return err
+		}
+	}
+	if e.leadOutOffset > 0 {
+		if _, err := ws.Seek(e.streamStart+e.leadOutOffset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ws.Write(binary.BigEndian.AppendUint64(nil, e.samplesEncoded)); err != nil {
+			return err
+		}
+	}
+	if _, err := ws.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	e.streamInfoFinal = true
+	return nil
+}
+
+// streamOffset returns the current position of the encoder's writer. ok is
+// false if the writer cannot seek, as with a pipe or network connection.
+func (e *Encoder) streamOffset() (offset int64, ok bool) {
+	ws, ok := e.w.(io.WriteSeeker)
+	if !ok {
+		return 0, false
+	}
+	offset, err := ws.Seek(0, io.SeekCurrent)
+	return offset, err == nil
+}
+
+// Finalize closes the encoder and makes sure its STREAMINFO holds the
+// final total samples, block and frame sizes and MD5 signature. Audio
+// streamed with WriteSamples or EncodeFrame follows a header written before
+// these were known, so STREAMINFO has to be rewritten in place; if the
+// writer cannot seek the stream stays valid but Finalize returns an error.
+func (e *Encoder) Finalize() error {
+	if err := e.Close(); err != nil {
+		return err
+	}
+	if e.headerWritten && !e.streamInfoFinal {
+		return errors.New("writer cannot seek to complete STREAMINFO")
+	}
+	return nil
+}
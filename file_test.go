@@ -0,0 +1,272 @@
+package goflac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEncodeToFile(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.5, 2)
+	path := filepath.Join(t.TempDir(), "out.flac")
+
+	if err := EncodeToFile(path, 44100, 16, samples); err != nil {
+		t.Fatalf("Failed to encode to file: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	// STREAMINFO is complete, including the MD5 checked by DecodeAll
+	info := decoder.StreamInfo()
+	if info.TotalSamples != uint64(len(samples[0])) {
+		t.Errorf("Expected %d total samples, got %d", len(samples[0]), info.TotalSamples)
+	}
+	if info.MD5 == [16]byte{} || info.MinFrameSize == 0 || info.MaxFrameSize < info.MinFrameSize {
+		t.Errorf("STREAMINFO was not finalized: %+v", info)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncodeToFile_ErrorLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.flac")
+
+	// Unequal channel lengths make Encode fail after the temporary file exists
+	samples := [][]int32{make([]int32, 5000), make([]int32, 4000)}
+	if err := EncodeToFile(path, 44100, 16, samples); err == nil {
+		t.Fatal("Expected error for unequal channel lengths")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no file at the target path, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("Unexpected leftover file %q", entry.Name())
+	}
+}
+
+func TestEncoder_FinalizeFrameSizes(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.5, 2)
+	path := filepath.Join(t.TempDir(), "streamed.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	// Streamed audio follows a header written before any frame existed
+	encoder, err := NewEncoder(f, 44100, 2, 16, WithStatsCollector())
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.Finalize(); err != nil {
+		t.Fatalf("Failed to finalize: %v", err)
+	}
+
+	report, err := encoder.CompressionReport()
+	if err != nil {
+		t.Fatalf("Failed to get compression report: %v", err)
+	}
+	minSize, maxSize := slices.Min(report.FrameSizes), slices.Max(report.FrameSizes)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	info := decoder.StreamInfo()
+	if info.MinFrameSize != uint32(minSize) || info.MaxFrameSize != uint32(maxSize) {
+		t.Errorf("Expected frame sizes %d-%d, got %d-%d", minSize, maxSize, info.MinFrameSize, info.MaxFrameSize)
+	}
+	if info.TotalSamples != uint64(len(samples[0])) {
+		t.Errorf("Expected %d total samples, got %d", len(samples[0]), info.TotalSamples)
+	}
+	if _, err := decoder.DecodeAll(); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+}
+
+func TestEncoder_FinalizeUnseekable(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.1, 1)
+
+	// A streamed header on a writer that cannot seek stays incomplete
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.Finalize(); err == nil {
+		t.Error("Expected an error finalizing an unseekable stream")
+	}
+
+	// Encode completes STREAMINFO by buffering, so nothing is left to do
+	buf.Reset()
+	encoder, err = NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if err := encoder.Finalize(); err != nil {
+		t.Errorf("Failed to finalize: %v", err)
+	}
+}
+
+func TestEncoder_WriteSamplesMatchesEncode(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 1.0, 2)
+
+	// Stream to a file, so Close can complete STREAMINFO as Encode does
+	path := filepath.Join(t.TempDir(), "chunked.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+	encoder, err := NewEncoder(f, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	// Small chunks that rarely line up with block boundaries
+	for start := 0; start < len(samples[0]); start += 1000 {
+		end := min(start+1000, len(samples[0]))
+		chunk := [][]int32{samples[0][start:end], samples[1][start:end]}
+		if err := encoder.WriteSamples(chunk); err != nil {
+			t.Fatalf("Failed to write samples: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if got, expected := encoder.NextFrameNumber(), uint64((len(samples[0])+4095)/4096); got != expected {
+		t.Errorf("Expected %d frames, got %d", expected, got)
+	}
+
+	streamed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if !bytes.Equal(streamed, flacData) {
+		t.Error("Chunked WriteSamples output differs from a single Encode")
+	}
+}
+
+// memSeeker is an in-memory io.WriteSeeker that counts the bytes written
+type memSeeker struct {
+	data    []byte
+	pos     int
+	written int
+}
+
+func (m *memSeeker) Write(p []byte) (int, error) {
+	if end := m.pos + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	copy(m.data[m.pos:], p)
+	m.pos += len(p)
+	m.written += len(p)
+	return len(p), nil
+}
+
+func (m *memSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(m.pos)
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	m.pos = int(offset)
+	return offset, nil
+}
+
+func TestNewSeekableEncoder(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 1.0, 2)
+
+	ws := &memSeeker{}
+	encoder, err := NewSeekableEncoder(ws, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	for start := 0; start < len(samples[0]); start += 3000 {
+		end := min(start+3000, len(samples[0]))
+		if err := encoder.WriteSamples([][]int32{samples[0][start:end], samples[1][start:end]}); err != nil {
+			t.Fatalf("Failed to write samples: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// Only the STREAMINFO body is written a second time
+	if expected := len(ws.data) + streamInfoLength; ws.written != expected {
+		t.Errorf("Expected %d bytes written, got %d", expected, ws.written)
+	}
+	if !bytes.Equal(ws.data, flacData) {
+		t.Error("Streamed output differs from a single Encode")
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(ws.data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+	info := decoder.StreamInfo()
+	if info.TotalSamples != uint64(len(samples[0])) || info.MinFrameSize == 0 || info.MaxFrameSize == 0 {
+		t.Errorf("Expected a complete STREAMINFO, got %+v", info)
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Failed to verify MD5: %v", err)
+	}
+}
+
+func TestNewSeekableEncoder_Unseekable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := NewSeekableEncoder(w, 44100, 2, 16); err == nil {
+		t.Error("Expected error for a writer that cannot seek")
+	}
+}
@@ -0,0 +1,61 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithFrameNumberFunc overrides the frame number written to each frame
+// header. fn receives the index of the block being encoded and returns the
+// number to code in its place. This is unsafe and intended only for
+// building test vectors: gaps or duplicates make a stream that conforming
+// decoders will treat as damaged, and seek points and checkpoints still
+// follow the real block index.
+func WithFrameNumberFunc(fn func(blockIndex int) uint64) Option {
+	return func(e *Encoder) error {
+		if fn == nil {
+			return errors.New("frame number function must not be nil")
+		}
+		e.frameNumberFunc = fn
+		return nil
+	}
+}
+
+// FrameNumberError reports a frame whose coded number does not follow the
+// previous frame. For fixed-blocksize streams the numbers are frame
+// numbers, for variable-blocksize streams sample numbers.
+type FrameNumberError struct {
+	Expected uint64
+	Got      uint64
+}
+
+// Error implements the error interface
+func (e *FrameNumberError) Error() string {
+	return fmt.Sprintf("frame number %d out of sequence, expected %d", e.Got, e.Expected)
+}
+
+// WithFrameNumberCheck makes ReadFrame verify that frame numbers run in
+// sequence from zero. A gap or duplicate is reported as a
+// *FrameNumberError after the offending frame has been consumed, and the
+// decoder resynchronizes on that frame's number, so reading can continue
+// with the next frame.
+func WithFrameNumberCheck() DecoderOption {
+	return func(d *Decoder) error {
+		d.checkFrameNumbers = true
+		return nil
+	}
+}
+
+// checkFrameNumber compares the last frame header against the expected
+// number and advances the expectation past it
+func (d *Decoder) checkFrameNumber() error {
+	expected := d.nextNumber
+	d.nextNumber = d.header.number + 1
+	if d.header.variableBlockSize {
+		d.nextNumber = d.header.number + uint64(d.header.blockSize)
+	}
+	if d.header.number != expected {
+		return &FrameNumberError{Expected: expected, Got: d.header.number}
+	}
+	return nil
+}
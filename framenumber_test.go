@@ -0,0 +1,85 @@
+package goflac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameNumberFunc_GapDetected(t *testing.T) {
+	samples := [][]int32{make([]int32, 4*4096)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%300) - 150
+	}
+
+	// Skip frame number 2: the stream codes 0, 1, 3, 4
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16, WithFrameNumberFunc(func(blockIndex int) uint64 {
+		if blockIndex >= 2 {
+			return uint64(blockIndex) + 1
+		}
+		return uint64(blockIndex)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()), WithFrameNumberCheck())
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	var gaps []FrameNumberError
+	frames := 0
+	for {
+		_, err := decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		var numberErr *FrameNumberError
+		if errors.As(err, &numberErr) {
+			gaps = append(gaps, *numberErr)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		frames++
+	}
+
+	// The decoder resyncs on the gapped frame, so only one gap is reported
+	if len(gaps) != 1 || gaps[0] != (FrameNumberError{Expected: 2, Got: 3}) {
+		t.Errorf("Expected a single gap from 2 to 3, got %+v", gaps)
+	}
+	if frames != 3 {
+		t.Errorf("Expected 3 frames in sequence, got %d", frames)
+	}
+
+	// Without the check the gapped stream still decodes
+	decoder, err = NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestFrameNumberCheck_InSequence(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData), WithFrameNumberCheck())
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
@@ -0,0 +1,44 @@
+package goflac
+
+// alawTable and mulawTable expand 8-bit G.711 A-law and µ-law codes to
+// 16-bit linear PCM
+var (
+	alawTable  = expansionTable(alawToLinear)
+	mulawTable = expansionTable(mulawToLinear)
+)
+
+// expansionTable tabulates expand over every 8-bit code
+func expansionTable(expand func(byte) int16) [256]int16 {
+	var table [256]int16
+	for i := range table {
+		table[i] = expand(byte(i))
+	}
+	return table
+}
+
+// alawToLinear expands an A-law code. Codes are stored with even bits
+// inverted; the top bit set means positive.
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	mantissa := int16(a&0x0F)<<4 + 8
+	segment := (a & 0x70) >> 4
+	if segment > 0 {
+		mantissa = (mantissa + 0x100) << (segment - 1)
+	}
+	if a&0x80 != 0 {
+		return mantissa
+	}
+	return -mantissa
+}
+
+// mulawToLinear expands a µ-law code. Codes are stored inverted; the top
+// bit set means negative.
+func mulawToLinear(u byte) int16 {
+	const bias = 0x84
+	u = ^u
+	magnitude := (int16(u&0x0F)<<3 + bias) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return bias - magnitude
+	}
+	return magnitude - bias
+}
@@ -0,0 +1,39 @@
+package goflac
+
+import "errors"
+
+// errInputMutated reports that the caller changed the input while it was
+// being encoded
+var errInputMutated = errors.New("input samples were modified during encoding")
+
+// WithInputChecksum checksums the samples passed to Encode and
+// EncodeStrided before and after encoding, and fails the call if they
+// changed in between. This catches callers that reuse or refill a sample
+// buffer while it is still being encoded. It costs an extra pass over the
+// input, so it is off by default.
+func WithInputChecksum(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.inputChecksum = enabled
+		return nil
+	}
+}
+
+// FNV-1a parameters for checksumSamples
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// checksumSamples hashes every sample value along with the channel layout
+func checksumSamples(samples [][]int32) uint64 {
+	h := uint64(fnvOffset64)
+	for _, channel := range samples {
+		h ^= uint64(len(channel))
+		h *= fnvPrime64
+		for _, v := range channel {
+			h ^= uint64(uint32(v))
+			h *= fnvPrime64
+		}
+	}
+	return h
+}
@@ -0,0 +1,54 @@
+package goflac
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEncoder_InputChecksumDetectsMutation(t *testing.T) {
+	samples := [][]int32{make([]int32, 5*4096)}
+
+	// After the first frame, a goroutine refills the buffer the way a
+	// caller reusing it for the next chunk would
+	started := false
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16,
+		WithInputChecksum(true),
+		WithProgressETA(func(float64, time.Duration) {
+			if started {
+				return
+			}
+			started = true
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := range samples[0] {
+					samples[0][i] = int32(i)
+				}
+			}()
+			<-done
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	if err := encoder.Encode(samples); err != errInputMutated {
+		t.Errorf("Expected the input mutation to be detected, got %v", err)
+	}
+}
+
+func TestEncoder_InputChecksumUnchanged(t *testing.T) {
+	samples := [][]int32{make([]int32, 5000), make([]int32, 5000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 100)
+		samples[1][i] = -int32(i % 77)
+	}
+
+	encoder, err := NewEncoder(io.Discard, 44100, 2, 16, WithInputChecksum(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Errorf("Unexpected error for unmodified input: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// compressionLevel holds the settings of one compression level preset
+type compressionLevel struct {
+	blockSize         uint32
+	maxLPCOrder       int
+	stereo            bool
+	maxPartitionOrder int
+	riceSearch        RicePartitionSearch
+	apodization       apodization
+}
+
+// compressionLevels are the presets of SetCompressionLevel, modelled on
+// those of the flac command line tool
+var compressionLevels = [...]compressionLevel{
+	{1152, 0, false, 3, RicePartitionSearchEstimate, apodization{}},
+	{1152, 0, true, 3, RicePartitionSearchEstimate, apodization{}},
+	{1152, 0, true, 3, RicePartitionSearchExhaustive, apodization{}},
+	{4096, 6, true, 4, RicePartitionSearchEstimate, apodization{}},
+	{4096, 8, true, 4, RicePartitionSearchEstimate, apodization{}},
+	{4096, 8, true, 5, RicePartitionSearchEstimate, apodization{}},
+	{4096, 8, true, 6, RicePartitionSearchExhaustive, apodization{partialTukey: 2}},
+	{4096, 12, true, 6, RicePartitionSearchExhaustive, apodization{partialTukey: 2}},
+	{4096, 12, true, 8, RicePartitionSearchExhaustive, apodization{partialTukey: 2, punchoutTukey: 3}},
+}
+
+// SetCompressionLevel configures the encoder with one of the presets 0
+// (fastest) to 8 (smallest), like the -0 to -8 options of the flac tool:
+//
+//	level  block size  max LPC order  stereo  partition order  Rice search
+//	0      1152        0 (FIXED only) no      0-3              estimate
+//	1      1152        0 (FIXED only) yes     0-3              estimate
+//	2      1152        0 (FIXED only) yes     0-3              exhaustive
+//	3      4096        6              yes     0-4              estimate
+//	4      4096        8              yes     0-4              estimate
+//	5      4096        8              yes     0-5              estimate
+//	6      4096        8              yes     0-6              exhaustive
+//	7      4096        12             yes     0-6              exhaustive
+//	8      4096        12             yes     0-8              exhaustive
+//
+// Stereo means the best of the four stereo channel assignments is chosen
+// for every frame. LPC tries every order up to the maximum through a
+// Tukey(0.5) apodization window; levels 6 and 7 also try partial_tukey(2),
+// and level 8 partial_tukey(2) and punchout_tukey(3), named as for the
+// flac tool's -A option, keeping the best predictor. The default settings
+// match level 5 with partition orders up to 8. It must be called before
+// anything is encoded.
+func (e *Encoder) SetCompressionLevel(level int) error {
+	if level < 0 || level >= len(compressionLevels) {
+		return fmt.Errorf("compression level must be between 0 and %d", len(compressionLevels)-1)
+	}
+	if e.headerWritten || e.samplesEncoded > 0 || e.streaming {
+		return errors.New("compression level must be set before encoding")
+	}
+	preset := compressionLevels[level]
+	if e.subset {
+		if err := checkSubsetLPCOrder(e.streamSampleRate(), preset.maxLPCOrder); err != nil {
+			return err
+		}
+		if err := checkSubsetBlockSize(e.streamSampleRate(), int(preset.blockSize)); err != nil {
+			return err
+		}
+	}
+
+	e.blockSize = preset.blockSize
+	e.maxLPCOrder = preset.maxLPCOrder
+	e.stereoDecorrelation = preset.stereo
+	e.maxPartitionOrder = preset.maxPartitionOrder
+	e.riceSearch = preset.riceSearch
+	e.apodization = preset.apodization
+	e.lpcWindows = e.lpcWindows[:0]
+	return nil
+}
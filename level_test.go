@@ -0,0 +1,74 @@
+package goflac
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestEncoder_SetCompressionLevel(t *testing.T) {
+	// Two related channels of mixed tones with a little noise, as a
+	// stand-in for music
+	const n = 44100
+	rng := rand.New(rand.NewPCG(9, 10))
+	samples := [][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		x := float64(i) / 44100
+		tone := 6000*math.Sin(2*math.Pi*220*x) + 3000*math.Sin(2*math.Pi*660*x+1) +
+			1500*math.Sin(2*math.Pi*1870*x)
+		samples[0][i] = int32(tone) + rng.Int32N(64) - 32
+		samples[1][i] = int32(tone*0.8+800*math.Sin(2*math.Pi*330*x)) + rng.Int32N(64) - 32
+	}
+
+	previous := math.MaxInt
+	for level := 0; level <= 8; level++ {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetCompressionLevel(level); err != nil {
+			t.Fatalf("Failed to set compression level %d: %v", level, err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Level %d: Failed to encode FLAC: %v", level, err)
+		}
+		if buf.Len() > previous {
+			t.Errorf("Level %d produced %d bytes, more than the %d of the level below", level, buf.Len(), previous)
+		}
+		previous = buf.Len()
+
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Level %d: Failed to create decoder: %v", level, err)
+		}
+		if got := decoder.StreamInfo().MaxBlockSize; got != uint16(compressionLevels[level].blockSize) {
+			t.Errorf("Level %d: Expected block size %d, got %d", level, compressionLevels[level].blockSize, got)
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("Level %d: Failed to decode: %v", level, err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+}
+
+func TestEncoder_SetCompressionLevelErrors(t *testing.T) {
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	for _, level := range []int{-1, 9} {
+		if err := encoder.SetCompressionLevel(level); err == nil {
+			t.Errorf("Expected an error for compression level %d", level)
+		}
+	}
+
+	if err := encoder.WriteSamples([][]int32{{1, 2, 3}}); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.SetCompressionLevel(5); err == nil {
+		t.Error("Expected an error setting the compression level after encoding started")
+	}
+}
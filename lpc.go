@@ -0,0 +1,409 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxLPCOrder is the highest predictor order an LPC subframe can code
+const maxLPCOrder = 32
+
+// defaultMaxLPCOrder is the highest LPC order tried unless SetMaxLPCOrder
+// says otherwise
+const defaultMaxLPCOrder = 8
+
+// maxLPCShift is the largest quantization shift tried; negative shifts are
+// never written as many decoders reject them
+const maxLPCShift = 15
+
+// lpcWindowTaper is the fraction of the block tapered by the Tukey window
+// applied before autocorrelation
+const lpcWindowTaper = 0.5
+
+// partialTukeyOverlap and partialTukeyTaper shape the partial and punchout
+// Tukey windows as the flac tool's defaults do: neighbouring parts overlap
+// by a tenth, and each window tapers a fifth of its length
+const (
+	partialTukeyOverlap = 0.1
+	partialTukeyTaper   = 0.2
+)
+
+// apodization selects the windows LPC analysis tries, like the flac tool's
+// -A option: always Tukey(0.5) over the whole block, plus partialTukey
+// windows each covering one part of the block and punchoutTukey windows
+// each masking one part out. The predictor of the window giving the
+// smallest subframe is kept.
+type apodization struct {
+	partialTukey  int
+	punchoutTukey int
+}
+
+// windows fills dst with the apodization's windows for a block of n
+// samples, reusing its slices
+func (a apodization) windows(dst [][]float64, n int) [][]float64 {
+	count := 1 + a.partialTukey + a.punchoutTukey
+	for len(dst) < count {
+		dst = append(dst, nil)
+	}
+	dst = dst[:count]
+
+	dst[0] = tukeyWindow(dst[0][:0], n, lpcWindowTaper)
+	for i := 0; i < a.partialTukey; i++ {
+		start, end := windowPart(i, a.partialTukey, n)
+		w := appendZeros(dst[1+i][:0], start)
+		w = tukeyWindow(w, end-start, partialTukeyTaper)
+		dst[1+i] = appendZeros(w, n-end)
+	}
+	for i := 0; i < a.punchoutTukey; i++ {
+		start, end := windowPart(i, a.punchoutTukey, n)
+		w := tukeyWindow(dst[1+a.partialTukey+i][:0], start, partialTukeyTaper)
+		w = appendZeros(w, end-start)
+		dst[1+a.partialTukey+i] = tukeyWindow(w, n-end, partialTukeyTaper)
+	}
+	return dst
+}
+
+// windowPart returns the range of a block of n samples covered by part i
+// of parts, each overlapping the next by partialTukeyOverlap
+func windowPart(i, parts, n int) (start, end int) {
+	units := 1/(1-partialTukeyOverlap) - 1
+	total := float64(parts) + units
+	start = int(float64(i) / total * float64(n))
+	end = min(n, int((float64(i)+1+units)/total*float64(n)))
+	return start, end
+}
+
+// appendZeros appends n zeros to dst
+func appendZeros(dst []float64, n int) []float64 {
+	for range n {
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// SetMaxLPCOrder sets the highest order of linear predictor the encoder
+// tries for each subframe. Higher orders can model more complex signals at
+// the cost of encoding speed. Zero disables LPC, leaving only the FIXED
+// predictors. The default is 8; in subset mode streams up to 48 kHz are
+// limited to 12.
+func (e *Encoder) SetMaxLPCOrder(n int) error {
+	if n < 0 || n > maxLPCOrder {
+		return fmt.Errorf("LPC order must be between 0 and %d", maxLPCOrder)
+	}
+	if e.subset {
+		if err := checkSubsetLPCOrder(e.streamSampleRate(), n); err != nil {
+			return err
+		}
+	}
+	e.maxLPCOrder = n
+	return nil
+}
+
+// lpcPredictor is a quantized linear predictor: each sample is predicted as
+// the sum of coeffs[j]*s[i-j-1] for j < order, shifted right by shift
+type lpcPredictor struct {
+	order     int
+	precision int
+	shift     int
+	coeffs    [maxLPCOrder]int32
+}
+
+// bestLPC computes linear predictors of every order up to the encoder's
+// maximum, through each of its apodization windows, and returns the one
+// whose subframe is estimated to be smallest, together with that estimate.
+// ok is false if no usable predictor exists, for example for digital
+// silence.
+func (e *Encoder) bestLPC(samples []int32, bitsPerSample uint8) (best lpcPredictor, bestBits uint64, ok bool) {
+	maxOrder := min(e.maxLPCOrder, len(samples)-1)
+	if maxOrder < 1 {
+		return best, 0, false
+	}
+
+	if len(e.lpcWindows) == 0 || len(e.lpcWindows[0]) != len(samples) {
+		e.lpcWindows = e.apodization.windows(e.lpcWindows, len(samples))
+	}
+	for _, window := range e.lpcWindows {
+		p, bits, found := e.windowedLPC(samples, window, maxOrder, bitsPerSample)
+		if !found {
+			continue
+		}
+		// The estimates are too coarse to choose between windows, whose
+		// predictors are often close
+		if len(e.lpcWindows) > 1 {
+			bits = e.lpcSubframeBits(samples, &p, bitsPerSample)
+		}
+		if !ok || bits < bestBits {
+			best, bestBits, ok = p, bits, true
+		}
+	}
+	return best, bestBits, ok
+}
+
+// lpcSubframeBits returns the size in bits of the LPC subframe body
+// encodeLPCSubframe would write for samples with p
+func (e *Encoder) lpcSubframeBits(samples []int32, p *lpcPredictor, bitsPerSample uint8) uint64 {
+	residuals := e.residuals[:0]
+	for i := p.order; i < len(samples); i++ {
+		residuals = append(residuals, int64(samples[i])-lpcPredict(samples, i, p))
+	}
+	e.residuals = residuals
+	_, _, riceBits := e.chooseRicePartitioning(residuals, p.order)
+
+	// Warm-up samples, precision, shift and coefficients, then the coding
+	// method and partition order ahead of the partitions
+	return uint64(p.order)*uint64(bitsPerSample) + 4 + 5 + uint64(p.order*p.precision) + 2 + 4 + riceBits
+}
+
+// windowedLPC is bestLPC for a single window
+func (e *Encoder) windowedLPC(samples []int32, window []float64, maxOrder int, bitsPerSample uint8) (best lpcPredictor, bestBits uint64, ok bool) {
+	// Autocorrelation of the windowed block
+	windowed := e.lpcWindowed[:0]
+	for i, s := range samples {
+		windowed = append(windowed, float64(s)*window[i])
+	}
+	e.lpcWindowed = windowed
+
+	var autoc [maxLPCOrder + 1]float64
+	for lag := 0; lag <= maxOrder; lag++ {
+		var sum float64
+		for i := lag; i < len(windowed); i++ {
+			sum += windowed[i] * windowed[i-lag]
+		}
+		autoc[lag] = sum
+	}
+	if autoc[0] == 0 {
+		return best, 0, false
+	}
+
+	// Levinson-Durbin recursion, keeping the predictor of every order
+	var lp [maxLPCOrder][maxLPCOrder]float64
+	var lpc [maxLPCOrder]float64
+	errPower := autoc[0]
+	orders := 0
+	for i := 0; i < maxOrder; i++ {
+		r := -autoc[i+1]
+		for j := 0; j < i; j++ {
+			r -= lpc[j] * autoc[i-j]
+		}
+		r /= errPower
+
+		lpc[i] = r
+		for j := 0; j < i/2; j++ {
+			tmp := lpc[j]
+			lpc[j] += r * lpc[i-1-j]
+			lpc[i-1-j] += r * tmp
+		}
+		if i%2 == 1 {
+			lpc[i/2] += lpc[i/2] * r
+		}
+		errPower *= 1 - r*r
+
+		for j := 0; j <= i; j++ {
+			lp[i][j] = -lpc[j]
+		}
+		orders++
+		if errPower <= 0 {
+			break
+		}
+	}
+
+	precision := lpcPrecision(bitsPerSample, len(samples))
+	for order := 1; order <= orders; order++ {
+		p, valid := quantizeLPC(lp[order-1][:order], precision)
+		if !valid {
+			continue
+		}
+		sum, valid := lpcResidualSum(samples, &p)
+		if !valid {
+			continue
+		}
+		bits := uint64(order)*uint64(bitsPerSample) + 4 + 5 + uint64(order*precision) +
+			estimateRiceBits(sum, uint64(len(samples)-order))
+		if !ok || bits < bestBits {
+			best, bestBits, ok = p, bits, true
+		}
+	}
+	return best, bestBits, ok
+}
+
+// lpcPrecision returns the quantized coefficient precision in bits used
+// for a block, growing with the block size as libFLAC does
+func lpcPrecision(bitsPerSample uint8, blockSize int) int {
+	if bitsPerSample < 16 {
+		return max(5, 2+int(bitsPerSample)/2)
+	}
+	switch {
+	case blockSize <= 192:
+		return 7
+	case blockSize <= 384:
+		return 8
+	case blockSize <= 576:
+		return 9
+	case blockSize <= 1152:
+		return 10
+	case blockSize <= 2304:
+		return 11
+	case blockSize <= 4608:
+		return 12
+	}
+	return 13
+}
+
+// quantizeLPC converts floating point coefficients to integers of the
+// given precision with a shared right shift. The rounding error of each
+// coefficient is carried into the next to keep the overall response close.
+func quantizeLPC(lp []float64, precision int) (lpcPredictor, bool) {
+	p := lpcPredictor{order: len(lp), precision: precision}
+
+	var cmax float64
+	for _, c := range lp {
+		cmax = max(cmax, math.Abs(c))
+	}
+	if cmax == 0 || math.IsNaN(cmax) || math.IsInf(cmax, 0) {
+		return p, false
+	}
+
+	// Scale the largest coefficient to just fit in precision bits
+	_, exp := math.Frexp(cmax)
+	shift := precision - 1 - exp
+	if shift < 0 {
+		return p, false
+	}
+	p.shift = min(shift, maxLPCShift)
+
+	qmax := float64(int32(1)<<(precision-1) - 1)
+	qmin := -qmax - 1
+	var carry float64
+	for i, c := range lp {
+		carry += c * float64(int32(1)<<p.shift)
+		q := math.Max(qmin, math.Min(qmax, math.Round(carry)))
+		carry -= q
+		p.coeffs[i] = int32(q)
+	}
+	return p, true
+}
+
+// lpcPredict returns the prediction of samples[pos]
+func lpcPredict(samples []int32, pos int, p *lpcPredictor) int64 {
+	var sum int64
+	for j := 0; j < p.order; j++ {
+		sum += int64(p.coeffs[j]) * int64(samples[pos-j-1])
+	}
+	return sum >> p.shift
+}
+
+// lpcResidualSum returns the sum of the zigzag encoded residuals of the
+// predictor. valid is false if any residual does not fit in 32 bits, as
+// the format requires.
+func lpcResidualSum(samples []int32, p *lpcPredictor) (sum uint64, valid bool) {
+	for i := p.order; i < len(samples); i++ {
+		r := int64(samples[i]) - lpcPredict(samples, i, p)
+		if r < math.MinInt32 || r > math.MaxInt32 {
+			return 0, false
+		}
+		sum += zigzag(r)
+	}
+	return sum, true
+}
+
+// encodeLPCSubframe writes an LPC subframe using the predictor p
+func (e *Encoder) encodeLPCSubframe(buf *bitWriter, samples []int32, bitsPerSample uint8, wasted int, p *lpcPredictor) error {
+	// Subframe type: 0b1xxxxx for LPC (xxxxx = order-1)
+	writeSubframeHeader(buf, 0x20|uint64(p.order-1), wasted)
+	if e.stats != nil {
+		e.stats.subframe(SubframeLPC)
+	}
+
+	// Write unencoded warm-up samples
+	for i := 0; i < p.order; i++ {
+		buf.writeBitsSigned(int64(samples[i]), int(bitsPerSample))
+	}
+
+	// Quantized coefficient precision - 1 (4 bits), shift (5 bits signed),
+	// then the coefficients
+	buf.writeBits(uint64(p.precision-1), 4)
+	buf.writeBitsSigned(int64(p.shift), 5)
+	for _, c := range p.coeffs[:p.order] {
+		buf.writeBitsSigned(int64(c), p.precision)
+	}
+
+	residuals := e.residuals[:0]
+	for i := p.order; i < len(samples); i++ {
+		residuals = append(residuals, int64(samples[i])-lpcPredict(samples, i, p))
+	}
+	e.residuals = residuals
+	return e.encodeResidual(buf, e.residuals, p.order)
+}
+
+// tukeyWindow appends a Tukey window of length n to dst: flat in the
+// middle, with the outer taper/2 of the block on each side rising and
+// falling along a raised cosine
+func tukeyWindow(dst []float64, n int, taper float64) []float64 {
+	edge := int(taper / 2 * float64(n))
+	for i := 0; i < n; i++ {
+		w := 1.0
+		if edge > 0 {
+			if i < edge {
+				w = 0.5 * (1 - math.Cos(math.Pi*float64(i)/float64(edge)))
+			} else if i >= n-edge {
+				w = 0.5 * (1 - math.Cos(math.Pi*float64(n-1-i)/float64(edge)))
+			}
+		}
+		dst = append(dst, w)
+	}
+	return dst
+}
+
+// readLPCSubframe decodes the body of an LPC subframe
+func (d *Decoder) readLPCSubframe(br *bitReader, samples []int32, sampleBits, order int) error {
+	if order > len(samples) {
+		return errors.New("predictor order exceeds block size")
+	}
+
+	// Unencoded warm-up samples
+	for i := 0; i < order; i++ {
+		v, err := br.readBitsSigned(sampleBits)
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+
+	precisionCode, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precisionCode == 0x0F {
+		return errors.New("invalid LPC coefficient precision")
+	}
+	p := lpcPredictor{order: order, precision: int(precisionCode) + 1}
+
+	shift, err := br.readBitsSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return errors.New("negative LPC shift is not supported")
+	}
+	p.shift = int(shift)
+
+	for j := 0; j < order; j++ {
+		c, err := br.readBitsSigned(p.precision)
+		if err != nil {
+			return err
+		}
+		p.coeffs[j] = int32(c)
+	}
+
+	residuals, err := d.readResidual(br, len(samples), order)
+	if err != nil {
+		return err
+	}
+
+	// Restore the signal from prediction plus residual
+	for i := order; i < len(samples); i++ {
+		samples[i] = int32(lpcPredict(samples, i, &p) + residuals[i-order])
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// lpcTestSignal returns a mono signal of two tones plus a little noise,
+// scaled to the bit depth
+func lpcTestSignal(n int, bitsPerSample uint8) []int32 {
+	amplitude := float64(int64(1)<<(bitsPerSample-1)-1) * 0.4
+	samples := make([]int32, n)
+	seed := uint32(3)
+	for i := range samples {
+		seed = seed*1664525 + 1013904223
+		noise := (float64(seed>>16)/65536 - 0.5) * amplitude / 500
+		v := math.Sin(2*math.Pi*440*float64(i)/44100) + 0.5*math.Sin(2*math.Pi*1250*float64(i)/44100)
+		samples[i] = int32(v*amplitude/1.5 + noise)
+	}
+	return samples
+}
+
+// encodeLPC encodes samples with the given maximum LPC order and returns
+// the stream and its compression report
+func encodeLPC(t *testing.T, samples [][]int32, bitsPerSample uint8, maxOrder int) ([]byte, CompressionReport) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, uint8(len(samples)), bitsPerSample, WithStatsCollector())
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetMaxLPCOrder(maxOrder); err != nil {
+		t.Fatalf("Failed to set LPC order: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	report, err := encoder.CompressionReport()
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	return buf.Bytes(), report
+}
+
+func TestEncoder_LPCSmallerThanFixed(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.5, 1)
+
+	_, fixed := encodeLPC(t, samples, 16, 0)
+	_, lpc := encodeLPC(t, samples, 16, 8)
+	if fixed.SubframeTypes[SubframeLPC] != 0 {
+		t.Errorf("Expected no LPC subframes with LPC disabled, got %d", fixed.SubframeTypes[SubframeLPC])
+	}
+	if lpc.SubframeTypes[SubframeLPC] == 0 {
+		t.Error("Expected LPC subframes to be chosen for a sine wave")
+	}
+	if lpc.FrameSizes[0] >= fixed.FrameSizes[0] {
+		t.Errorf("Expected the LPC frame to be smaller than %d bytes, got %d", fixed.FrameSizes[0], lpc.FrameSizes[0])
+	}
+}
+
+func TestEncoder_LPCRoundTrip(t *testing.T) {
+	for _, bps := range []uint8{8, 16, 24} {
+		for _, order := range []int{1, 8, 12, 32} {
+			// The odd length leaves a short final block
+			samples := [][]int32{lpcTestSignal(3*4096+77, bps), lpcTestSignal(3*4096+77, bps)}
+			for i := range samples[1] {
+				samples[1][i] /= 2
+			}
+
+			flacData, report := encodeLPC(t, samples, bps, order)
+			// Coarse 8-bit coefficients and order 1 rarely beat FIXED
+			if bps >= 16 && order >= 8 && report.SubframeTypes[SubframeLPC] == 0 {
+				t.Errorf("%d bits, order %d: expected LPC subframes", bps, order)
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(flacData))
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			decoded, err := decoder.DecodeAll()
+			if err != nil {
+				t.Fatalf("%d bits, order %d: failed to decode: %v", bps, order, err)
+			}
+			assertSamplesEqual(t, samples, decoded)
+		}
+	}
+}
+
+func TestEncoder_SetMaxLPCOrder(t *testing.T) {
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	for _, n := range []int{-1, 33} {
+		if err := encoder.SetMaxLPCOrder(n); err == nil {
+			t.Errorf("Expected error for LPC order %d", n)
+		}
+	}
+
+	// The subset allows orders above 12 only above 48 kHz
+	subset, err := NewEncoder(io.Discard, 44100, 1, 16, WithSubsetCompliance(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := subset.SetMaxLPCOrder(13); err == nil {
+		t.Error("Expected error for LPC order 13 at 44.1kHz in subset mode")
+	}
+	if err := subset.SetMaxLPCOrder(12); err != nil {
+		t.Errorf("Unexpected error for LPC order 12: %v", err)
+	}
+	highRate, err := NewEncoder(io.Discard, 96000, 1, 16, WithSubsetCompliance(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := highRate.SetMaxLPCOrder(32); err != nil {
+		t.Errorf("Unexpected error for LPC order 32 at 96kHz: %v", err)
+	}
+}
+
+func TestApodization_Windows(t *testing.T) {
+	const n = 4096
+	a := apodization{partialTukey: 2, punchoutTukey: 3}
+	windows := a.windows(nil, n)
+	if len(windows) != 6 {
+		t.Fatalf("Expected 6 windows, got %d", len(windows))
+	}
+	for i, w := range windows {
+		if len(w) != n {
+			t.Fatalf("Window %d: expected %d values, got %d", i, n, len(w))
+		}
+	}
+
+	// Each partial window is zero outside its part, and each punchout
+	// window zero inside its part
+	for i := range 2 {
+		start, end := windowPart(i, 2, n)
+		for j, v := range windows[1+i] {
+			if (j < start || j >= end) && v != 0 {
+				t.Fatalf("Partial window %d: expected 0 outside [%d, %d), got %v at %d", i, start, end, v, j)
+			}
+		}
+		if windows[1+i][(start+end)/2] != 1 {
+			t.Errorf("Partial window %d: expected 1 in the middle of its part", i)
+		}
+	}
+	for i := range 3 {
+		start, end := windowPart(i, 3, n)
+		for j := start; j < end; j++ {
+			if v := windows[3+i][j]; v != 0 {
+				t.Fatalf("Punchout window %d: expected 0 inside [%d, %d), got %v at %d", i, start, end, v, j)
+			}
+		}
+	}
+
+	// Parts overlap and cover the block
+	if start, _ := windowPart(0, 2, n); start != 0 {
+		t.Errorf("Expected the first part to start at 0, got %d", start)
+	}
+	if _, end := windowPart(1, 2, n); end != n {
+		t.Errorf("Expected the last part to end at %d, got %d", n, end)
+	}
+	if _, end := windowPart(0, 2, n); end <= n/2 {
+		t.Errorf("Expected the first half to overlap the second, ending at %d", end)
+	}
+
+	// Windows are rebuilt in place for a new block size
+	windows = a.windows(windows, 1000)
+	if len(windows) != 6 || len(windows[5]) != 1000 {
+		t.Errorf("Expected 6 windows of 1000 values")
+	}
+}
+
+func TestEncoder_ApodizationBlockChange(t *testing.T) {
+	// Each block changes tone halfway through, which a predictor
+	// computed over either half fits better than one over the whole
+	samples := [][]int32{make([]int32, 16*4096)}
+	for i := range samples[0] {
+		freq := 300.0
+		if i%4096 >= 2048 {
+			freq = 2500
+		}
+		samples[0][i] = int32(12000 * math.Sin(2*math.Pi*freq*float64(i)/44100))
+	}
+
+	encode := func(a apodization) []byte {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 1, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		encoder.apodization = a
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		decoded, _, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+		return buf.Bytes()
+	}
+
+	single := encode(apodization{})
+	partial := encode(apodization{partialTukey: 2, punchoutTukey: 3})
+	if len(partial) >= len(single) {
+		t.Errorf("Expected partial windows to beat %d bytes, got %d", len(single), len(partial))
+	}
+}
+
+func TestDecoder_RejectsInvalidLPCPrecision(t *testing.T) {
+	bw := newBitWriter()
+	bw.writeBits(0xFFF8, 16)
+	bw.writeBits(0x01, 4) // 192 samples
+	bw.writeBits(0x09, 4) // 44.1kHz
+	bw.writeBits(0x00, 4) // mono
+	bw.writeBits(0x04, 3) // 16 bits per sample
+	bw.writeBits(0, 1)
+	bw.writeUTF8(0)
+	bw.writeBits(uint64(calculateCRC8(bw.bytes())), 8)
+
+	bw.writeBits(0x20<<1, 8) // LPC order 1 subframe
+	bw.writeBits(0, 16)      // warm-up sample
+	bw.writeBits(0x0F, 4)    // reserved precision code
+	bw.alignToByte()
+	frame := append(bw.bytes(), make([]byte, 16)...)
+
+	info := StreamInfo{MinBlockSize: 192, MaxBlockSize: 192, SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	var stream bytes.Buffer
+	if err := AssembleStream(&stream, info, [][]byte{frame}); err != nil {
+		t.Fatalf("Failed to assemble stream: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.ReadFrame(); err == nil || !strings.Contains(err.Error(), "precision") {
+		t.Errorf("Expected LPC precision error, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package goflac
+
+import (
+	"errors"
+	"hash"
+	"io"
+)
+
+// writeMD5Samples feeds a block of samples to h in the layout the FLAC MD5
+// signature is computed over: channel interleaved, each sample as a
+// little-endian signed integer of (bitsPerSample+7)/8 bytes. The bytes are
+// staged in buf, which is returned for reuse.
+func writeMD5Samples(h hash.Hash, samples [][]int32, bitsPerSample uint8, buf []byte) []byte {
+	if len(samples) == 0 {
+		return buf
+	}
+
+	bytesPerSample := int(bitsPerSample+7) / 8
+	buf = buf[:0]
+	for i := range samples[0] {
+		for ch := range samples {
+			v := samples[ch][i]
+			for b := 0; b < bytesPerSample; b++ {
+				buf = append(buf, byte(v>>(8*b)))
+			}
+		}
+	}
+	h.Write(buf)
+	return buf
+}
+
+// FixMD5 computes the MD5 signature of the audio in a FLAC stream and
+// writes it into STREAMINFO in place, leaving the audio frames untouched.
+// Streams that already carry a correct signature are left unchanged; a
+// non-zero signature that does not match the audio is reported as an error
+// rather than overwritten.
+func FixMD5(rw io.ReadWriteSeeker) error {
+	if _, err := rw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	d, err := NewDecoder(rw)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := d.ReadFrame(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var sum [16]byte
+	copy(sum[:], d.md5.Sum(nil))
+	if d.info.MD5 == sum {
+		return nil
+	}
+	if d.info.MD5 != [16]byte{} {
+		return errors.New("existing MD5 signature does not match the decoded audio")
+	}
+
+	// The signature is the last 16 bytes of the STREAMINFO block
+	if _, err := rw.Seek(d.streamInfoOffset+18, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = rw.Write(sum[:])
+	return err
+}
@@ -0,0 +1,181 @@
+package goflac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixMD5(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+	clear(flacData[26:42])
+
+	path := filepath.Join(t.TempDir(), "zero_md5.flac")
+	if err := os.WriteFile(path, flacData, 0644); err != nil {
+		t.Fatalf("Failed to write FLAC file: %v", err)
+	}
+
+	verify := func() error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read FLAC file: %v", err)
+		}
+		decoder, err := NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		if _, err := decoder.DecodeAll(); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		return decoder.VerifyMD5()
+	}
+
+	if err := verify(); err == nil {
+		t.Fatal("Expected verification to fail before fixing the MD5")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open FLAC file: %v", err)
+	}
+	defer f.Close()
+
+	if err := FixMD5(f); err != nil {
+		t.Fatalf("FixMD5 failed: %v", err)
+	}
+	if err := verify(); err != nil {
+		t.Fatalf("Verification failed after fixing the MD5: %v", err)
+	}
+
+	// The signature must be the MD5 of the interleaved 16-bit PCM
+	h := md5.New()
+	for i := range samples[0] {
+		for ch := range samples {
+			binary.Write(h, binary.LittleEndian, int16(samples[ch][i]))
+		}
+	}
+	fixed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+	if !bytes.Equal(fixed[26:42], h.Sum(nil)) {
+		t.Errorf("Unexpected MD5 signature %x, expected %x", fixed[26:42], h.Sum(nil))
+	}
+
+	// The audio frames must be untouched
+	if !bytes.Equal(fixed[42:], flacData[42:]) {
+		t.Error("FixMD5 modified the audio frames")
+	}
+
+	// A second call is a no-op
+	if err := FixMD5(f); err != nil {
+		t.Fatalf("Second FixMD5 failed: %v", err)
+	}
+	again, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+	if !bytes.Equal(again, fixed) {
+		t.Error("Second FixMD5 changed the file")
+	}
+}
+
+func TestEncoder_MD5Signature(t *testing.T) {
+	samples, flacData := encodeSineFLAC(t, 0.5, 2)
+
+	// The signature is the MD5 of the interleaved little-endian PCM
+	h := md5.New()
+	for i := range samples[0] {
+		for ch := range samples {
+			binary.Write(h, binary.LittleEndian, int16(samples[ch][i]))
+		}
+	}
+	expected := h.Sum(nil)
+
+	// Encode to a seekable file after some leading bytes, so STREAMINFO is
+	// rewritten in place rather than buffered
+	path := filepath.Join(t.TempDir(), "md5.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create FLAC file: %v", err)
+	}
+	prefix := []byte("prefix")
+	if _, err := f.Write(prefix); err != nil {
+		t.Fatalf("Failed to write prefix: %v", err)
+	}
+	encoder, err := NewEncoder(f, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close FLAC file: %v", err)
+	}
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+	if !bytes.Equal(fileData[len(prefix):], flacData) {
+		t.Error("Seekable and buffered encodes differ")
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if got := decoder.MD5(); !bytes.Equal(got[:], expected) {
+		t.Errorf("Unexpected MD5 signature %x, expected %x", got, expected)
+	}
+	if got := decoder.TotalSamples(); got != uint64(len(samples[0])) {
+		t.Errorf("Expected %d total samples, got %d", len(samples[0]), got)
+	}
+	if _, err := decoder.DecodeAll(); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+}
+
+func TestFixMD5_ID3v2Prefix(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 0.5, 1)
+
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 20}
+	tag = append(tag, make([]byte, 20)...)
+	path := filepath.Join(t.TempDir(), "id3.flac")
+	if err := os.WriteFile(path, append(tag, flacData...), 0644); err != nil {
+		t.Fatalf("Failed to write FLAC file: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open FLAC file: %v", err)
+	}
+	defer f.Close()
+	if err := FixMD5(f); err != nil {
+		t.Fatalf("FixMD5 failed: %v", err)
+	}
+
+	fixed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+	if !bytes.Equal(fixed[:len(tag)], tag) {
+		t.Error("FixMD5 modified the ID3v2 tag")
+	}
+	decoder, err := NewDecoder(bytes.NewReader(fixed))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.DecodeAll(); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Verification failed after fixing the MD5: %v", err)
+	}
+}
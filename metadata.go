@@ -0,0 +1,190 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// StreamInfo holds the contents of a STREAMINFO metadata block
+type StreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32
+	MaxFrameSize  uint32
+	SampleRate    uint32
+	Channels      uint8
+	BitsPerSample uint8
+	TotalSamples  uint64
+	MD5           [16]byte
+}
+
+// streamInfoLength is the size in bytes of a STREAMINFO block body
+const streamInfoLength = 34
+
+// marshal serializes the STREAMINFO block body (34 bytes)
+func (si StreamInfo) marshal() []byte {
+	streamInfo := make([]byte, streamInfoLength)
+
+	// Min block size (16 bits)
+	binary.BigEndian.PutUint16(streamInfo[0:2], si.MinBlockSize)
+
+	// Max block size (16 bits)
+	binary.BigEndian.PutUint16(streamInfo[2:4], si.MaxBlockSize)
+
+	// Min frame size (24 bits) - 0 for unknown
+	streamInfo[4] = byte(si.MinFrameSize >> 16)
+	streamInfo[5] = byte(si.MinFrameSize >> 8)
+	streamInfo[6] = byte(si.MinFrameSize)
+
+	// Max frame size (24 bits) - 0 for unknown
+	streamInfo[7] = byte(si.MaxFrameSize >> 16)
+	streamInfo[8] = byte(si.MaxFrameSize >> 8)
+	streamInfo[9] = byte(si.MaxFrameSize)
+
+	// Sample rate (20 bits) + channels (3 bits) + bits per sample (5 bits)
+	// Byte 10-11-12: sample rate (20 bits)
+	streamInfo[10] = byte(si.SampleRate >> 12)
+	streamInfo[11] = byte(si.SampleRate >> 4)
+	streamInfo[12] = byte((si.SampleRate&0x0F)<<4) | byte((si.Channels-1)<<1) | byte((si.BitsPerSample-1)>>4)
+
+	// Byte 13: bits per sample (4 bits) + total samples (4 bits)
+	streamInfo[13] = byte(((si.BitsPerSample-1)&0x0F)<<4) | byte(si.TotalSamples>>32)
+
+	// Bytes 14-17: total samples (32 bits)
+	binary.BigEndian.PutUint32(streamInfo[14:18], uint32(si.TotalSamples))
+
+	// Bytes 18-33: MD5 signature (16 bytes)
+	copy(streamInfo[18:34], si.MD5[:])
+
+	return streamInfo
+}
+
+// parseStreamInfo parses a STREAMINFO metadata block body
+func parseStreamInfo(data []byte) (StreamInfo, error) {
+	var si StreamInfo
+	if len(data) != streamInfoLength {
+		return si, errors.New("invalid STREAMINFO block size")
+	}
+
+	si.MinBlockSize = binary.BigEndian.Uint16(data[0:2])
+	si.MaxBlockSize = binary.BigEndian.Uint16(data[2:4])
+	si.MinFrameSize = uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6])
+	si.MaxFrameSize = uint32(data[7])<<16 | uint32(data[8])<<8 | uint32(data[9])
+
+	// Sample rate (20 bits) + channels (3 bits) + bits per sample (5 bits)
+	// + total samples (36 bits)
+	packed := binary.BigEndian.Uint64(data[10:18])
+	si.SampleRate = uint32(packed >> 44)
+	si.Channels = uint8((packed>>41)&0x07) + 1
+	si.BitsPerSample = uint8((packed>>36)&0x1F) + 1
+	si.TotalSamples = packed & 0xFFFFFFFFF
+
+	copy(si.MD5[:], data[18:34])
+	return si, nil
+}
+
+// SeekPoint locates a frame in the stream: the number of its first sample,
+// its byte offset from the first frame header and its sample count
+type SeekPoint struct {
+	SampleNumber uint64
+	Offset       uint64
+	FrameSamples uint16
+}
+
+// Metadata block types
+const (
+	blockTypeStreamInfo    = 0
+	blockTypePadding       = 1
+	blockTypeSeekTable     = 3
+	blockTypeVorbisComment = 4
+	blockTypeCueSheet      = 5
+	blockTypeInvalid       = 127
+)
+
+// metadataBlock is a metadata block body waiting to be written
+type metadataBlock struct {
+	blockType uint8
+	data      []byte
+}
+
+// vendorString identifies this encoder in VORBIS_COMMENT blocks
+const vendorString = "goflac"
+
+// VorbisComment is a single KEY=value tag. Keys may repeat, for example to
+// list several artists.
+type VorbisComment struct {
+	Key   string
+	Value string
+}
+
+// validateCommentKey checks that key only uses the characters the Vorbis
+// comment specification allows: printable ASCII except '='
+func validateCommentKey(key string) error {
+	if key == "" {
+		return errors.New("comment key must not be empty")
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7D || key[i] == '=' {
+			return errors.New("invalid character in comment key")
+		}
+	}
+	return nil
+}
+
+// marshalVorbisComments serializes a VORBIS_COMMENT block body, one comment
+// line per entry in order
+func marshalVorbisComments(vendor string, comments []VorbisComment) []byte {
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(vendor)))
+	buf = append(buf, vendor...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(comments)))
+	for _, c := range comments {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.Key)+1+len(c.Value)))
+		buf = append(buf, c.Key...)
+		buf = append(buf, '=')
+		buf = append(buf, c.Value...)
+	}
+	return buf
+}
+
+// parseVorbisComments parses a VORBIS_COMMENT block body
+func parseVorbisComments(data []byte) (string, []VorbisComment, error) {
+	readString := func() (string, error) {
+		if len(data) < 4 {
+			return "", errors.New("truncated VORBIS_COMMENT block")
+		}
+		n := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return "", errors.New("truncated VORBIS_COMMENT block")
+		}
+		s := string(data[:n])
+		data = data[n:]
+		return s, nil
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) < 4 {
+		return "", nil, errors.New("truncated VORBIS_COMMENT block")
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	var comments []VorbisComment
+	for i := uint32(0); i < count; i++ {
+		line, err := readString()
+		if err != nil {
+			return "", nil, err
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return "", nil, errors.New("VORBIS_COMMENT entry is missing '='")
+		}
+		comments = append(comments, VorbisComment{Key: key, Value: value})
+	}
+	return vendor, comments, nil
+}
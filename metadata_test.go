@@ -0,0 +1,335 @@
+package goflac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVorbisComments_MultipleValues(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	for _, c := range []VorbisComment{
+		{"TITLE", "Duet"},
+		{"ARTIST", "First Artist"},
+		{"ARTIST", "Second Artist"},
+	} {
+		if err := encoder.AddComment(c.Key, c.Value); err != nil {
+			t.Fatalf("Failed to add comment: %v", err)
+		}
+	}
+
+	samples := [][]int32{make([]int32, 1000)}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	if decoder.Vendor() != vendorString {
+		t.Errorf("Expected vendor %q, got %q", vendorString, decoder.Vendor())
+	}
+
+	var artists []string
+	for _, c := range decoder.Comments() {
+		if c.Key == "ARTIST" {
+			artists = append(artists, c.Value)
+		}
+	}
+	if len(artists) != 2 || artists[0] != "First Artist" || artists[1] != "Second Artist" {
+		t.Errorf("Expected both ARTIST values in order, got %q", artists)
+	}
+
+	// The audio must still decode after the extra metadata block
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_AddMetadataBlock(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	application := []byte("test\x01\x02\x03")
+	padding := make([]byte, 10)
+	if err := encoder.AddMetadataBlock(2, application); err != nil {
+		t.Fatalf("Failed to add APPLICATION block: %v", err)
+	}
+	if err := encoder.AddMetadataBlock(1, padding); err != nil {
+		t.Fatalf("Failed to add PADDING block: %v", err)
+	}
+	if err := encoder.AddMetadataBlock(blockTypeStreamInfo, nil); err == nil {
+		t.Error("Expected an error adding a second STREAMINFO block")
+	}
+	if err := encoder.AddMetadataBlock(blockTypeInvalid, nil); err == nil {
+		t.Error("Expected an error adding a block of the invalid type")
+	}
+	if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	data := buf.Bytes()
+	offset := 4
+	want := []struct {
+		header byte
+		body   []byte
+	}{
+		{0x00, nil},
+		{0x02, application},
+		{0x81, padding},
+	}
+	for i, w := range want {
+		block := data[offset:]
+		length := int(block[1])<<16 | int(block[2])<<8 | int(block[3])
+		if block[0] != w.header {
+			t.Errorf("Block %d: expected header byte 0x%02X, got 0x%02X", i, w.header, block[0])
+		}
+		if w.body != nil && !bytes.Equal(block[4:4+length], w.body) {
+			t.Errorf("Block %d: body mismatch", i)
+		}
+		offset += 4 + length
+	}
+	if !bytes.Equal(data[offset:offset+2], []byte{0xFF, 0xF8}) {
+		t.Errorf("Expected a frame after the last metadata block, got % X", data[offset:offset+2])
+	}
+
+	if err := encoder.AddMetadataBlock(1, nil); err == nil {
+		t.Error("Expected an error adding a block after the header was written")
+	}
+}
+
+func TestEncoder_SetPadding(t *testing.T) {
+	for _, n := range []int{0, 1, 8192} {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 1, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.AddComment("TITLE", "Song"); err != nil {
+			t.Fatalf("Failed to add comment: %v", err)
+		}
+		if err := encoder.SetPadding(n); err != nil {
+			t.Fatalf("Failed to set padding: %v", err)
+		}
+		if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+
+		// Walk the metadata blocks, which must end with the padding
+		data := buf.Bytes()
+		offset := 4
+		var headers []byte
+		var last []byte
+		for {
+			header := data[offset]
+			length := int(data[offset+1])<<16 | int(data[offset+2])<<8 | int(data[offset+3])
+			headers = append(headers, header)
+			last = data[offset+4 : offset+4+length]
+			offset += 4 + length
+			if header&0x80 != 0 {
+				break
+			}
+		}
+
+		want := []byte{blockTypeStreamInfo, 0x80 | blockTypeVorbisComment}
+		if n > 0 {
+			want = []byte{blockTypeStreamInfo, blockTypeVorbisComment, 0x80 | blockTypePadding}
+		}
+		if !bytes.Equal(headers, want) {
+			t.Errorf("Padding %d: expected block headers % X, got % X", n, want, headers)
+		}
+		if n > 0 && !bytes.Equal(last, make([]byte, n)) {
+			t.Errorf("Padding %d: expected %d zero bytes, got %d bytes", n, n, len(last))
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		if _, err := decoder.DecodeAll(); err != nil {
+			t.Errorf("Padding %d: failed to decode: %v", n, err)
+		}
+	}
+
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetPadding(-1); err == nil {
+		t.Error("Expected an error for negative padding")
+	}
+	if err := encoder.SetPadding(1 << 24); err == nil {
+		t.Error("Expected an error for padding too large for a block")
+	}
+}
+
+func TestVorbisComments_BlockLayout(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetTags(map[string][]string{"TITLE": {"Song"}, "ARTIST": {"Band"}}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+	if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	data := buf.Bytes()
+
+	// STREAMINFO no longer carries the last-block flag; the comment block
+	// that follows it does
+	if data[4] != blockTypeStreamInfo {
+		t.Fatalf("Expected STREAMINFO without the last-block flag, got header byte 0x%02X", data[4])
+	}
+	block := data[4+4+streamInfoLength:]
+	if block[0] != 0x80|blockTypeVorbisComment {
+		t.Fatalf("Expected a final VORBIS_COMMENT block, got header byte 0x%02X", block[0])
+	}
+	length := int(block[1])<<16 | int(block[2])<<8 | int(block[3])
+	body := block[4 : 4+length]
+
+	// Parse the body by hand: little-endian lengths, unlike the rest of FLAC
+	readString := func() string {
+		n := int(binary.LittleEndian.Uint32(body))
+		s := string(body[4 : 4+n])
+		body = body[4+n:]
+		return s
+	}
+	if vendor := readString(); vendor != vendorString {
+		t.Errorf("Expected vendor %q, got %q", vendorString, vendor)
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	var lines []string
+	for i := uint32(0); i < count; i++ {
+		lines = append(lines, readString())
+	}
+	if len(body) != 0 {
+		t.Errorf("Expected the block to end after the comments, %d bytes left", len(body))
+	}
+	if strings.Join(lines, ";") != "ARTIST=Band;TITLE=Song" {
+		t.Errorf("Unexpected comments %q", lines)
+	}
+}
+
+func TestVorbisComments_SetTagsDeterministic(t *testing.T) {
+	tags := map[string][]string{
+		"TITLE":  {"Song"},
+		"ARTIST": {"A", "B"},
+		"ALBUM":  {"Record"},
+	}
+
+	var first []byte
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 1, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetTags(tags); err != nil {
+			t.Fatalf("Failed to set tags: %v", err)
+		}
+		if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(first, buf.Bytes()) {
+			t.Fatal("SetTags output is not deterministic")
+		}
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	expected := []VorbisComment{
+		{"ALBUM", "Record"},
+		{"ARTIST", "A"},
+		{"ARTIST", "B"},
+		{"TITLE", "Song"},
+	}
+	comments := decoder.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d", len(expected), len(comments))
+	}
+	for i := range expected {
+		if comments[i] != expected[i] {
+			t.Errorf("Comment %d: expected %v, got %v", i, expected[i], comments[i])
+		}
+	}
+}
+
+func TestVorbisComments_InvalidKey(t *testing.T) {
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.AddComment("BAD=KEY", "x"); err == nil {
+		t.Error("Expected error for a key containing '='")
+	}
+	if err := encoder.AddComment("", "x"); err == nil {
+		t.Error("Expected error for an empty key")
+	}
+}
+
+func TestEncoder_WriteMetadataOnly(t *testing.T) {
+	cs, err := ParseCueSheet(strings.NewReader(testCueSheet), 44100, 16)
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetCueSheet(cs); err != nil {
+		t.Fatalf("Failed to set cue sheet: %v", err)
+	}
+	if err := encoder.WriteMetadataOnly(); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.TotalSamples() != 0 {
+		t.Errorf("Expected 0 total samples, got %d", decoder.TotalSamples())
+	}
+	if decoder.CueSheet() == nil {
+		t.Error("Expected the CUESHEET block to be read")
+	}
+	if _, err := decoder.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected no frames, got %v", err)
+	}
+
+	// STREAMINFO is not last; the CUESHEET after it is
+	data := buf.Bytes()
+	if data[4]&0x80 != 0 {
+		t.Error("STREAMINFO must not carry the last-block flag")
+	}
+	cueHeader := 4 + 4 + streamInfoLength
+	if data[cueHeader] != 0x80|blockTypeCueSheet {
+		t.Errorf("Expected a last CUESHEET block header, got 0x%02X", data[cueHeader])
+	}
+
+	if err := encoder.WriteMetadataOnly(); err == nil {
+		t.Error("Expected error writing the metadata twice")
+	}
+}
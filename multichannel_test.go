@@ -0,0 +1,113 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// surroundSamples returns n samples of each of channels channels, each
+// holding a different kind of signal: a tone at its own frequency, except
+// for one silent channel, one with a DC offset and one of noise
+func surroundSamples(channels, n int) [][]int32 {
+	rng := rand.New(rand.NewPCG(uint64(channels), 51))
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		samples[ch] = make([]int32, n)
+		for i := range samples[ch] {
+			switch ch {
+			case 2:
+				// silent
+			case 3:
+				samples[ch][i] = -1234
+			case 4:
+				samples[ch][i] = rng.Int32N(1<<16) - 1<<15
+			default:
+				f := 110 * float64(ch+1)
+				samples[ch][i] = int32(math.Round(20000 * math.Sin(2*math.Pi*f*float64(i)/48000)))
+			}
+		}
+	}
+	return samples
+}
+
+func TestEncoder_Multichannel(t *testing.T) {
+	for _, channels := range []int{6, 8} {
+		samples := surroundSamples(channels, 10000)
+
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 48000, uint8(channels), 16, WithStatsCollector())
+		if err != nil {
+			t.Fatalf("%d channels: failed to create encoder: %v", channels, err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("%d channels: failed to encode: %v", channels, err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatalf("%d channels: failed to close: %v", channels, err)
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%d channels: failed to create decoder: %v", channels, err)
+		}
+		if decoder.Channels() != uint8(channels) {
+			t.Errorf("Expected %d channels in STREAMINFO, got %d", channels, decoder.Channels())
+		}
+		decoded := make([][]int32, channels)
+		for {
+			frame, err := decoder.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d channels: failed to decode: %v", channels, err)
+			}
+			if a := decoder.header.channelAssignment; a != uint8(channels-1) {
+				t.Errorf("%d channels: expected independent channel assignment %d, got %d", channels, channels-1, a)
+			}
+			for ch := range frame {
+				decoded[ch] = append(decoded[ch], frame[ch]...)
+			}
+		}
+		assertSamplesEqual(t, samples, decoded)
+		if err := decoder.VerifyMD5(); err != nil {
+			t.Errorf("%d channels: failed to verify MD5: %v", channels, err)
+		}
+
+		// Each channel is coded by its own kind of subframe: only the noise
+		// is raw, every other channel predicted
+		report, err := encoder.CompressionReport()
+		if err != nil {
+			t.Fatalf("%d channels: failed to get report: %v", channels, err)
+		}
+		if got := report.SubframeTypes[SubframeVerbatim]; got != report.Frames {
+			t.Errorf("%d channels: expected %d verbatim subframes, got %d", channels, report.Frames, got)
+		}
+		predicted := report.SubframeTypes[SubframeFixed] + report.SubframeTypes[SubframeLPC]
+		if expected := (channels - 1) * report.Frames; predicted != expected {
+			t.Errorf("%d channels: expected %d predicted subframes, got %d", channels, expected, predicted)
+		}
+	}
+}
+
+func TestEncoder_MultichannelBlockSizeMismatch(t *testing.T) {
+	encoder, err := NewEncoder(io.Discard, 48000, 8, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write stream info: %v", err)
+	}
+
+	block := surroundSamples(8, 4096)
+	block[7] = block[7][:4000]
+	if err := encoder.EncodeFrame(block, 0); err == nil {
+		t.Error("Expected error for a channel shorter than the others")
+	}
+	if err := encoder.EncodeFrame(block[:7], 0); err == nil {
+		t.Error("Expected error for 7 channels of samples to an 8-channel encoder")
+	}
+}
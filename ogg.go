@@ -0,0 +1,275 @@
+package goflac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Ogg page header flags
+const (
+	oggContinued = 0x01
+	oggBOS       = 0x02
+	oggEOS       = 0x04
+)
+
+// oggNoGranule is the granule position of a page on which no packet ends
+const oggNoGranule = 0xFFFFFFFFFFFFFFFF
+
+// oggMaxSegments is the most lacing values, and so 255-byte segments, a
+// page can hold
+const oggMaxSegments = 255
+
+// oggCRCTable is the lookup table of the Ogg page checksum: CRC-32 with
+// polynomial 0x04C11DB7, not reflected, initial value 0
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggCRC computes the Ogg checksum of a page whose checksum field is zero
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// OggEncoder encodes FLAC into an Ogg container following the FLAC-in-Ogg
+// mapping: the first page carries the mapping header with STREAMINFO, each
+// further metadata block follows as its own header packet, and every FLAC
+// frame is one audio packet. Ogg cannot be rewritten in place, so streamed
+// audio leaves STREAMINFO's total samples and MD5 signature unknown, while
+// Encode fills them in.
+type OggEncoder struct {
+	w       io.Writer
+	enc     *Encoder
+	out     bytes.Buffer
+	serial  uint32
+	seq     uint32
+	granule uint64
+
+	// frames holds packets encoded but not yet paged, as the header pages
+	// must come first
+	frames     [][]byte
+	frameSizes []int
+
+	// held is the last page built, written once it is known whether it
+	// ends the stream
+	held []byte
+
+	headerDone bool
+	closed     bool
+}
+
+// NewOggEncoder creates an encoder writing an Ogg FLAC stream with the
+// given serial number to w. The options are those of NewEncoder.
+func NewOggEncoder(w io.Writer, serial uint32, sampleRate uint32, channels uint8, bitsPerSample uint8, opts ...Option) (*OggEncoder, error) {
+	o := &OggEncoder{w: w, serial: serial}
+	enc, err := NewEncoder(&o.out, sampleRate, channels, bitsPerSample, opts...)
+	if err != nil {
+		return nil, err
+	}
+	enc.frameHook = func(frame []byte, samples int) {
+		o.frames = append(o.frames, bytes.Clone(frame))
+		o.frameSizes = append(o.frameSizes, samples)
+	}
+	o.enc = enc
+	return o, nil
+}
+
+// Encoder returns the underlying FLAC encoder, for settings such as tags
+// that must be made before anything is written. Its encoding methods must
+// not be called directly.
+func (o *OggEncoder) Encoder() *Encoder {
+	return o.enc
+}
+
+// Encode encodes samples ([channel][sample]) as the whole stream, with a
+// complete STREAMINFO, and closes the encoder
+func (o *OggEncoder) Encode(samples [][]int32) error {
+	if o.closed {
+		return errClosed
+	}
+	if err := o.enc.Encode(samples); err != nil {
+		return err
+	}
+	return o.Close()
+}
+
+// WriteSamples pushes samples ([channel][sample]) into the stream, writing
+// pages as frames are completed
+func (o *OggEncoder) WriteSamples(samples [][]int32) error {
+	if o.closed {
+		return errClosed
+	}
+	if err := o.enc.WriteSamples(samples); err != nil {
+		return err
+	}
+	return o.flush()
+}
+
+// Close encodes any buffered samples and writes the final page, flagged as
+// the end of the stream
+func (o *OggEncoder) Close() error {
+	if o.closed {
+		return errClosed
+	}
+	o.closed = true
+	if err := o.enc.ensureHeader(); err != nil {
+		return err
+	}
+	if err := o.enc.Close(); err != nil {
+		return err
+	}
+	if err := o.flush(); err != nil {
+		return err
+	}
+	if o.held == nil {
+		return nil
+	}
+	o.held[5] |= oggEOS
+	return o.writeHeld()
+}
+
+// flush pages the header, once the FLAC encoder has written it, and any
+// frames encoded since the last call
+func (o *OggEncoder) flush() error {
+	if !o.headerDone {
+		if !o.enc.headerWritten {
+			return nil
+		}
+		if err := o.writeHeaderPages(o.out.Bytes()[:o.enc.headerLength]); err != nil {
+			return err
+		}
+		o.headerDone = true
+	}
+	o.out.Reset()
+
+	for i, frame := range o.frames {
+		o.granule += uint64(o.frameSizes[i])
+		if err := o.writePacket(frame, 0, o.granule); err != nil {
+			return err
+		}
+	}
+	o.frames = o.frames[:0]
+	o.frameSizes = o.frameSizes[:0]
+	return nil
+}
+
+// writeHeaderPages converts the native FLAC header to Ogg header packets:
+// the mapping header with STREAMINFO, then each other metadata block with
+// VORBIS_COMMENT first, as the mapping requires
+func (o *OggEncoder) writeHeaderPages(header []byte) error {
+	header = header[4:] // "fLaC"
+	var blocks []metadataBlock
+	for len(header) > 0 {
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		blocks = append(blocks, metadataBlock{header[0] & 0x7F, header[4 : 4+length]})
+		header = header[4+length:]
+	}
+
+	others := []metadataBlock{{blockTypeVorbisComment, marshalVorbisComments(vendorString, nil)}}
+	for _, block := range blocks[1:] {
+		switch block.blockType {
+		case blockTypeVorbisComment:
+			others[0] = block
+		case blockTypeSeekTable:
+			// Byte offsets into a native stream mean nothing in Ogg
+		default:
+			others = append(others, block)
+		}
+	}
+
+	first := []byte{0x7F, 'F', 'L', 'A', 'C', 1, 0}
+	first = binary.BigEndian.AppendUint16(first, uint16(len(others)))
+	first = append(first, "fLaC"...)
+	first = appendBlockHeader(first, blockTypeStreamInfo, false, len(blocks[0].data))
+	first = append(first, blocks[0].data...)
+	if err := o.writePacket(first, oggBOS, 0); err != nil {
+		return err
+	}
+
+	for i, block := range others {
+		packet := appendBlockHeader(nil, block.blockType, i == len(others)-1, len(block.data))
+		packet = append(packet, block.data...)
+		if err := o.writePacket(packet, 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendBlockHeader appends a metadata block header
+func appendBlockHeader(dst []byte, blockType uint8, last bool, length int) []byte {
+	if last {
+		blockType |= 0x80
+	}
+	return append(dst, blockType, byte(length>>16), byte(length>>8), byte(length))
+}
+
+// writePacket writes packet on pages of its own, continuing it across
+// pages if it needs more than 255 segments. Only the page on which it ends
+// carries granule.
+func (o *OggEncoder) writePacket(packet []byte, flags byte, granule uint64) error {
+	for {
+		// A packet is laced as 255-byte segments ended by a shorter one,
+		// possibly empty
+		segments := len(packet)/255 + 1
+		last := segments <= oggMaxSegments
+		size := len(packet)
+		pageGranule := granule
+		if !last {
+			segments = oggMaxSegments
+			size = oggMaxSegments * 255
+			pageGranule = oggNoGranule
+		}
+
+		page := []byte("OggS")
+		page = append(page, 0, flags)
+		page = binary.LittleEndian.AppendUint64(page, pageGranule)
+		page = binary.LittleEndian.AppendUint32(page, o.serial)
+		page = binary.LittleEndian.AppendUint32(page, o.seq)
+		page = binary.LittleEndian.AppendUint32(page, 0) // CRC
+		page = append(page, byte(segments))
+		for i := 0; i < segments; i++ {
+			page = append(page, byte(min(255, size-i*255)))
+		}
+		page = append(page, packet[:size]...)
+		o.seq++
+
+		if err := o.writeHeld(); err != nil {
+			return err
+		}
+		o.held = page
+
+		if last {
+			return nil
+		}
+		packet = packet[size:]
+		flags = oggContinued
+	}
+}
+
+// writeHeld writes the held page, if any, with its checksum
+func (o *OggEncoder) writeHeld() error {
+	if o.held == nil {
+		return nil
+	}
+	binary.LittleEndian.PutUint32(o.held[22:26], 0)
+	binary.LittleEndian.PutUint32(o.held[22:26], oggCRC(o.held))
+	_, err := o.w.Write(o.held)
+	o.held = nil
+	return err
+}
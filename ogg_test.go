@@ -0,0 +1,205 @@
+package goflac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// oggPage is a parsed Ogg page
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	sequence uint32
+	segments []byte
+	data     []byte
+}
+
+// parseOggPages splits an Ogg stream into pages, checking the capture
+// pattern, serial number and checksum of each
+func parseOggPages(t *testing.T, data []byte, serial uint32) []oggPage {
+	t.Helper()
+
+	var pages []oggPage
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[0:4]) != "OggS" || data[4] != 0 {
+			t.Fatalf("Page %d: missing capture pattern", len(pages))
+		}
+		n := int(data[26])
+		p := oggPage{
+			flags:    data[5],
+			granule:  binary.LittleEndian.Uint64(data[6:14]),
+			sequence: binary.LittleEndian.Uint32(data[18:22]),
+			segments: data[27 : 27+n],
+		}
+		if s := binary.LittleEndian.Uint32(data[14:18]); s != serial {
+			t.Errorf("Page %d: expected serial %d, got %d", len(pages), serial, s)
+		}
+		size := 27 + n
+		for _, lace := range p.segments {
+			size += int(lace)
+		}
+		p.data = data[27+n : size]
+
+		page := bytes.Clone(data[:size])
+		crc := binary.LittleEndian.Uint32(page[22:26])
+		binary.LittleEndian.PutUint32(page[22:26], 0)
+		if oggCRC(page) != crc {
+			t.Errorf("Page %d: checksum mismatch", len(pages))
+		}
+
+		pages = append(pages, p)
+		data = data[size:]
+	}
+	return pages
+}
+
+// checkOggFLAC checks the page structure of an Ogg FLAC stream and decodes
+// it by reassembling the native FLAC stream from its packets
+func checkOggFLAC(t *testing.T, data []byte, serial uint32, samples [][]int32) StreamInfo {
+	t.Helper()
+
+	pages := parseOggPages(t, data, serial)
+	if len(pages) < 3 {
+		t.Fatalf("Expected at least 3 pages, got %d", len(pages))
+	}
+
+	var packets [][]byte
+	var packet []byte
+	for i, p := range pages {
+		if p.sequence != uint32(i) {
+			t.Errorf("Page %d: expected sequence number %d, got %d", i, i, p.sequence)
+		}
+		if (p.flags&oggBOS != 0) != (i == 0) {
+			t.Errorf("Page %d: beginning of stream flag is %v", i, p.flags&oggBOS != 0)
+		}
+		if (p.flags&oggEOS != 0) != (i == len(pages)-1) {
+			t.Errorf("Page %d: end of stream flag is %v", i, p.flags&oggEOS != 0)
+		}
+		if (p.flags&oggContinued != 0) != (len(packet) > 0) {
+			t.Errorf("Page %d: continued flag is %v", i, p.flags&oggContinued != 0)
+		}
+
+		offset := 0
+		ended := false
+		for _, lace := range p.segments {
+			packet = append(packet, p.data[offset:offset+int(lace)]...)
+			offset += int(lace)
+			if lace < 255 {
+				packets = append(packets, packet)
+				packet = nil
+				ended = true
+			}
+		}
+		if !ended && p.granule != oggNoGranule {
+			t.Errorf("Page %d: no packet ends but granule is %d", i, p.granule)
+		}
+	}
+	if last := pages[len(pages)-1]; last.granule != uint64(len(samples[0])) {
+		t.Errorf("Expected final granule position %d, got %d", len(samples[0]), last.granule)
+	}
+
+	// Mapping header: 0x7F "FLAC", version 1.0, header packet count, then
+	// the native signature and STREAMINFO
+	first := packets[0]
+	if !bytes.Equal(first[:7], []byte{0x7F, 'F', 'L', 'A', 'C', 1, 0}) || string(first[9:13]) != "fLaC" {
+		t.Fatalf("Invalid mapping header % X", first[:13])
+	}
+	headers := int(binary.BigEndian.Uint16(first[7:9]))
+	if packets[1][0]&0x7F != blockTypeVorbisComment {
+		t.Errorf("Expected VORBIS_COMMENT as the first header packet, got type %d", packets[1][0]&0x7F)
+	}
+
+	native := append([]byte(nil), first[9:]...)
+	for _, p := range packets[1:] {
+		native = append(native, p...)
+	}
+	for i, p := range packets[1+headers:] {
+		if p[0] != 0xFF || p[1]&0xFE != 0xF8 {
+			t.Errorf("Audio packet %d does not start with a frame sync code", i)
+		}
+	}
+
+	decoded, info, err := DecodeReader(bytes.NewReader(native))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+	return info
+}
+
+func TestOggEncoder_Encode(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 1.0, 2)
+
+	path := filepath.Join(t.TempDir(), "sine.ogg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	encoder, err := NewOggEncoder(f, 1234, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encoder().AddComment("TITLE", "Sine"); err != nil {
+		t.Fatalf("Failed to add comment: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode Ogg FLAC: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	info := checkOggFLAC(t, data, 1234, samples)
+	if info.TotalSamples != uint64(len(samples[0])) || info.MD5 == [16]byte{} {
+		t.Errorf("Expected a complete STREAMINFO, got %+v", info)
+	}
+}
+
+func TestOggEncoder_WriteSamples(t *testing.T) {
+	// 24-bit noise in large blocks makes frames too long for one page
+	rng := rand.New(rand.NewPCG(81, 1))
+	samples := make([][]int32, 2)
+	for ch := range samples {
+		samples[ch] = make([]int32, 40000)
+		for i := range samples[ch] {
+			samples[ch][i] = rng.Int32N(1<<24) - 1<<23
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewOggEncoder(&buf, 7, 44100, 2, 24)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encoder().SetBlockSize(16384); err != nil {
+		t.Fatalf("Failed to set block size: %v", err)
+	}
+	for start := 0; start < len(samples[0]); start += 5000 {
+		end := min(start+5000, len(samples[0]))
+		if err := encoder.WriteSamples([][]int32{samples[0][start:end], samples[1][start:end]}); err != nil {
+			t.Fatalf("Failed to write samples: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+
+	checkOggFLAC(t, buf.Bytes(), 7, samples)
+	continued := 0
+	for _, p := range parseOggPages(t, buf.Bytes(), 7) {
+		if p.flags&oggContinued != 0 {
+			continued++
+		}
+	}
+	if continued == 0 {
+		t.Error("Expected frames continued across pages")
+	}
+}
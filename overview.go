@@ -0,0 +1,60 @@
+package goflac
+
+import "errors"
+
+// waveformOverview accumulates min/max peaks over fixed-size buckets of
+// inter-channel samples as they pass through the encoder
+type waveformOverview struct {
+	bucketSamples int
+	sink          func(bucket int, min, max int32)
+
+	bucket int
+	count  int
+	min    int32
+	max    int32
+}
+
+// WithWaveformOverview reports a waveform overview while encoding: for
+// every bucketSamples inter-channel samples, sink receives the bucket index
+// and the minimum and maximum sample value across all channels. A final
+// partial bucket is reported when the stream ends.
+func WithWaveformOverview(bucketSamples int, sink func(bucket int, min, max int32)) Option {
+	return func(e *Encoder) error {
+		if bucketSamples <= 0 {
+			return errors.New("overview bucket size must be positive")
+		}
+		if sink == nil {
+			return errors.New("overview sink must not be nil")
+		}
+		e.overview = &waveformOverview{bucketSamples: bucketSamples, sink: sink}
+		return nil
+	}
+}
+
+// update folds a block of samples ([channels][samples]) into the overview
+func (o *waveformOverview) update(samples [][]int32) {
+	for i := range samples[0] {
+		for ch := range samples {
+			v := samples[ch][i]
+			if o.count == 0 && ch == 0 {
+				o.min, o.max = v, v
+			}
+			o.min = min(o.min, v)
+			o.max = max(o.max, v)
+		}
+		o.count++
+		if o.count == o.bucketSamples {
+			o.flush()
+		}
+	}
+}
+
+// flush reports the current bucket if it holds any samples
+func (o *waveformOverview) flush() {
+	if o.count == 0 {
+		return
+	}
+	o.sink(o.bucket, o.min, o.max)
+	o.bucket++
+	o.count = 0
+}
@@ -0,0 +1,53 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder_WaveformOverview(t *testing.T) {
+	samples := [][]int32{make([]int32, 10000), make([]int32, 10000)}
+	for i := range samples[0] {
+		samples[0][i] = int32((i*37)%2001) - 1000
+		samples[1][i] = int32((i*91)%4001) - 2000
+	}
+
+	type peak struct{ min, max int32 }
+	var got []peak
+	bucketSamples := 1500
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 2, 16, WithWaveformOverview(bucketSamples, func(bucket int, min, max int32) {
+		if bucket != len(got) {
+			t.Errorf("Expected bucket %d, got %d", len(got), bucket)
+		}
+		got = append(got, peak{min, max})
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+
+	// Compute the expected peaks directly
+	var expected []peak
+	for start := 0; start < len(samples[0]); start += bucketSamples {
+		end := min(start+bucketSamples, len(samples[0]))
+		p := peak{samples[0][start], samples[0][start]}
+		for ch := range samples {
+			for _, v := range samples[ch][start:end] {
+				p.min = min(p.min, v)
+				p.max = max(p.max, v)
+			}
+		}
+		expected = append(expected, p)
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Bucket %d: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithPacketCallback puts the encoder in packet mode for packetized
+// transports such as RTP. Every WriteSamples call is encoded immediately as
+// exactly one frame, never buffered or coalesced with other calls, so each
+// call must hold between one sample and a full block. After the frame is
+// written fn receives its bytes and the number of inter-channel samples it
+// holds. The frame slice is only valid during the call. As in any
+// fixed-blocksize stream only the final call may pass a short block, and
+// writes after it are rejected; with WithVariableBlockSize every packet may
+// have its own size.
+func WithPacketCallback(fn func(frame []byte, samples int)) Option {
+	return func(e *Encoder) error {
+		if fn == nil {
+			return errors.New("packet callback must not be nil")
+		}
+		e.packetCallback = fn
+		return nil
+	}
+}
+
+// writePacket encodes samples as a single frame in packet mode
+func (e *Encoder) writePacket(samples [][]int32) error {
+	n := len(samples[0])
+	if n == 0 || n > int(e.blockSize) {
+		return fmt.Errorf("packet mode needs between 1 and %d samples per write, got %d", e.blockSize, n)
+	}
+	if !e.variableBlockSize && e.samplesEncoded > 0 && uint32(e.minBlockSize) < e.blockSize {
+		return errors.New("a short packet ends a fixed-blocksize stream; enable variable block size for short packets mid-stream")
+	}
+	if err := e.ensureHeader(); err != nil {
+		return err
+	}
+	return e.EncodeFrame(samples, e.nextFrameNumber)
+}
@@ -0,0 +1,136 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder_PacketCallback(t *testing.T) {
+	samples := [][]int32{make([]int32, 3*4096+500), make([]int32, 3*4096+500)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%100) - 50
+		samples[1][i] = int32(i%70) - 35
+	}
+
+	var packets [][]byte
+	var counts []int
+	var out bytes.Buffer
+	encoder, err := NewEncoder(&out, 44100, 2, 16, WithPacketCallback(func(frame []byte, n int) {
+		packets = append(packets, bytes.Clone(frame))
+		counts = append(counts, n)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	// Every write yields exactly one frame, the last a short one
+	writes := []int{4096, 4096, 4096, 500}
+	start := 0
+	for i, n := range writes {
+		block := [][]int32{samples[0][start : start+n], samples[1][start : start+n]}
+		if err := encoder.WriteSamples(block); err != nil {
+			t.Fatalf("Failed to write samples: %v", err)
+		}
+		if len(packets) != i+1 || counts[i] != n {
+			t.Fatalf("Expected write %d to emit one frame of %d samples, got %d packets", i, n, len(packets))
+		}
+		start += n
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// Each packet decodes on its own given the stream parameters
+	info := StreamInfo{
+		MinBlockSize:  4096,
+		MaxBlockSize:  4096,
+		SampleRate:    44100,
+		Channels:      2,
+		BitsPerSample: 16,
+	}
+	start = 0
+	for i, packet := range packets {
+		var stream bytes.Buffer
+		if err := AssembleStream(&stream, info, [][]byte{packet}); err != nil {
+			t.Fatalf("Failed to assemble stream: %v", err)
+		}
+		decoded, _, err := DecodeReader(&stream)
+		if err != nil {
+			t.Fatalf("Failed to decode packet %d: %v", i, err)
+		}
+		n := counts[i]
+		assertSamplesEqual(t, [][]int32{samples[0][start : start+n], samples[1][start : start+n]}, decoded)
+		start += n
+	}
+
+	// The packets are the frames written to the output
+	frames := out.Bytes()[42:]
+	if !bytes.Equal(bytes.Join(packets, nil), frames) {
+		t.Error("Packets differ from the frames written to the output")
+	}
+}
+
+func TestEncoder_PacketCallbackRejectsOversizedWrite(t *testing.T) {
+	var out bytes.Buffer
+	encoder, err := NewEncoder(&out, 44100, 1, 16, WithPacketCallback(func([]byte, int) {}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples([][]int32{make([]int32, 4097)}); err == nil {
+		t.Error("Expected an error for a write larger than a block")
+	}
+	if err := encoder.WriteSamples([][]int32{{}}); err == nil {
+		t.Error("Expected an error for an empty write")
+	}
+}
+
+func TestEncoder_PacketCallbackShortWrite(t *testing.T) {
+	block := func(n int) [][]int32 {
+		samples := [][]int32{make([]int32, n)}
+		for i := range samples[0] {
+			samples[0][i] = int32(i%100) - 50
+		}
+		return samples
+	}
+
+	// A short packet in a fixed-blocksize stream must be the last
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16, WithPacketCallback(func([]byte, int) {}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples(block(4096)); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.WriteSamples(block(300)); err != nil {
+		t.Fatalf("Failed to write short packet: %v", err)
+	}
+	if err := encoder.WriteSamples(block(300)); err == nil {
+		t.Error("Expected an error for a second short packet")
+	}
+	if err := encoder.WriteSamples(block(4096)); err == nil {
+		t.Error("Expected an error for a packet after a short one")
+	}
+
+	// With variable block size every packet may be short
+	var out bytes.Buffer
+	encoder, err = NewEncoder(&out, 44100, 1, 16, WithVariableBlockSize(true), WithPacketCallback(func([]byte, int) {}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	written := [][]int32{nil}
+	for _, n := range []int{300, 4096, 1000, 300} {
+		samples := block(n)
+		if err := encoder.WriteSamples(samples); err != nil {
+			t.Fatalf("Failed to write packet of %d samples: %v", n, err)
+		}
+		written[0] = append(written[0], samples[0]...)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	decoded, _, err := DecodeReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, written, decoded)
+}
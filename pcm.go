@@ -0,0 +1,282 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EncodeOtoStream encodes interleaved 16-bit little-endian stereo PCM, the
+// format produced by game audio libraries such as ebiten and oto, read from
+// r until EOF. The encoder must have been created for 2 channels, 16 bits
+// per sample and sampleRate. The stream is closed once r is exhausted.
+func (e *Encoder) EncodeOtoStream(r io.Reader, sampleRate uint32) error {
+	if e.channels != 2 || e.bitsPerSample != 16 {
+		return errors.New("encoder must be configured for 16-bit stereo")
+	}
+	if sampleRate != e.sampleRate {
+		return errors.New("sample rate does not match the encoder")
+	}
+
+	if err := e.ensureHeader(); err != nil {
+		return err
+	}
+
+	const frameBytes = 4 // two 16-bit samples per inter-channel sample
+	raw := make([]byte, int(e.blockSize)*frameBytes)
+	block := [][]int32{make([]int32, e.blockSize), make([]int32, e.blockSize)}
+
+	var frameNumber uint64
+	for {
+		n, err := io.ReadFull(r, raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if n%frameBytes != 0 {
+			return errors.New("input ends with a partial sample")
+		}
+
+		count := n / frameBytes
+		for i := 0; i < count; i++ {
+			block[0][i] = int32(int16(binary.LittleEndian.Uint16(raw[i*frameBytes:])))
+			block[1][i] = int32(int16(binary.LittleEndian.Uint16(raw[i*frameBytes+2:])))
+		}
+
+		if err := e.EncodeFrame([][]int32{block[0][:count], block[1][:count]}, frameNumber); err != nil {
+			return err
+		}
+		frameNumber++
+
+		if count < int(e.blockSize) {
+			break
+		}
+	}
+
+	return e.Close()
+}
+
+// EncodeStrided encodes interleaved samples held in a larger buffer, such as
+// a C audio buffer with padding columns: channel c of frame f is read from
+// buf[f*stride+c]. As with Encode, STREAMINFO is completed unless the
+// stream header has already been written.
+func (e *Encoder) EncodeStrided(buf []int32, channels, frames, stride int) (err error) {
+	if channels != int(e.channels) {
+		return errors.New("channel count does not match the encoder")
+	}
+	if stride < channels {
+		return errors.New("stride must be at least the number of channels")
+	}
+	if frames < 0 || frames > 0 && len(buf) < (frames-1)*stride+channels {
+		return errors.New("buffer too small for the given frames and stride")
+	}
+
+	if e.inputChecksum {
+		input := [][]int32{buf}
+		before := checksumSamples(input)
+		defer func() {
+			if err == nil && checksumSamples(input) != before {
+				err = errInputMutated
+			}
+		}()
+	}
+
+	if !e.headerWritten {
+		e.totalSamples = uint64(frames)
+	}
+
+	return e.encodeComplete(func() error {
+		blockSize := int(e.blockSize)
+		block := make([][]int32, channels)
+		for ch := range block {
+			block[ch] = make([]int32, blockSize)
+		}
+
+		if e.progress != nil {
+			e.progress.begin((frames + blockSize - 1) / blockSize)
+			defer e.progress.end()
+		}
+
+		var frameNumber uint64
+		for start := 0; start < frames; start += blockSize {
+			count := min(blockSize, frames-start)
+			e.block = e.block[:0]
+			for ch := range block {
+				for i := 0; i < count; i++ {
+					block[ch][i] = buf[(start+i)*stride+ch]
+				}
+				e.block = append(e.block, block[ch][:count])
+			}
+
+			if err := e.EncodeFrame(e.block, frameNumber); err != nil {
+				return err
+			}
+			frameNumber++
+		}
+
+		e.finish()
+		return nil
+	})
+}
+
+// ReadSamplesCSV parses a CSV of integer samples, one row per inter-channel
+// sample and one column per channel, into per-channel slices suitable for
+// Encode. Every row must have the same number of columns.
+func ReadSamplesCSV(r io.Reader) ([][]int32, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	var samples [][]int32
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if samples == nil {
+			samples = make([][]int32, len(record))
+		}
+		for ch, field := range record {
+			value, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32)
+			if err != nil {
+				line, _ := cr.FieldPos(ch)
+				return nil, fmt.Errorf("invalid sample on line %d: %w", line, err)
+			}
+			samples[ch] = append(samples[ch], int32(value))
+		}
+	}
+
+	if samples == nil {
+		return nil, errors.New("CSV contains no samples")
+	}
+	return samples, nil
+}
+
+// ReadRawPCM reads headerless interleaved little-endian PCM, such as the
+// output of ffmpeg -f s16le, from r until EOF and deinterleaves it into
+// per-channel slices suitable for Encode. Samples are decoded as in a PCM
+// WAV file: 8-bit samples are unsigned, wider ones signed.
+func ReadRawPCM(r io.Reader, channels int, bitsPerSample int) ([][]int32, error) {
+	if channels < 1 {
+		return nil, errors.New("at least one channel is required")
+	}
+	switch bitsPerSample {
+	case 8, 16, 24, 32:
+	default:
+		return nil, errors.New("unsupported bits per sample")
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := bitsPerSample / 8
+	frameBytes := bytesPerSample * channels
+	if len(data)%frameBytes != 0 {
+		return nil, errors.New("input ends with a partial sample")
+	}
+
+	wav := &WAVReader{audioFormat: wavFormatPCM, channels: uint16(channels), bitsPerSample: uint16(bitsPerSample)}
+	frames := len(data) / frameBytes
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		samples[ch] = make([]int32, frames)
+	}
+	for i := 0; i < frames; i++ {
+		for ch := range samples {
+			offset := i*frameBytes + ch*bytesPerSample
+			sample, err := wav.parseSample(data[offset : offset+bytesPerSample])
+			if err != nil {
+				return nil, err
+			}
+			samples[ch][i] = sample
+		}
+	}
+	return samples, nil
+}
+
+// NormalizeBitDepth converts channels recorded at different bit depths to a
+// common depth so they can be encoded in one stream. Channel ch is scaled
+// from from[ch] bits to to bits by a binary shift: widening multiplies by
+// 2^(to-from[ch]), which is exact, and narrowing divides by 2^(from[ch]-to)
+// rounding toward negative infinity. The input is not modified. from must
+// have one entry per channel, and every depth must be between 1 and 32
+// bits.
+func NormalizeBitDepth(samples [][]int32, from []uint8, to uint8) ([][]int32, error) {
+	if len(from) != len(samples) {
+		return nil, fmt.Errorf("%d source bit depths for %d channels", len(from), len(samples))
+	}
+	for _, bits := range append([]uint8{to}, from...) {
+		if bits < 1 || bits > 32 {
+			return nil, fmt.Errorf("bit depth %d is not between 1 and 32", bits)
+		}
+	}
+
+	out := make([][]int32, len(samples))
+	for ch, channel := range samples {
+		out[ch] = make([]int32, len(channel))
+		switch {
+		case to >= from[ch]:
+			shift := to - from[ch]
+			for i, s := range channel {
+				out[ch][i] = s << shift
+			}
+		default:
+			shift := from[ch] - to
+			for i, s := range channel {
+				out[ch][i] = s >> shift
+			}
+		}
+	}
+	return out, nil
+}
+
+// TrimSilence returns a copy of samples ([channel][sample]) without the
+// leading and trailing samples that are silent on every channel. A sample
+// is silent when its magnitude is below thresholdDB relative to full scale
+// for bitsPerSample bits, so -60 keeps everything within 60 dB of the
+// loudest possible sample. Entirely silent input yields empty channels.
+// The input is not modified.
+func TrimSilence(samples [][]int32, bitsPerSample uint8, thresholdDB float64) [][]int32 {
+	fullScale := math.Ldexp(1, int(bitsPerSample)-1)
+	threshold := fullScale * math.Pow(10, thresholdDB/20)
+
+	loud := func(i int) bool {
+		for _, channel := range samples {
+			if math.Abs(float64(channel[i])) >= threshold {
+				return true
+			}
+		}
+		return false
+	}
+
+	n := 0
+	if len(samples) > 0 {
+		n = len(samples[0])
+	}
+	start := 0
+	for start < n && !loud(start) {
+		start++
+	}
+	end := n
+	for end > start && !loud(end-1) {
+		end--
+	}
+
+	out := make([][]int32, len(samples))
+	for ch, channel := range samples {
+		out[ch] = append([]int32{}, channel[start:end]...)
+	}
+	return out
+}
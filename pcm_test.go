@@ -0,0 +1,318 @@
+package goflac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncoder_EncodeOtoStream(t *testing.T) {
+	// Interleaved 16-bit little-endian stereo, as produced by oto
+	const frames = 10000
+	expected := [][]int32{make([]int32, frames), make([]int32, frames)}
+	var pcm bytes.Buffer
+	for i := 0; i < frames; i++ {
+		left := int16(20000 * math.Sin(2*math.Pi*440*float64(i)/44100))
+		right := int16(-15000 * math.Sin(2*math.Pi*660*float64(i)/44100))
+		binary.Write(&pcm, binary.LittleEndian, left)
+		binary.Write(&pcm, binary.LittleEndian, right)
+		expected[0][i] = int32(left)
+		expected[1][i] = int32(right)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeOtoStream(&pcm, 44100); err != nil {
+		t.Fatalf("Failed to encode PCM stream: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestEncoder_EncodeOtoStreamInvalid(t *testing.T) {
+	mono, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := mono.EncodeOtoStream(bytes.NewReader(nil), 44100); err == nil {
+		t.Error("Expected error for a mono encoder")
+	}
+
+	stereo, err := NewEncoder(&bytes.Buffer{}, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := stereo.EncodeOtoStream(bytes.NewReader(make([]byte, 6)), 44100); err == nil {
+		t.Error("Expected error for input ending in a partial sample")
+	}
+}
+
+func TestEncoder_EncodeStrided(t *testing.T) {
+	// Three channels stored with a stride of five: two padding columns
+	const channels, stride, frames = 3, 5, 9000
+	buf := make([]int32, frames*stride)
+	expected := make([][]int32, channels)
+	for ch := range expected {
+		expected[ch] = make([]int32, frames)
+	}
+	for f := 0; f < frames; f++ {
+		for c := 0; c < stride; c++ {
+			if c < channels {
+				v := int32((f*(c+1))%3000) - 1500
+				buf[f*stride+c] = v
+				expected[c][f] = v
+			} else {
+				buf[f*stride+c] = 0x7FFF // padding that must be skipped
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	encoder, err := NewEncoder(&out, 44100, channels, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeStrided(buf, channels, frames, stride); err != nil {
+		t.Fatalf("Failed to encode strided buffer: %v", err)
+	}
+
+	// The strided encode must match encoding the deinterleaved channels
+	var reference bytes.Buffer
+	refEncoder, err := NewEncoder(&reference, 44100, channels, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := refEncoder.Encode(expected); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), reference.Bytes()) {
+		t.Error("Strided encoding differs from encoding the deinterleaved samples")
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestEncoder_EncodeStridedInvalid(t *testing.T) {
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeStrided(make([]int32, 10), 2, 10, 1); err == nil {
+		t.Error("Expected error for a stride smaller than the channel count")
+	}
+	if err := encoder.EncodeStrided(make([]int32, 10), 2, 10, 2); err == nil {
+		t.Error("Expected error for a buffer that is too small")
+	}
+}
+
+func TestReadSamplesCSV(t *testing.T) {
+	input := "0, 0\n100,-100\n-32768, 32767\n7,8\n"
+
+	samples, err := ReadSamplesCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	expected := [][]int32{{0, 100, -32768, 7}, {0, -100, 32767, 8}}
+	assertSamplesEqual(t, expected, samples)
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded[0]) != 4 {
+		t.Errorf("Expected 4 samples, got %d", len(decoded[0]))
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestReadSamplesCSVInvalid(t *testing.T) {
+	cases := map[string]string{
+		"empty":        "",
+		"not a number": "1,2\n3,x\n",
+		"ragged":       "1,2\n3\n",
+		"out of range": "1\n2147483648\n",
+	}
+	for name, input := range cases {
+		if _, err := ReadSamplesCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestReadRawPCM(t *testing.T) {
+	// 16-bit stereo as written by ffmpeg -f s16le: L0 R0 L1 R1 ...
+	left := []int32{0, 1, -1, 32767, -32768}
+	right := []int32{100, -100, 2000, -2000, 5}
+	var pcm bytes.Buffer
+	for i := range left {
+		binary.Write(&pcm, binary.LittleEndian, int16(left[i]))
+		binary.Write(&pcm, binary.LittleEndian, int16(right[i]))
+	}
+
+	samples, err := ReadRawPCM(bytes.NewReader(pcm.Bytes()), 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to read raw PCM: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{left, right}, samples)
+
+	// 8-bit samples are unsigned and 24-bit samples packed
+	samples, err = ReadRawPCM(bytes.NewReader([]byte{0x80, 0xFF, 0x00}), 1, 8)
+	if err != nil {
+		t.Fatalf("Failed to read raw PCM: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{{0, 127, -128}}, samples)
+	samples, err = ReadRawPCM(bytes.NewReader([]byte{0xFF, 0xFF, 0x7F, 0x00, 0x00, 0x80}), 1, 24)
+	if err != nil {
+		t.Fatalf("Failed to read raw PCM: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{{8388607, -8388608}}, samples)
+
+	if _, err := ReadRawPCM(bytes.NewReader(pcm.Bytes()[:pcm.Len()-1]), 2, 16); err == nil {
+		t.Error("Expected an error for a partial sample")
+	}
+	if _, err := ReadRawPCM(bytes.NewReader(nil), 2, 12); err == nil {
+		t.Error("Expected an error for 12-bit samples")
+	}
+}
+
+func TestNormalizeBitDepth(t *testing.T) {
+	samples := [][]int32{
+		{0, 1, -1, 32767, -32768},         // 16-bit
+		{0, 256, -256, 8388607, -8388608}, // 24-bit
+	}
+
+	normalized, err := NormalizeBitDepth(samples, []uint8{16, 24}, 24)
+	if err != nil {
+		t.Fatalf("Failed to normalize bit depth: %v", err)
+	}
+	expected := [][]int32{
+		{0, 256, -256, 8388352, -8388608},
+		{0, 256, -256, 8388607, -8388608},
+	}
+	assertSamplesEqual(t, expected, normalized)
+
+	// The source must be left untouched
+	if samples[0][1] != 1 {
+		t.Error("NormalizeBitDepth modified its input")
+	}
+
+	// Narrowing shifts the other way
+	narrowed, err := NormalizeBitDepth(samples[1:], []uint8{24}, 16)
+	if err != nil {
+		t.Fatalf("Failed to normalize bit depth: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{{0, 1, -1, 32767, -32768}}, narrowed)
+
+	// Bad depths are reported rather than panicking
+	if _, err := NormalizeBitDepth(samples, []uint8{16}, 24); err == nil {
+		t.Error("Expected an error for one bit depth for two channels")
+	}
+	if _, err := NormalizeBitDepth(samples, []uint8{16, 24}, 33); err == nil {
+		t.Error("Expected an error for a 33-bit target")
+	}
+	if _, err := NormalizeBitDepth(samples, []uint8{0, 24}, 24); err == nil {
+		t.Error("Expected an error for a 0-bit source")
+	}
+
+	// The normalized channels encode together at the target depth
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, 44100, 2, 24)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(normalized); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestTrimSilence(t *testing.T) {
+	const lead, tone, trail = 5000, 10000, 7000
+	samples := [][]int32{make([]int32, lead+tone+trail), make([]int32, lead+tone+trail)}
+	seed := uint32(9)
+	for i := range samples[0] {
+		seed = seed*1664525 + 1013904223
+		// Hiss around -70 dBFS everywhere
+		hiss := int32(seed>>16)%20 - 10
+		samples[0][i] = hiss
+		samples[1][i] = -hiss
+	}
+	// A cosine starts loud, and ends loud after a whole number of periods
+	for i := 0; i < tone; i++ {
+		samples[1][lead+i] = int32(16000 * math.Cos(2*math.Pi*float64(i)/100))
+	}
+
+	trimmed := TrimSilence(samples, 16, -40)
+	if len(trimmed) != 2 {
+		t.Fatalf("Expected 2 channels, got %d", len(trimmed))
+	}
+	// The last sample of the tone is just short of a full period
+	if got := len(trimmed[0]); got < tone-10 || got > tone {
+		t.Fatalf("Expected about %d samples, got %d", tone, got)
+	}
+	if trimmed[1][0] != samples[1][lead] {
+		t.Errorf("Expected the trim to start at the tone, got %d", trimmed[1][0])
+	}
+	if trimmed[0][0] != samples[0][lead] {
+		t.Error("Channels were trimmed differently")
+	}
+
+	// The input is untouched and the result does not alias it
+	trimmed[1][0] = 0
+	if samples[1][lead] != 16000 {
+		t.Error("TrimSilence modified its input")
+	}
+
+	// With a threshold below the hiss nothing is trimmed
+	if got := TrimSilence(samples, 16, -80); len(got[0]) != len(samples[0]) {
+		t.Errorf("Expected no trimming below the noise floor, got %d samples", len(got[0]))
+	}
+
+	// All-silent input leaves empty channels
+	silent := TrimSilence([][]int32{make([]int32, 1000), make([]int32, 1000)}, 16, -60)
+	if len(silent) != 2 || len(silent[0]) != 0 || len(silent[1]) != 0 {
+		t.Errorf("Expected empty channels for silence, got %d and %d samples", len(silent[0]), len(silent[1]))
+	}
+}
@@ -0,0 +1,90 @@
+package goflac
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Predictor is a custom sample predictor for experimenting with prediction
+// schemes. Predict returns the prediction of samples[pos] from the Order()
+// samples before it; it is never called with pos < Order().
+//
+// FLAC decoders can only reproduce linear prediction with integer
+// coefficients, so the encoder only codes a block with a Predictor that
+// behaves as one on that block: it measures the coefficients from the
+// predictor's response to unit impulses, checks them against every
+// prediction of the block and otherwise falls back to the built-in
+// predictors. Predict is called through an interface once per sample and
+// cannot be inlined, so encoding is noticeably slower than with the
+// built-in predictors.
+type Predictor interface {
+	Predict(samples []int32, pos int) int64
+	Order() int
+}
+
+// WithPredictor makes the encoder code each subframe with p where it can,
+// falling back to the built-in FIXED and LPC predictors for blocks p
+// cannot code: blocks no longer than its order, or where it does not act
+// as a linear predictor with coefficients of at most 15 bits. Subframes
+// coded with p are written as LPC subframes.
+func WithPredictor(p Predictor) Option {
+	return func(e *Encoder) error {
+		if p == nil {
+			return errors.New("predictor must not be nil")
+		}
+		if order := p.Order(); order < 1 || order > maxLPCOrder {
+			return errors.New("predictor order must be between 1 and 32")
+		}
+		e.predictor = p
+		return nil
+	}
+}
+
+// customLPC expresses the encoder's custom predictor as an LPC predictor
+// for samples, returning it with the estimated subframe size. ok is false
+// if the custom predictor cannot code the block.
+func (e *Encoder) customLPC(samples []int32, bitsPerSample uint8) (p lpcPredictor, estimate uint64, ok bool) {
+	order := e.predictor.Order()
+	if len(samples) <= order {
+		return p, 0, false
+	}
+
+	// The response to a unit impulse at each lag gives its coefficient
+	p = lpcPredictor{order: order, precision: 1}
+	probe := e.predictorProbe[:0]
+	for i := 0; i <= order; i++ {
+		probe = append(probe, 0)
+	}
+	e.predictorProbe = probe
+	for j := 0; j < order; j++ {
+		probe[order-j-1] = 1
+		c := e.predictor.Predict(probe, order)
+		probe[order-j-1] = 0
+		if c < math.MinInt16 || c > math.MaxInt16 {
+			return p, 0, false
+		}
+		p.coeffs[j] = int32(c)
+		p.precision = max(p.precision, bits.Len32(uint32(c^(c>>63)))+1)
+	}
+	if p.precision > 15 {
+		return p, 0, false
+	}
+
+	// The coefficients must reproduce every prediction of the block
+	var sum uint64
+	for i := order; i < len(samples); i++ {
+		prediction := e.predictor.Predict(samples, i)
+		if prediction != lpcPredict(samples, i, &p) {
+			return p, 0, false
+		}
+		r := int64(samples[i]) - prediction
+		if r < math.MinInt32 || r > math.MaxInt32 {
+			return p, 0, false
+		}
+		sum += zigzag(r)
+	}
+	estimate = uint64(order)*uint64(bitsPerSample) + 4 + 5 + uint64(order*p.precision) +
+		estimateRiceBits(sum, uint64(len(samples)-order))
+	return p, estimate, true
+}
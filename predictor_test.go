@@ -0,0 +1,91 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+// previousSample predicts each sample as the one before it
+type previousSample struct {
+	calls int
+}
+
+func (p *previousSample) Predict(samples []int32, pos int) int64 {
+	p.calls++
+	return int64(samples[pos-1])
+}
+
+func (p *previousSample) Order() int {
+	return 1
+}
+
+// squareLaw is not a linear predictor
+type squareLaw struct{}
+
+func (squareLaw) Predict(samples []int32, pos int) int64 {
+	v := int64(samples[pos-1])
+	return v * v / 32768
+}
+
+func (squareLaw) Order() int {
+	return 1
+}
+
+func TestEncoder_WithPredictor(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 0.25, 1)
+
+	tests := []struct {
+		name      string
+		predictor Predictor
+		lpc       bool
+	}{
+		{"order-1", &previousSample{}, true},
+		{"nonlinear", squareLaw{}, false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 1, 16,
+			WithPredictor(tt.predictor), WithStatsCollector())
+		if err != nil {
+			t.Fatalf("%s: Failed to create encoder: %v", tt.name, err)
+		}
+		if err := encoder.SetMaxLPCOrder(0); err != nil {
+			t.Fatalf("%s: Failed to disable LPC: %v", tt.name, err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("%s: Failed to encode FLAC: %v", tt.name, err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatalf("%s: Failed to close: %v", tt.name, err)
+		}
+
+		// With built-in LPC disabled, LPC subframes come from the
+		// custom predictor alone; a nonlinear one falls back to FIXED
+		report, err := encoder.CompressionReport()
+		if err != nil {
+			t.Fatalf("%s: Failed to get compression report: %v", tt.name, err)
+		}
+		if lpc := report.SubframeTypes[SubframeLPC] == report.Frames; lpc != tt.lpc {
+			t.Errorf("%s: Unexpected subframe types %v", tt.name, report.SubframeTypes)
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: Failed to create decoder: %v", tt.name, err)
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("%s: Failed to decode: %v", tt.name, err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+	if p := tests[0].predictor.(*previousSample); p.calls < len(samples[0]) {
+		t.Errorf("Expected the predictor to be called for every sample, got %d calls", p.calls)
+	}
+}
+
+func TestWithPredictor_Nil(t *testing.T) {
+	if _, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16, WithPredictor(nil)); err == nil {
+		t.Error("Expected an error for a nil predictor")
+	}
+}
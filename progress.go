@@ -0,0 +1,59 @@
+package goflac
+
+import (
+	"errors"
+	"time"
+)
+
+// progressTracker reports encoding progress after every frame
+type progressTracker struct {
+	fn  func(fraction float64, eta time.Duration)
+	now func() time.Time
+
+	start time.Time
+	total int // frames expected, or 0 if unknown
+	done  int
+}
+
+// WithProgressETA calls fn after every encoded frame with the fraction of
+// frames completed and an estimate of the remaining time, extrapolated from
+// the time spent so far. When the total is unknown, as when streaming,
+// fraction is -1 and eta is negative.
+func WithProgressETA(fn func(fraction float64, eta time.Duration)) Option {
+	return func(e *Encoder) error {
+		if fn == nil {
+			return errors.New("progress callback must not be nil")
+		}
+		e.progress = &progressTracker{fn: fn, now: time.Now}
+		return nil
+	}
+}
+
+// begin starts timing an encode of total frames, 0 if unknown
+func (p *progressTracker) begin(total int) {
+	p.start = p.now()
+	p.total = total
+	p.done = 0
+}
+
+// end forgets the current total, so stray frames report unknown progress
+func (p *progressTracker) end() {
+	p.total = 0
+	p.done = 0
+}
+
+// frameDone records a finished frame and reports progress
+func (p *progressTracker) frameDone() {
+	if p.start.IsZero() {
+		p.start = p.now()
+	}
+	p.done++
+	if p.total == 0 || p.done > p.total {
+		p.fn(-1, -1)
+		return
+	}
+
+	elapsed := p.now().Sub(p.start)
+	eta := elapsed * time.Duration(p.total-p.done) / time.Duration(p.done)
+	p.fn(float64(p.done)/float64(p.total), eta)
+}
@@ -0,0 +1,83 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeClock advances by step every time it is read
+type fakeClock struct {
+	t    time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.t = c.t.Add(c.step)
+	return c.t
+}
+
+func TestEncoder_ProgressETA(t *testing.T) {
+	var fractions []float64
+	var etas []time.Duration
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16, WithProgressETA(func(fraction float64, eta time.Duration) {
+		fractions = append(fractions, fraction)
+		etas = append(etas, eta)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(0, 0), step: 10 * time.Millisecond}
+	encoder.progress.now = clock.now
+
+	// Ten full blocks
+	if err := encoder.Encode([][]int32{make([]int32, 10*4096)}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	if len(fractions) != 10 {
+		t.Fatalf("Expected 10 progress reports, got %d", len(fractions))
+	}
+	for i := 1; i < len(etas); i++ {
+		if etas[i] >= etas[i-1] {
+			t.Errorf("ETA did not decrease: %v then %v", etas[i-1], etas[i])
+		}
+		if fractions[i] <= fractions[i-1] {
+			t.Errorf("Fraction did not increase: %v then %v", fractions[i-1], fractions[i])
+		}
+	}
+	if fractions[9] != 1.0 || etas[9] != 0 {
+		t.Errorf("Expected final fraction 1.0 and ETA 0, got %v and %v", fractions[9], etas[9])
+	}
+	if etas[0] != 9*10*time.Millisecond {
+		t.Errorf("Expected initial ETA of 90ms, got %v", etas[0])
+	}
+}
+
+func TestEncoder_ProgressETAStreaming(t *testing.T) {
+	var fractions []float64
+	encoder, err := NewEncoder(io.Discard, 44100, 2, 16, WithProgressETA(func(fraction float64, eta time.Duration) {
+		fractions = append(fractions, fraction)
+		if eta >= 0 {
+			t.Errorf("Expected unknown ETA while streaming, got %v", eta)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	// Oto streams have no known length
+	pcm := make([]byte, 3*4096*4)
+	if err := encoder.EncodeOtoStream(bytes.NewReader(pcm), 44100); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if len(fractions) == 0 {
+		t.Fatal("Expected progress reports")
+	}
+	for _, f := range fractions {
+		if f != -1 {
+			t.Errorf("Expected fraction -1 while streaming, got %v", f)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package goflac
+
+import (
+	"io"
+	"time"
+)
+
+// Reset prepares the encoder to write a new stream of the given format to
+// w, reusing its scratch buffers. The options it was created with, and
+// settings such as the block size, padding and seek interval, are kept;
+// the tags, cue sheet and extra metadata blocks belong to the previous
+// stream and are cleared. Reset may be called at any point, abandoning a
+// stream that has not been closed. If the format is rejected the encoder
+// is left unchanged.
+func (e *Encoder) Reset(w io.Writer, sampleRate uint32, channels, bitsPerSample uint8) error {
+	if err := validateChannelsAndBits(channels, bitsPerSample); err != nil {
+		return err
+	}
+	if err := e.checkFormat(sampleRate, bitsPerSample); err != nil {
+		return err
+	}
+
+	e.w = w
+	e.sampleRate = sampleRate
+	e.channels = channels
+	e.bitsPerSample = bitsPerSample
+	if !e.seekTable {
+		e.seekInterval = 10 * uint64(sampleRate)
+	}
+
+	e.comments = nil
+	e.cueSheet = nil
+	e.extraBlocks = nil
+
+	e.totalSamples = 0
+	e.minFrameSize = 0
+	e.maxFrameSize = 0
+	e.md5sum = [16]byte{}
+	e.closed = false
+	e.headerWritten = false
+	e.seekable = false
+	e.streamInfoFinal = false
+
+	e.md5.Reset()
+	e.samplesEncoded = 0
+	e.minBlockSize = 0
+	e.maxBlockSize = 0
+	e.nextFrameNumber = 0
+	e.bytesWritten = 0
+	e.headerLength = 0
+	e.streamStart = 0
+	e.seekPoints = e.seekPoints[:0]
+	e.seekTableSlots = 0
+	e.seekTableOffset = 0
+	e.leadOutOffset = 0
+
+	if len(e.pending) == int(channels) {
+		for ch := range e.pending {
+			e.pending[ch] = e.pending[ch][:0]
+		}
+	} else {
+		e.pending = nil
+	}
+	e.streaming = false
+
+	if e.overview != nil {
+		e.overview.bucket = 0
+		e.overview.count = 0
+	}
+	if e.usedBits != nil {
+		e.usedBits.peaks = nil
+		e.usedBits.reported = false
+	}
+	if e.progress != nil {
+		e.progress.end()
+		e.progress.start = time.Time{}
+	}
+	if e.stats != nil {
+		e.stats.report = CompressionReport{SubframeTypes: map[SubframeType]int{}}
+		e.stats.riceSum = 0
+		e.stats.riceCount = 0
+	}
+	return nil
+}
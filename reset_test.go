@@ -0,0 +1,140 @@
+package goflac
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestEncoder_Reset(t *testing.T) {
+	sine := make([][]int32, 2)
+	for ch := range sine {
+		sine[ch] = make([]int32, 20000)
+		for i := range sine[ch] {
+			sine[ch][i] = int32(math.Round(20000 * math.Sin(2*math.Pi*440*float64(i+ch*7)/44100)))
+		}
+	}
+	rng := rand.New(rand.NewPCG(28, 8))
+	noise := [][]int32{make([]int32, 15000)}
+	for i := range noise[0] {
+		noise[0][i] = rng.Int32N(1<<20) - 1<<19
+	}
+
+	// fresh encodes samples with a new encoder, for comparison
+	fresh := func(samples [][]int32, sampleRate uint32, bitsPerSample uint8, title string) []byte {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, sampleRate, uint8(len(samples)), bitsPerSample)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if title != "" {
+			if err := encoder.AddComment("TITLE", title); err != nil {
+				t.Fatalf("Failed to add comment: %v", err)
+			}
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	var first bytes.Buffer
+	encoder, err := NewEncoder(&first, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.AddComment("TITLE", "Sine"); err != nil {
+		t.Fatalf("Failed to add comment: %v", err)
+	}
+	if err := encoder.Encode(sine); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// A rejected format leaves the encoder as it was
+	if err := encoder.Reset(&bytes.Buffer{}, 0, 1, 24); err == nil {
+		t.Error("Expected error for sample rate 0")
+	}
+	if err := encoder.Reset(&bytes.Buffer{}, 48000, 9, 24); err == nil {
+		t.Error("Expected error for 9 channels")
+	}
+
+	var second bytes.Buffer
+	if err := encoder.Reset(&second, 48000, 1, 20); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if err := encoder.Encode(noise); err != nil {
+		t.Fatalf("Failed to encode after reset: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close after reset: %v", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), fresh(sine, 44100, 16, "Sine")) {
+		t.Error("First stream differs from a fresh encoder's")
+	}
+	if !bytes.Equal(second.Bytes(), fresh(noise, 48000, 20, "")) {
+		t.Error("Stream after Reset differs from a fresh encoder's")
+	}
+
+	for _, tc := range []struct {
+		data    []byte
+		samples [][]int32
+		rate    uint32
+	}{
+		{first.Bytes(), sine, 44100},
+		{second.Bytes(), noise, 48000},
+	} {
+		decoder, err := NewDecoder(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		assertSamplesEqual(t, tc.samples, decoded)
+		if err := decoder.VerifyMD5(); err != nil {
+			t.Errorf("Failed to verify MD5: %v", err)
+		}
+		if info := decoder.StreamInfo(); info.SampleRate != tc.rate || info.TotalSamples != uint64(len(tc.samples[0])) {
+			t.Errorf("Expected %d samples at %d Hz, got %d at %d Hz",
+				len(tc.samples[0]), tc.rate, info.TotalSamples, info.SampleRate)
+		}
+	}
+}
+
+func TestEncoder_ResetDropsPending(t *testing.T) {
+	encoder, err := NewEncoder(&bytes.Buffer{}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteSamples([][]int32{make([]int32, 5000)}); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+
+	// The abandoned stream's buffered samples must not leak into the next
+	var buf bytes.Buffer
+	if err := encoder.Reset(&buf, 44100, 1, 16); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	samples := [][]int32{make([]int32, 100)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i)
+	}
+	if err := encoder.WriteSamples(samples); err != nil {
+		t.Fatalf("Failed to write samples: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	decoded, _, err := DecodeReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
@@ -0,0 +1,335 @@
+package goflac
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// RicePartitionSearch selects how the encoder chooses Rice partitioning
+type RicePartitionSearch int
+
+const (
+	// RicePartitionSearchEstimate tries every partition order, estimating
+	// each partition's parameter from its mean residual, and keeps the
+	// order that codes the residual in the fewest bits. It is the fastest.
+	RicePartitionSearchEstimate RicePartitionSearch = iota
+	// RicePartitionSearchExhaustive tries every partition order and every
+	// Rice parameter, keeping whichever codes the residual in the fewest bits
+	RicePartitionSearchExhaustive
+)
+
+// maxRicePartitionOrder is the highest partition order searched unless a
+// compression level lowers it
+const maxRicePartitionOrder = 8
+
+// maxRiceParameter is the largest parameter of the 4-bit coding method
+// (15 is reserved as the escape code)
+const maxRiceParameter = 14
+
+// maxRice2Parameter is the largest parameter of the 5-bit coding method
+// (31 is reserved as the escape code), used for residuals too large for
+// the 4-bit method
+const maxRice2Parameter = 30
+
+// defaultMaxRiceQuotient is the longest unary quotient written unless
+// WithMaxRiceQuotient says otherwise
+const defaultMaxRiceQuotient = 64
+
+// maxEscapeBits is the widest raw residual an escaped partition can hold
+const maxEscapeBits = 31
+
+// WithMaxRiceQuotient bounds the unary quotient of any Rice coded residual
+// to n bits. When a residual would exceed it, typically a single outlier,
+// the encoder searches for a partitioning that isolates it and codes that
+// partition with a larger parameter or as raw escaped values, whichever is
+// smaller. Zero disables the limit. The default is 64.
+func WithMaxRiceQuotient(n int) Option {
+	return func(e *Encoder) error {
+		if n < 0 {
+			return errors.New("Rice quotient limit must not be negative")
+		}
+		e.maxRiceQuotient = uint64(n)
+		return nil
+	}
+}
+
+// WithRicePartitionSearch sets the Rice partition search strategy,
+// trading encoding speed against output size
+func WithRicePartitionSearch(mode RicePartitionSearch) Option {
+	return func(e *Encoder) error {
+		if mode != RicePartitionSearchEstimate && mode != RicePartitionSearchExhaustive {
+			return errors.New("invalid Rice partition search mode")
+		}
+		e.riceSearch = mode
+		return nil
+	}
+}
+
+// riceEscape marks a partition stored as raw values instead of Rice codes.
+// It is written as the all-ones parameter of the coding method.
+const riceEscape = 0xFF
+
+// riceParameterBits returns the width of the Rice parameters needed for
+// params: 4 bits unless a parameter exceeds the 4-bit method's range
+func riceParameterBits(params []uint8) int {
+	for _, param := range params {
+		if param != riceEscape && param > maxRiceParameter {
+			return 5
+		}
+	}
+	return 4
+}
+
+// encodeResidual encodes residuals using partitioned Rice coding
+func (e *Encoder) encodeResidual(buf *bitWriter, residuals []int64, predictorOrder int) error {
+	partitionOrder, params, _ := e.chooseRicePartitioning(residuals, predictorOrder)
+
+	// Residual coding method: 0b00 = partitioned Rice coding with 4-bit
+	// parameters, 0b01 = with 5-bit parameters
+	paramBits := riceParameterBits(params)
+	buf.writeBits(uint64(paramBits-4), 2)
+
+	// Partition order (4 bits)
+	buf.writeBits(uint64(partitionOrder), 4)
+
+	blockSize := len(residuals) + predictorOrder
+	start := 0
+	for p, param := range params {
+		end := (p + 1) * (blockSize >> partitionOrder)
+		end -= predictorOrder
+		partition := residuals[start:end]
+		start = end
+
+		if param == riceEscape {
+			// Escape code, raw bit width (5 bits), then the residuals as
+			// raw values
+			buf.writeBits(1<<paramBits-1, paramBits)
+			rawBits := bits.Len64(largestZigzag(partition))
+			buf.writeBits(uint64(rawBits), 5)
+			for _, r := range partition {
+				buf.writeBitsSigned(r, rawBits)
+			}
+			continue
+		}
+
+		// Rice parameter (4 or 5 bits)
+		buf.writeBits(uint64(param), paramBits)
+
+		if e.stats != nil {
+			e.stats.riceParameter(param)
+		}
+
+		// Encode the partition's residuals
+		for _, r := range partition {
+			encodeRice(buf, r, param)
+		}
+	}
+
+	return nil
+}
+
+// chooseRicePartitioning picks the partition order and per-partition Rice
+// parameters according to the encoder's search strategy, and returns them
+// with the bits the partitions take after the partition order. The
+// returned parameters use the encoder's scratch space.
+func (e *Encoder) chooseRicePartitioning(residuals []int64, predictorOrder int) (int, []uint8, uint64) {
+	blockSize := len(residuals) + predictorOrder
+	bestOrder := -1
+	var bestBits uint64
+	for order := 0; order <= e.maxPartitionOrder; order++ {
+		// Every partition must be the same size and the first must hold
+		// at least one residual after the warm-up samples
+		if blockSize%(1<<order) != 0 || blockSize>>order <= predictorOrder {
+			break
+		}
+
+		params := e.riceCandidate[:0]
+		totalBits := uint64(0)
+		maxParam := uint8(0)
+		start := 0
+		for p := 0; p < 1<<order; p++ {
+			end := (p+1)*(blockSize>>order) - predictorOrder
+			var param uint8
+			var bits uint64
+			if e.riceSearch == RicePartitionSearchExhaustive {
+				param, bits = e.bestRiceParameter(residuals[start:end])
+			} else {
+				param, bits = e.estimateRiceParameter(residuals[start:end])
+			}
+			params = append(params, param)
+			totalBits += bits
+			if param != riceEscape {
+				maxParam = max(maxParam, param)
+			}
+			start = end
+		}
+		e.riceCandidate = params
+
+		// Parameters above the 4-bit method's range widen every partition's
+		// parameter to 5 bits
+		paramBits := uint64(4)
+		if maxParam > maxRiceParameter {
+			paramBits = 5
+		}
+		totalBits += paramBits << order
+
+		if bestOrder < 0 || totalBits < bestBits {
+			bestOrder = order
+			bestBits = totalBits
+			e.riceParams, e.riceCandidate = e.riceCandidate, e.riceParams
+		}
+	}
+
+	return bestOrder, e.riceParams, bestBits
+}
+
+// bestRiceParameter finds the Rice parameter that codes residuals in the
+// fewest bits by trying every parameter, returning it with the bit count.
+// Parameters whose quotients would exceed the encoder's limit are skipped.
+// Storing the residuals raw behind the escape code is also considered, and
+// wins for incompressible residuals or outliers under a tight limit.
+func (e *Encoder) bestRiceParameter(residuals []int64) (uint8, uint64) {
+	largest := largestZigzag(residuals)
+
+	bestParam := uint8(maxRice2Parameter)
+	bestBits := riceBits(residuals, maxRice2Parameter)
+	found := false
+	for param := uint8(0); param <= maxRice2Parameter; param++ {
+		if e.maxRiceQuotient != 0 && largest>>param > e.maxRiceQuotient {
+			continue
+		}
+		if bits := riceBits(residuals, param); !found || bits < bestBits {
+			bestParam = param
+			bestBits = bits
+			found = true
+		}
+	}
+
+	if escape, ok := escapeBits(len(residuals), largest); ok && (!found || escape < bestBits) {
+		return riceEscape, escape
+	}
+	return bestParam, bestBits
+}
+
+// estimateRiceParameter finds the Rice parameter for residuals by searching
+// outward from the estimate given by their mean, returning it with the bit
+// count it codes them in, or the escape code if raw values are smaller. If
+// an outlier would break the quotient limit with that parameter, the exact
+// search of bestRiceParameter is used instead.
+func (e *Encoder) estimateRiceParameter(residuals []int64) (uint8, uint64) {
+	largest := largestZigzag(residuals)
+	param, bits := findOptimalRiceParameter(residuals)
+	if e.maxRiceQuotient != 0 && largest>>param > e.maxRiceQuotient {
+		return e.bestRiceParameter(residuals)
+	}
+
+	if escape, ok := escapeBits(len(residuals), largest); ok && escape < bits {
+		return riceEscape, escape
+	}
+	return param, bits
+}
+
+// escapeBits returns the size of n residuals stored raw behind the escape
+// code, after the parameter: a 5-bit width and n values wide enough for the
+// largest zigzag coded residual. ok is false if they are too wide to escape.
+func escapeBits(n int, largest uint64) (size uint64, ok bool) {
+	rawBits := bits.Len64(largest)
+	if rawBits > maxEscapeBits {
+		return 0, false
+	}
+	return 5 + uint64(n)*uint64(rawBits), true
+}
+
+// largestZigzag returns the largest zigzag coded residual
+func largestZigzag(residuals []int64) uint64 {
+	var largest uint64
+	for _, r := range residuals {
+		largest = max(largest, zigzag(r))
+	}
+	return largest
+}
+
+// riceBits returns the number of bits needed to Rice code residuals with
+// the given parameter
+func riceBits(residuals []int64, param uint8) uint64 {
+	total := uint64(len(residuals)) * uint64(param+1)
+	for _, r := range residuals {
+		total += zigzag(r) >> param
+	}
+	return total
+}
+
+// zigzag maps a signed residual to an unsigned value: 0, -1, 1, -2, ...
+// become 0, 1, 2, 3, .... The shift/xor form has no negation, so it cannot
+// overflow for the most negative value.
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// findOptimalRiceParameter returns the Rice parameter that codes residuals
+// in the fewest bits, with that bit count. The search starts from the
+// estimate of riceParameterEstimate and moves to a neighbour while that is
+// smaller. Each residual's quotient, and so the total, is convex in the
+// parameter, so the first parameter neither neighbour improves on is the
+// true minimum; it is usually the estimate or one step from it.
+func findOptimalRiceParameter(residuals []int64) (uint8, uint64) {
+	if len(residuals) == 0 {
+		return 0, 0
+	}
+
+	var sum uint64
+	for _, r := range residuals {
+		sum += zigzag(r)
+	}
+	param := riceParameterEstimate(sum, uint64(len(residuals)))
+	best := riceBits(residuals, param)
+
+	for param > 0 {
+		n := riceBits(residuals, param-1)
+		if n >= best {
+			break
+		}
+		param, best = param-1, n
+	}
+	for param < maxRice2Parameter {
+		n := riceBits(residuals, param+1)
+		if n >= best {
+			break
+		}
+		param, best = param+1, n
+	}
+	return param, best
+}
+
+// riceParameterEstimate estimates the optimal Rice parameter from the sum of
+// n zigzag coded residuals. For the roughly geometric values left by
+// prediction the optimum is close to log2(mean*ln 2) rounded to nearest,
+// and as ln 2 is close to 1/sqrt(2) that is floor(log2(mean)): one less
+// than the bit length of the mean. Only integer arithmetic is used, so the
+// choice is identical on every platform.
+func riceParameterEstimate(sum, n uint64) uint8 {
+	mean := sum / n
+	if mean == 0 {
+		return 0
+	}
+	return uint8(min(bits.Len64(mean)-1, maxRice2Parameter))
+}
+
+// encodeRice encodes a signed integer using Rice coding
+func encodeRice(buf *bitWriter, value int64, param uint8) {
+	// Convert signed to unsigned (zigzag encoding)
+	uval := zigzag(value)
+
+	// Split into quotient and remainder
+	quotient := uval >> param
+	remainder := uval & ((1 << param) - 1)
+
+	// Write quotient in unary
+	for i := uint64(0); i < quotient; i++ {
+		buf.writeBits(0, 1)
+	}
+	buf.writeBits(1, 1)
+
+	// Write remainder in binary
+	buf.writeBits(uint64(remainder), int(param))
+}
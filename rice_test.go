@@ -0,0 +1,441 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// riceTestSignals returns mono signals whose residuals suit different
+// partitionings: steady tones, noise bursts and silence followed by noise
+func riceTestSignals() map[string][][]int32 {
+	const n = 3 * 4096
+	signals := map[string][][]int32{}
+
+	sine := make([]int32, n)
+	for i := range sine {
+		sine[i] = int32(20000 * math.Sin(2*math.Pi*440*float64(i)/44100))
+	}
+	signals["sine"] = [][]int32{sine}
+
+	burst := make([]int32, n)
+	seed := uint32(1)
+	for i := range burst {
+		seed = seed*1664525 + 1013904223
+		noise := int32(seed>>16) - 32768
+		if (i/512)%3 == 0 {
+			burst[i] = noise / 2
+		} else {
+			burst[i] = noise / 256
+		}
+	}
+	signals["burst"] = [][]int32{burst}
+
+	ramp := make([]int32, n)
+	for i := range ramp {
+		ramp[i] = int32(i%4000) * 8
+	}
+	signals["ramp"] = [][]int32{ramp}
+
+	return signals
+}
+
+// rawFrameSizes encodes samples and returns the size of each frame
+func rawFrameSizes(t *testing.T, samples [][]int32, opts ...Option) ([]int, []byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, uint8(len(samples)), 16, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	var sizes []int
+	for {
+		frame, _, err := decoder.NextRawFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read raw frame: %v", err)
+		}
+		sizes = append(sizes, len(frame))
+	}
+	return sizes, buf.Bytes()
+}
+
+func TestRicePartitionSearch_ExhaustiveNeverLarger(t *testing.T) {
+	for name, samples := range riceTestSignals() {
+		estimate, _ := rawFrameSizes(t, samples)
+		exhaustive, flacData := rawFrameSizes(t, samples, WithRicePartitionSearch(RicePartitionSearchExhaustive))
+
+		if len(estimate) != len(exhaustive) {
+			t.Fatalf("%s: frame counts differ: %d vs %d", name, len(estimate), len(exhaustive))
+		}
+		for i := range estimate {
+			if exhaustive[i] > estimate[i] {
+				t.Errorf("%s: frame %d is %d bytes exhaustive, %d bytes estimated",
+					name, i, exhaustive[i], estimate[i])
+			}
+		}
+
+		decoder, err := NewDecoder(bytes.NewReader(flacData))
+		if err != nil {
+			t.Fatalf("%s: failed to create decoder: %v", name, err)
+		}
+		decoded, err := decoder.DecodeAll()
+		if err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		assertSamplesEqual(t, samples, decoded)
+	}
+}
+
+func TestRicePartitionSearch_InvalidMode(t *testing.T) {
+	if _, err := NewEncoder(io.Discard, 44100, 1, 16, WithRicePartitionSearch(RicePartitionSearch(7))); err == nil {
+		t.Error("Expected error for unknown Rice partition search mode")
+	}
+}
+
+func benchmarkRicePartitionSearch(b *testing.B, mode RicePartitionSearch) {
+	samples := riceTestSignals()["burst"]
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16, WithRicePartitionSearch(mode))
+	if err != nil {
+		b.Fatalf("Failed to create encoder: %v", err)
+	}
+	block := [][]int32{samples[0][:4096]}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := encoder.EncodeFrame(block, 0); err != nil {
+			b.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+}
+
+func BenchmarkRicePartitionSearch_Estimate(b *testing.B) {
+	benchmarkRicePartitionSearch(b, RicePartitionSearchEstimate)
+}
+
+func BenchmarkRicePartitionSearch_Exhaustive(b *testing.B) {
+	benchmarkRicePartitionSearch(b, RicePartitionSearchExhaustive)
+}
+
+func TestEncoder_RiceQuotientLimit(t *testing.T) {
+	// Near silence with a single full scale spike
+	samples := [][]int32{make([]int32, 4096)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i % 3)
+	}
+	samples[0][2000] = 32767
+
+	// Every partition chosen for the spike's residuals keeps its quotients
+	// within a tight limit, or is escaped
+	const limit = 4
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16, WithMaxRiceQuotient(limit))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	residuals := fixedResiduals(nil, samples[0], 1)
+	order, params, _ := encoder.chooseRicePartitioning(residuals, 1)
+	start := 0
+	for p, param := range params {
+		end := (p+1)*(4096>>order) - 1
+		if largest := largestZigzag(residuals[start:end]); param != riceEscape && largest>>param > limit {
+			t.Errorf("Partition %d: quotient %d exceeds the limit", p, largest>>param)
+		}
+		start = end
+	}
+
+	unlimited, _ := rawFrameSizes(t, samples, WithMaxRiceQuotient(0))
+	limited, flacData := rawFrameSizes(t, samples)
+	if limited[0] > unlimited[0]+unlimited[0]/100 {
+		t.Errorf("Expected the quotient limit to cost little over %d bytes, got %d", unlimited[0], limited[0])
+	}
+
+	// Worst case the partition is escaped at 18 bits per residual
+	if bound := 4096*18/8 + 64; limited[0] > bound {
+		t.Errorf("Frame of %d bytes exceeds the bound of %d", limited[0], bound)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacData))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_RiceQuotientLimitEscape(t *testing.T) {
+	// Alternating extremes make every residual huge, so raw escaped values
+	// beat any Rice parameter
+	samples := [][]int32{make([]int32, 4096)}
+	for i := range samples[0] {
+		if i%2 == 0 {
+			samples[0][i] = -32768
+		} else {
+			samples[0][i] = 32767
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16, WithMaxRiceQuotient(4))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_RicePartitioningDefault(t *testing.T) {
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	// Quiet residuals with a loud burst in the middle want their own
+	// partitions
+	residuals := make([]int64, 4096-2)
+	seed := uint32(5)
+	for i := range residuals {
+		seed = seed*1664525 + 1013904223
+		noise := int64(seed>>16) - 32768
+		if i >= 1024 && i < 1536 {
+			residuals[i] = noise / 4
+		} else {
+			residuals[i] = noise / 1024
+		}
+	}
+
+	order, params, _ := encoder.chooseRicePartitioning(residuals, 2)
+	if order == 0 || len(params) != 1<<order {
+		t.Fatalf("Expected multiple partitions, got order %d with %d parameters", order, len(params))
+	}
+
+	// The chosen partitioning beats a single partition
+	partitioned := uint64(0)
+	start := 0
+	for p, param := range params {
+		end := (p+1)*(4096>>order) - 2
+		partitioned += 4 + riceBits(residuals[start:end], param)
+		start = end
+	}
+	_, single := findOptimalRiceParameter(residuals)
+	single += 4
+	if partitioned >= single {
+		t.Errorf("Expected partitioning to beat %d bits, got %d", single, partitioned)
+	}
+
+	// An odd block size cannot be split
+	if order, _, _ := encoder.chooseRicePartitioning(residuals[:4095-2], 2); order != 0 {
+		t.Errorf("Expected order 0 for a 4095 sample block, got %d", order)
+	}
+}
+
+// bruteForceRiceParameter returns the lowest cost over every parameter of
+// the 5-bit coding method
+func bruteForceRiceParameter(residuals []int64) (uint8, uint64) {
+	best, bestBits := uint8(0), riceBits(residuals, 0)
+	for p := uint8(1); p <= maxRice2Parameter; p++ {
+		if n := riceBits(residuals, p); n < bestBits {
+			best, bestBits = p, n
+		}
+	}
+	return best, bestBits
+}
+
+func TestFindOptimalRiceParameter_MatchesSearch(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	distributions := map[string]func(scale float64) int64{
+		"laplacian": func(scale float64) int64 {
+			r := int64(math.Round(rng.ExpFloat64() * scale))
+			if rng.IntN(2) == 0 {
+				r = -r
+			}
+			return r
+		},
+		"gaussian": func(scale float64) int64 {
+			return int64(math.Round(rng.NormFloat64() * scale))
+		},
+		"uniform": func(scale float64) int64 {
+			return int64(math.Round((2*rng.Float64() - 1) * scale))
+		},
+		"outliers": func(scale float64) int64 {
+			if rng.IntN(64) == 0 {
+				return int64(scale * 100)
+			}
+			return int64(rng.IntN(3)) - 1
+		},
+		"constant": func(scale float64) int64 {
+			return int64(scale)
+		},
+	}
+
+	// Scales spanning every parameter
+	for name, draw := range distributions {
+		for scale := 0.5; scale < 1<<20; scale *= 1.7 {
+			residuals := make([]int64, 1024)
+			for i := range residuals {
+				residuals[i] = draw(scale)
+			}
+
+			_, bestBits := bruteForceRiceParameter(residuals)
+			param, bits := findOptimalRiceParameter(residuals)
+			if bits != bestBits || riceBits(residuals, param) != bits {
+				t.Errorf("%s, scale %.1f: parameter %d costs %d bits (reported %d), optimum %d",
+					name, scale, param, riceBits(residuals, param), bits, bestBits)
+			}
+		}
+	}
+
+	if param, bits := findOptimalRiceParameter(nil); param != 0 || bits != 0 {
+		t.Errorf("Expected parameter 0 and 0 bits for no residuals, got %d and %d", param, bits)
+	}
+}
+
+func TestRiceParameterEstimate_Integer(t *testing.T) {
+	// The integer estimate is floor(log2) of the mean zigzag value,
+	// checked at the powers of two where float rounding could go astray
+	for k := 0; k <= 20; k++ {
+		for _, mean := range []uint64{1<<k - 1, 1 << k, 1<<k + 1} {
+			expected := uint8(0)
+			if mean >= 1 {
+				expected = uint8(min(math.Floor(math.Log2(float64(mean))), maxRice2Parameter))
+			}
+			if got := riceParameterEstimate(4*mean, 4); got != expected {
+				t.Errorf("Mean %d: expected parameter %d, got %d", mean, expected, got)
+			}
+		}
+	}
+}
+
+func TestEncodeResidual_FiveBitParameters(t *testing.T) {
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 32)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetBlockSize(1024); err != nil {
+		t.Fatalf("Failed to set block size: %v", err)
+	}
+
+	// Laplacian residuals around 2^20, far beyond parameter 14
+	rng := rand.New(rand.NewPCG(28, 2))
+	residuals := make([]int64, 1024-2)
+	for i := range residuals {
+		r := int64(rng.ExpFloat64() * (1 << 20))
+		if rng.IntN(2) == 0 {
+			r = -r
+		}
+		residuals[i] = r
+	}
+
+	bw := newBitWriter()
+	if err := encoder.encodeResidual(bw, residuals, 2); err != nil {
+		t.Fatalf("Failed to encode residual: %v", err)
+	}
+	bw.alignToByte()
+
+	// Method 0b01, then the partition order and the first 5-bit parameter
+	br := newBitReader(bytes.NewReader(bw.bytes()))
+	method, _ := br.readBits(2)
+	if method != 1 {
+		t.Fatalf("Expected residual coding method 1, got %d", method)
+	}
+	br.readBits(4)
+	param, _ := br.readBits(5)
+	if param <= maxRiceParameter || param == 31 {
+		t.Errorf("Expected a Rice parameter above %d, got %d", maxRiceParameter, param)
+	}
+
+	var d Decoder
+	decoded, err := d.readResidual(newBitReader(bytes.NewReader(bw.bytes())), 1024, 2)
+	if err != nil {
+		t.Fatalf("Failed to decode residual: %v", err)
+	}
+	if len(decoded) != len(residuals) {
+		t.Fatalf("Expected %d residuals, got %d", len(residuals), len(decoded))
+	}
+	for i := range residuals {
+		if decoded[i] != residuals[i] {
+			t.Fatalf("Residual %d: expected %d, got %d", i, residuals[i], decoded[i])
+		}
+	}
+
+	// Small residuals keep the 4-bit method
+	for i := range residuals {
+		residuals[i] %= 100
+	}
+	bw.reset()
+	if err := encoder.encodeResidual(bw, residuals, 2); err != nil {
+		t.Fatalf("Failed to encode residual: %v", err)
+	}
+	if method := bw.bytes()[0] >> 6; method != 0 {
+		t.Errorf("Expected residual coding method 0 for small residuals, got %d", method)
+	}
+}
+
+func TestChooseRicePartitioning_EscapesIncompressible(t *testing.T) {
+	// Uniformly random residuals cost one bit per value more as Rice codes
+	// than raw, even with the limit on quotients disabled
+	rng := rand.New(rand.NewPCG(28, 3))
+	residuals := make([]int64, 4096-1)
+	for i := range residuals {
+		residuals[i] = rng.Int64N(1<<12) - 1<<11
+	}
+
+	for _, mode := range []RicePartitionSearch{RicePartitionSearchEstimate, RicePartitionSearchExhaustive} {
+		encoder, err := NewEncoder(io.Discard, 44100, 1, 16, WithMaxRiceQuotient(0), WithRicePartitionSearch(mode))
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		_, params, _ := encoder.chooseRicePartitioning(residuals, 1)
+		for p, param := range params {
+			if param != riceEscape {
+				t.Errorf("Search %d, partition %d: expected the escape code, got parameter %d", mode, p, param)
+			}
+		}
+
+		bw := newBitWriter()
+		if err := encoder.encodeResidual(bw, residuals, 1); err != nil {
+			t.Fatalf("Failed to encode residual: %v", err)
+		}
+		bw.alignToByte()
+		if size := len(bw.bytes()); size > len(residuals)*12/8+64 {
+			t.Errorf("Search %d: %d bytes exceeds 12 bits per residual", mode, size)
+		}
+
+		var d Decoder
+		decoded, err := d.readResidual(newBitReader(bytes.NewReader(bw.bytes())), 4096, 1)
+		if err != nil {
+			t.Fatalf("Failed to decode residual: %v", err)
+		}
+		for i := range residuals {
+			if decoded[i] != residuals[i] {
+				t.Fatalf("Search %d, residual %d: expected %d, got %d", mode, i, residuals[i], decoded[i])
+			}
+		}
+	}
+}
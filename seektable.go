@@ -0,0 +1,91 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// seekPointLength is the size of one SEEKTABLE entry
+const seekPointLength = 18
+
+// placeholderSampleNumber marks an unused SEEKTABLE entry
+const placeholderSampleNumber = 0xFFFFFFFFFFFFFFFF
+
+// SetSeekInterval makes the encoder write a SEEKTABLE block with a seek
+// point at the first frame of every interval samples, for example the
+// sample rate for one point per second. An interval of 0 leaves the
+// SEEKTABLE out. It must be called before the stream header is written.
+//
+// The table is written into the header before the frames it points at, so
+// the number of samples has to be known in advance: Encode and
+// EncodeStrided know it, but streaming with WriteSamples or EncodeFrame
+// cannot write a SEEKTABLE. With a seekable writer the table is reserved
+// and filled in when STREAMINFO is completed; otherwise the frames are
+// buffered until it is known.
+func (e *Encoder) SetSeekInterval(samples uint64) error {
+	if e.headerWritten {
+		return errors.New("stream header already written")
+	}
+	if samples > 0 {
+		e.seekInterval = samples
+	}
+	e.seekTable = samples > 0
+	return nil
+}
+
+// countSeekTableSlots returns the number of SEEKTABLE entries to write
+// with the header: the seek points already recorded if the audio has been
+// encoded, otherwise an upper bound from the total sample count, as points
+// are at least one interval apart
+func (e *Encoder) countSeekTableSlots() (int, error) {
+	if e.samplesEncoded > 0 {
+		return len(e.seekPoints), nil
+	}
+	if e.totalSamples == 0 {
+		return 0, errors.New("SEEKTABLE needs the total sample count when the header is written")
+	}
+	slots := (e.totalSamples + e.seekInterval - 1) / e.seekInterval
+	if slots*seekPointLength >= 1<<24 {
+		return 0, errors.New("seek interval too small for a SEEKTABLE block")
+	}
+	return int(slots), nil
+}
+
+// marshalSeekTable encodes points as a SEEKTABLE block body of slots
+// entries, padding with placeholder points
+func marshalSeekTable(points []SeekPoint, slots int) []byte {
+	buf := make([]byte, 0, slots*seekPointLength)
+	for i := 0; i < slots; i++ {
+		p := SeekPoint{SampleNumber: placeholderSampleNumber}
+		if i < len(points) {
+			p = points[i]
+		}
+		buf = binary.BigEndian.AppendUint64(buf, p.SampleNumber)
+		buf = binary.BigEndian.AppendUint64(buf, p.Offset)
+		buf = binary.BigEndian.AppendUint16(buf, p.FrameSamples)
+	}
+	return buf
+}
+
+// parseSeekTable parses a SEEKTABLE block body, dropping placeholder points
+func parseSeekTable(data []byte) ([]SeekPoint, error) {
+	if len(data)%seekPointLength != 0 {
+		return nil, errors.New("SEEKTABLE length is not a multiple of 18")
+	}
+	var points []SeekPoint
+	for ; len(data) > 0; data = data[seekPointLength:] {
+		p := SeekPoint{
+			SampleNumber: binary.BigEndian.Uint64(data),
+			Offset:       binary.BigEndian.Uint64(data[8:]),
+			FrameSamples: binary.BigEndian.Uint16(data[16:]),
+		}
+		if p.SampleNumber == placeholderSampleNumber {
+			continue
+		}
+		if n := len(points); n > 0 && p.SampleNumber <= points[n-1].SampleNumber {
+			return nil, errors.New("SEEKTABLE points are not in ascending order")
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
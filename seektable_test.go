@@ -0,0 +1,186 @@
+package goflac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkSeekTable decodes a stream and checks that its seek points are in
+// ascending order, one per interval, and each locates the frame holding its
+// sample number
+func checkSeekTable(t *testing.T, data []byte, samples [][]int32, interval uint64) {
+	t.Helper()
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	points := decoder.SeekPoints()
+	want := (uint64(len(samples[0])) + interval - 1) / interval
+	if uint64(len(points)) != want {
+		t.Fatalf("Expected %d seek points, got %d", want, len(points))
+	}
+
+	// Offsets of every frame from the first frame header
+	type frameStart struct {
+		sample  uint64
+		samples int
+	}
+	frames := make(map[uint64]frameStart)
+	var offset, sample uint64
+	for {
+		frame, n, err := decoder.NextRawFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		frames[offset] = frameStart{sample, n}
+		offset += uint64(len(frame))
+		sample += uint64(n)
+	}
+
+	for i, p := range points {
+		if i > 0 && p.SampleNumber <= points[i-1].SampleNumber {
+			t.Errorf("Seek point %d at sample %d does not follow %d", i, p.SampleNumber, points[i-1].SampleNumber)
+		}
+		if p.SampleNumber != uint64(i)*interval {
+			t.Errorf("Seek point %d: expected sample %d, got %d", i, uint64(i)*interval, p.SampleNumber)
+		}
+		frame, ok := frames[p.Offset]
+		if !ok {
+			t.Errorf("Seek point %d: offset %d is not a frame boundary", i, p.Offset)
+			continue
+		}
+		if frame.sample != p.SampleNumber || frame.samples != int(p.FrameSamples) {
+			t.Errorf("Seek point %d: %+v does not match frame %+v", i, p, frame)
+		}
+	}
+
+	decoder, err = NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestEncoder_SeekTable(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 3.5, 2)
+
+	// The default block size of 4096 divides the interval, so every point
+	// lands exactly on an interval boundary
+	const interval = 8 * 4096
+
+	t.Run("Unseekable", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetSeekInterval(interval); err != nil {
+			t.Fatalf("Failed to set seek interval: %v", err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+		checkSeekTable(t, buf.Bytes(), samples, interval)
+	})
+
+	t.Run("Seekable", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "seek.flac"))
+		if err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		defer f.Close()
+		encoder, err := NewEncoder(f, 44100, 2, 16)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.SetSeekInterval(interval); err != nil {
+			t.Fatalf("Failed to set seek interval: %v", err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		checkSeekTable(t, data, samples, interval)
+	})
+}
+
+func TestEncoder_SeekTableNeedsLength(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.SetSeekInterval(44100); err != nil {
+		t.Fatalf("Failed to set seek interval: %v", err)
+	}
+	if err := encoder.WriteSamples([][]int32{make([]int32, 4096)}); err == nil {
+		t.Error("Expected an error streaming with a SEEKTABLE")
+	}
+}
+
+// flakyWriter fails every write while fail is set
+type flakyWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("write failed")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestEncoder_SeekPointAfterWrite(t *testing.T) {
+	out := &flakyWriter{}
+	encoder, err := NewEncoder(out, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write stream info: %v", err)
+	}
+
+	block := [][]int32{make([]int32, 4096)}
+	out.fail = true
+	if err := encoder.EncodeFrame(block, 0); err == nil {
+		t.Fatal("Expected the failed write to be reported")
+	}
+	if len(encoder.seekPoints) != 0 {
+		t.Errorf("Expected no seek point for a frame that was not written, got %+v", encoder.seekPoints)
+	}
+
+	out.fail = false
+	if err := encoder.EncodeFrame(block, 0); err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	if len(encoder.seekPoints) != 1 || encoder.seekPoints[0] != (SeekPoint{SampleNumber: 0, Offset: 0, FrameSamples: 4096}) {
+		t.Errorf("Expected one seek point at the first frame, got %+v", encoder.seekPoints)
+	}
+}
+
+func TestParseSeekTable_Placeholders(t *testing.T) {
+	points := []SeekPoint{{0, 0, 4096}, {44100, 12345, 4096}}
+	parsed, err := parseSeekTable(marshalSeekTable(points, 4))
+	if err != nil {
+		t.Fatalf("Failed to parse SEEKTABLE: %v", err)
+	}
+	if len(parsed) != len(points) || parsed[0] != points[0] || parsed[1] != points[1] {
+		t.Errorf("Expected %+v, got %+v", points, parsed)
+	}
+}
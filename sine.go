@@ -1,101 +1,149 @@
 package goflac
 
 import (
-	"encoding/binary"
+	"errors"
 	"io"
 	"math"
+	"math/rand/v2"
 )
 
-// GenerateSineWAV generates a WAV file with a sine wave
+// GenerateSineWAV generates a WAV file with a full scale sine wave,
+// identical on every channel
 func GenerateSineWAV(w io.Writer, frequency float64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
-	// Calculate parameters
-	numSamples := uint32(duration * float64(sampleRate))
-	byteRate := sampleRate * uint32(channels) * uint32(bitsPerSample/8)
-	blockAlign := channels * (bitsPerSample / 8)
-	dataSize := numSamples * uint32(channels) * uint32(bitsPerSample/8)
+	return GenerateSineWAVWithOptions(w, frequency, duration, sampleRate, channels, bitsPerSample, SineOptions{Amplitude: 1})
+}
 
-	// Write RIFF header
-	if _, err := w.Write([]byte("RIFF")); err != nil {
-		return err
-	}
-	fileSize := 36 + dataSize
-	if err := binary.Write(w, binary.LittleEndian, uint32(fileSize)); err != nil {
-		return err
-	}
-	if _, err := w.Write([]byte("WAVE")); err != nil {
-		return err
-	}
+// SineOptions shapes the sine wave of GenerateSineWAVWithOptions
+type SineOptions struct {
+	// Amplitude is the peak level as a fraction of full scale, from 0
+	// (silence) to 1
+	Amplitude float64
 
-	// Write fmt chunk
-	if _, err := w.Write([]byte("fmt ")); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(16)); err != nil { // fmt chunk size
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(1)); err != nil { // PCM format
-		return err
+	// Phases holds the initial phase of each channel in radians; channels
+	// without an entry start at 0
+	Phases []float64
+
+	// Frequencies holds the frequency of each channel in Hz; channels
+	// without an entry use the frequency passed to the generator
+	Frequencies []float64
+}
+
+// GenerateSineWAVWithOptions generates a WAV file with a sine wave whose
+// amplitude, and phase and frequency per channel, are set by opts. Phases
+// of 0 and pi/2 on two channels, for example, give a stereo pair 90
+// degrees apart.
+func GenerateSineWAVWithOptions(w io.Writer, frequency float64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16, opts SineOptions) error {
+	amplitude := opts.Amplitude
+	if amplitude < 0 || amplitude > 1 {
+		return errors.New("amplitude must be between 0 and 1")
 	}
-	if err := binary.Write(w, binary.LittleEndian, channels); err != nil {
-		return err
+	if len(opts.Phases) > int(channels) || len(opts.Frequencies) > int(channels) {
+		return errors.New("more phases or frequencies than channels")
 	}
-	if err := binary.Write(w, binary.LittleEndian, sampleRate); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.LittleEndian, byteRate); err != nil {
-		return err
+
+	phases := make([]float64, channels)
+	copy(phases, opts.Phases)
+	frequencies := make([]float64, channels)
+	for ch := range frequencies {
+		frequencies[ch] = frequency
 	}
-	if err := binary.Write(w, binary.LittleEndian, blockAlign); err != nil {
-		return err
+	copy(frequencies, opts.Frequencies)
+
+	sine := func(t float64, values []float64) {
+		for ch := range values {
+			values[ch] = amplitude * math.Sin(2*math.Pi*frequencies[ch]*t+phases[ch])
+		}
 	}
-	if err := binary.Write(w, binary.LittleEndian, bitsPerSample); err != nil {
-		return err
+	return generateWAV(w, sine, duration, sampleRate, channels, bitsPerSample)
+}
+
+// GenerateWAV generates a WAV file from a waveform function. gen is called
+// with the time in seconds of each sample and returns its value in the range
+// [-1, 1], which is scaled to full scale; values outside the range are
+// clipped. Every channel carries the same signal.
+func GenerateWAV(w io.Writer, gen func(t float64) float64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
+	same := func(t float64, values []float64) {
+		v := gen(t)
+		for ch := range values {
+			values[ch] = v
+		}
 	}
+	return generateWAV(w, same, duration, sampleRate, channels, bitsPerSample)
+}
 
-	// Write data chunk header
-	if _, err := w.Write([]byte("data")); err != nil {
+// generateWAV is GenerateWAV with a separate signal on each channel: gen
+// fills values with every channel's value at time t
+func generateWAV(w io.Writer, gen func(t float64, values []float64), duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
+	// 24-bit samples are packed into 3 bytes, as WAVReader expects
+	layout, err := newWAVLayout(channels, sampleRate, bitsPerSample, WAVPacked)
+	if err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, dataSize); err != nil {
+	numSamples := uint32(duration * float64(sampleRate))
+	if err := layout.writeHeader(w, numSamples); err != nil {
 		return err
 	}
 
-	// Generate and write sine wave samples
+	// Generate and write samples
 	amplitude := float64(int32(1<<(bitsPerSample-1)) - 1)
+	buf := make([]byte, 0, layout.frameBytes())
+	values := make([]float64, channels)
 	for i := uint32(0); i < numSamples; i++ {
 		t := float64(i) / float64(sampleRate)
-		value := amplitude * math.Sin(2*math.Pi*frequency*t)
-
-		for ch := uint16(0); ch < channels; ch++ {
-			switch bitsPerSample {
-			case 8:
-				sample := uint8(int32(value) + 128)
-				if err := binary.Write(w, binary.LittleEndian, sample); err != nil {
-					return err
-				}
-			case 16:
-				sample := int16(value)
-				if err := binary.Write(w, binary.LittleEndian, sample); err != nil {
-					return err
-				}
-			case 24:
-				sample := int32(value)
-				bytes := []byte{
-					byte(sample),
-					byte(sample >> 8),
-					byte(sample >> 16),
-				}
-				if _, err := w.Write(bytes); err != nil {
-					return err
-				}
-			case 32:
-				sample := int32(value)
-				if err := binary.Write(w, binary.LittleEndian, sample); err != nil {
-					return err
-				}
-			}
+		gen(t, values)
+
+		buf = buf[:0]
+		for _, v := range values {
+			buf = layout.appendSample(buf, int32(amplitude*max(-1, min(1, v))))
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// GenerateWhiteNoiseWAV generates a WAV file of full scale white noise,
+// uniformly distributed and independent on each channel. The noise is a
+// pure function of seed, so the same seed gives the same file.
+func GenerateWhiteNoiseWAV(w io.Writer, seed uint64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	noise := func(t float64, values []float64) {
+		for ch := range values {
+			values[ch] = 2*rng.Float64() - 1
+		}
+	}
+	return generateWAV(w, noise, duration, sampleRate, channels, bitsPerSample)
+}
+
+// GenerateChirpWAV generates a WAV file with a full scale sine wave whose
+// frequency rises or falls linearly from startFrequency to endFrequency
+// over the duration, identical on every channel
+func GenerateChirpWAV(w io.Writer, startFrequency, endFrequency float64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
+	if duration <= 0 {
+		return errors.New("chirp duration must be positive")
+	}
+	rate := (endFrequency - startFrequency) / duration
+	chirp := func(t float64) float64 {
+		return math.Sin(2 * math.Pi * (startFrequency*t + rate*t*t/2))
+	}
+	return GenerateWAV(w, chirp, duration, sampleRate, channels, bitsPerSample)
+}
+
+// GenerateMultiToneWAV generates a WAV file with the sum of a sine wave at
+// each of frequencies, identical on every channel. Each tone has an equal
+// share of full scale, so the sum never clips.
+func GenerateMultiToneWAV(w io.Writer, frequencies []float64, duration float64, sampleRate uint32, channels uint16, bitsPerSample uint16) error {
+	if len(frequencies) == 0 {
+		return errors.New("no tone frequencies")
+	}
+	tones := func(t float64) float64 {
+		var sum float64
+		for _, f := range frequencies {
+			sum += math.Sin(2 * math.Pi * f * t)
+		}
+		return sum / float64(len(frequencies))
+	}
+	return GenerateWAV(w, tones, duration, sampleRate, channels, bitsPerSample)
+}
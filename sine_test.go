@@ -0,0 +1,242 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"slices"
+	"testing"
+)
+
+// roundTripWAV reads a generated WAV, encodes it and decodes it back,
+// returning the WAV samples
+func roundTripWAV(t *testing.T, wav []byte) [][]int32 {
+	t.Helper()
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoderFromWAV(&flacBuf, wavReader)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+	return samples
+}
+
+func TestGenerateWAV_Square(t *testing.T) {
+	square := func(t float64) float64 {
+		if math.Mod(t*100, 1) < 0.5 {
+			return 1
+		}
+		return -1
+	}
+
+	var wav bytes.Buffer
+	if err := GenerateWAV(&wav, square, 0.5, 44100, 2, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	samples := roundTripWAV(t, wav.Bytes())
+
+	if len(samples[0]) != 22050 {
+		t.Errorf("Expected 22050 samples, got %d", len(samples[0]))
+	}
+	for i, v := range samples[0] {
+		if v != 32767 && v != -32767 {
+			t.Fatalf("Sample %d of a full scale square wave is %d", i, v)
+		}
+	}
+}
+
+func TestGenerateWAV_Sweep(t *testing.T) {
+	// Linear sweep from 100 Hz to 10 kHz over one second
+	sweep := func(t float64) float64 {
+		return 0.8 * math.Sin(2*math.Pi*(100*t+0.5*9900*t*t))
+	}
+
+	var wav bytes.Buffer
+	if err := GenerateWAV(&wav, sweep, 1.0, 48000, 1, 24); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	samples := roundTripWAV(t, wav.Bytes())
+
+	peak := int32(0)
+	for _, v := range samples[0] {
+		peak = max(peak, v, -v)
+	}
+	if limit := int32(8388607 * 4 / 5); peak > limit || peak < limit-1000 {
+		t.Errorf("Expected peak near %d, got %d", limit, peak)
+	}
+}
+
+func TestGenerateWAV_UnsupportedBits(t *testing.T) {
+	var wav bytes.Buffer
+	if err := GenerateWAV(&wav, math.Sin, 0.1, 44100, 1, 12); err == nil {
+		t.Error("Expected error for 12 bits per sample")
+	}
+}
+
+func TestGenerateSineWAVWithOptions_HalfAmplitude(t *testing.T) {
+	var wav bytes.Buffer
+	if err := GenerateSineWAVWithOptions(&wav, 441, 0.5, 44100, 1, 16, SineOptions{Amplitude: 0.5}); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	samples := roundTripWAV(t, wav.Bytes())
+
+	// 441 Hz at 44100 Hz puts the crest exactly on sample 25
+	peak := int32(0)
+	for _, v := range samples[0] {
+		peak = max(peak, v, -v)
+	}
+	if expected := int32(32767 / 2); peak != expected {
+		t.Errorf("Expected peak %d, got %d", expected, peak)
+	}
+
+	// Zero amplitude is silence
+	wav.Reset()
+	if err := GenerateSineWAVWithOptions(&wav, 441, 0.5, 44100, 1, 16, SineOptions{}); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	for i, v := range roundTripWAV(t, wav.Bytes())[0] {
+		if v != 0 {
+			t.Fatalf("Expected silence at zero amplitude, got %d at sample %d", v, i)
+		}
+	}
+}
+
+func TestGenerateSineWAVWithOptions_QuadraturePair(t *testing.T) {
+	var wav bytes.Buffer
+	opts := SineOptions{Amplitude: 1, Phases: []float64{0, math.Pi / 2}}
+	if err := GenerateSineWAVWithOptions(&wav, 441, 0.5, 44100, 2, 16, opts); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	samples := roundTripWAV(t, wav.Bytes())
+
+	// The right channel is a cosine: it leads the left by a quarter of
+	// the 100-sample period
+	if samples[0][0] != 0 || samples[1][0] != 32767 {
+		t.Errorf("Expected the pair to start at 0 and full scale, got %d and %d", samples[0][0], samples[1][0])
+	}
+	for i := 0; i+25 < len(samples[0]); i++ {
+		if d := samples[1][i] - samples[0][i+25]; d < -1 || d > 1 {
+			t.Fatalf("Sample %d: right %d does not match left %d a quarter period later", i, samples[1][i], samples[0][i+25])
+		}
+	}
+}
+
+func TestGenerateSineWAVWithOptions_Frequencies(t *testing.T) {
+	var wav bytes.Buffer
+	opts := SineOptions{Amplitude: 1, Frequencies: []float64{441, 882}}
+	if err := GenerateSineWAVWithOptions(&wav, 100, 0.1, 44100, 2, 16, opts); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	samples := roundTripWAV(t, wav.Bytes())
+
+	// Zero crossings every half period: 50 samples at 441 Hz, 25 at 882 Hz
+	for ch, half := range []int{50, 25} {
+		for i := 0; i < len(samples[ch]); i += half {
+			if v := samples[ch][i]; v < -1 || v > 1 {
+				t.Errorf("Channel %d: expected a zero crossing at sample %d, got %d", ch, i, v)
+			}
+		}
+	}
+
+	for _, opts := range []SineOptions{
+		{Amplitude: 1.5},
+		{Amplitude: -0.5},
+		{Phases: []float64{0, 0, 0}},
+	} {
+		if err := GenerateSineWAVWithOptions(&wav, 440, 0.1, 44100, 2, 16, opts); err == nil {
+			t.Errorf("Expected error for options %+v", opts)
+		}
+	}
+}
+
+func TestSignalGenerators_Compression(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		generate func(w io.Writer) error
+		maxRatio float64 // largest acceptable FLAC size relative to the WAV data
+	}{
+		{"noise", func(w io.Writer) error { return GenerateWhiteNoiseWAV(w, 7, 1.0, 44100, 2, 16) }, 1.01},
+		{"chirp", func(w io.Writer) error { return GenerateChirpWAV(w, 50, 15000, 1.0, 44100, 2, 16) }, 0.35},
+		{"multitone", func(w io.Writer) error {
+			return GenerateMultiToneWAV(w, []float64{220, 330, 440, 1760}, 1.0, 44100, 2, 16)
+		}, 0.35},
+	} {
+		var wav bytes.Buffer
+		if err := tc.generate(&wav); err != nil {
+			t.Fatalf("%s: failed to generate WAV: %v", tc.name, err)
+		}
+		samples := roundTripWAV(t, wav.Bytes())
+		if len(samples[0]) != 44100 {
+			t.Errorf("%s: expected 44100 samples, got %d", tc.name, len(samples[0]))
+		}
+
+		wavReader, err := NewWAVReader(bytes.NewReader(wav.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: failed to read WAV: %v", tc.name, err)
+		}
+		var flacBuf bytes.Buffer
+		if err := EncodeWAV(&flacBuf, wavReader); err != nil {
+			t.Fatalf("%s: failed to encode WAV: %v", tc.name, err)
+		}
+		ratio := float64(flacBuf.Len()) / float64(len(samples)*len(samples[0])*2)
+		if ratio > tc.maxRatio {
+			t.Errorf("%s: expected a compression ratio of at most %.2f, got %.3f", tc.name, tc.maxRatio, ratio)
+		}
+		t.Logf("%s: compression ratio %.3f", tc.name, ratio)
+	}
+}
+
+func TestGenerateWhiteNoiseWAV_Seed(t *testing.T) {
+	var a, b, c bytes.Buffer
+	for _, tc := range []struct {
+		buf  *bytes.Buffer
+		seed uint64
+	}{{&a, 1}, {&b, 1}, {&c, 2}} {
+		if err := GenerateWhiteNoiseWAV(tc.buf, tc.seed, 0.1, 8000, 2, 8); err != nil {
+			t.Fatalf("Failed to generate WAV: %v", err)
+		}
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("Expected the same noise from the same seed")
+	}
+	if bytes.Equal(a.Bytes(), c.Bytes()) {
+		t.Error("Expected different noise from different seeds")
+	}
+
+	// The channels are independent
+	samples := roundTripWAV(t, a.Bytes())
+	if slices.Equal(samples[0], samples[1]) {
+		t.Error("Expected independent noise on each channel")
+	}
+}
+
+func TestSignalGenerators_InvalidArguments(t *testing.T) {
+	if err := GenerateMultiToneWAV(io.Discard, nil, 0.1, 44100, 1, 16); err == nil {
+		t.Error("Expected error for no tones")
+	}
+	if err := GenerateChirpWAV(io.Discard, 100, 200, 0, 44100, 1, 16); err == nil {
+		t.Error("Expected error for a zero-length chirp")
+	}
+}
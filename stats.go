@@ -0,0 +1,114 @@
+package goflac
+
+import "errors"
+
+// SubframeType identifies how a subframe's samples are coded: as a single
+// repeated value, raw, with a fixed polynomial predictor or with a linear
+// predictor
+type SubframeType int
+
+const (
+	SubframeConstant SubframeType = iota
+	SubframeVerbatim
+	SubframeFixed
+	SubframeLPC
+)
+
+// String returns the name the FLAC format uses for the subframe type
+func (t SubframeType) String() string {
+	switch t {
+	case SubframeConstant:
+		return "CONSTANT"
+	case SubframeVerbatim:
+		return "VERBATIM"
+	case SubframeFixed:
+		return "FIXED"
+	case SubframeLPC:
+		return "LPC"
+	}
+	return "unknown"
+}
+
+// CompressionReport summarizes an encode, for understanding and tuning
+// encoder settings
+type CompressionReport struct {
+	// Frames is the number of frames written, and FrameSizes their sizes
+	// in bytes
+	Frames     int
+	FrameSizes []int
+
+	// TotalBytes is the size of the whole stream, metadata included
+	TotalBytes int64
+
+	// Samples is the number of inter-channel samples encoded
+	Samples uint64
+
+	// SubframeTypes counts the subframes coded with each type
+	SubframeTypes map[SubframeType]int
+
+	// AverageRiceParameter is the mean parameter over all Rice coded
+	// partitions; escaped partitions are not counted
+	AverageRiceParameter float64
+
+	// BitsPerSample is the stream size in bits per sample of each channel
+	BitsPerSample float64
+}
+
+// statsCollector accumulates a CompressionReport while encoding
+type statsCollector struct {
+	report    CompressionReport
+	riceSum   uint64
+	riceCount uint64
+}
+
+// WithStatsCollector collects compression statistics while encoding. The
+// report is available from CompressionReport once the encoder is closed.
+func WithStatsCollector() Option {
+	return func(e *Encoder) error {
+		e.stats = &statsCollector{
+			report: CompressionReport{SubframeTypes: map[SubframeType]int{}},
+		}
+		return nil
+	}
+}
+
+// CompressionReport returns the statistics gathered by WithStatsCollector.
+// It fails if statistics were not collected or the encoder is not closed.
+func (e *Encoder) CompressionReport() (CompressionReport, error) {
+	if e.stats == nil {
+		return CompressionReport{}, errors.New("statistics are not being collected")
+	}
+	if !e.closed {
+		return CompressionReport{}, errors.New("compression report is only available after Close")
+	}
+	return e.stats.report, nil
+}
+
+// frame records a frame of size bytes holding blockSize samples
+func (s *statsCollector) frame(size, blockSize int) {
+	s.report.Frames++
+	s.report.FrameSizes = append(s.report.FrameSizes, size)
+	s.report.Samples += uint64(blockSize)
+}
+
+// subframe records the type chosen for a subframe
+func (s *statsCollector) subframe(t SubframeType) {
+	s.report.SubframeTypes[t]++
+}
+
+// riceParameter records the parameter of a Rice coded partition
+func (s *statsCollector) riceParameter(param uint8) {
+	s.riceSum += uint64(param)
+	s.riceCount++
+}
+
+// finalize computes the derived figures once the stream is complete
+func (s *statsCollector) finalize(totalBytes int64, channels uint8) {
+	s.report.TotalBytes = totalBytes
+	if s.riceCount > 0 {
+		s.report.AverageRiceParameter = float64(s.riceSum) / float64(s.riceCount)
+	}
+	if s.report.Samples > 0 {
+		s.report.BitsPerSample = float64(totalBytes*8) / float64(s.report.Samples*uint64(channels))
+	}
+}
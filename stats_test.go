@@ -0,0 +1,78 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStatsCollector(t *testing.T) {
+	samples, _ := encodeSineFLAC(t, 1.0, 2)
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 16, WithStatsCollector())
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if _, err := encoder.CompressionReport(); err == nil {
+		t.Error("Expected error for a report before Close")
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	report, err := encoder.CompressionReport()
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	if report.TotalBytes != int64(buf.Len()) {
+		t.Errorf("Expected %d total bytes, got %d", buf.Len(), report.TotalBytes)
+	}
+
+	sizes, _ := rawFrameSizes(t, samples)
+	if report.Frames != len(sizes) || len(report.FrameSizes) != len(sizes) {
+		t.Fatalf("Expected %d frames, got %d", len(sizes), report.Frames)
+	}
+	frameBytes := 0
+	for i, size := range report.FrameSizes {
+		if size != sizes[i] {
+			t.Errorf("Frame %d: expected %d bytes, got %d", i, sizes[i], size)
+		}
+		frameBytes += size
+	}
+	if int64(frameBytes) >= report.TotalBytes {
+		t.Errorf("Frames account for %d of %d bytes, leaving none for metadata", frameBytes, report.TotalBytes)
+	}
+
+	if report.Samples != uint64(len(samples[0])) {
+		t.Errorf("Expected %d samples, got %d", len(samples[0]), report.Samples)
+	}
+	subframes := 0
+	for _, n := range report.SubframeTypes {
+		subframes += n
+	}
+	if subframes != 2*report.Frames {
+		t.Errorf("Expected %d subframes, got %d", 2*report.Frames, subframes)
+	}
+	if report.AverageRiceParameter < 0 || report.AverageRiceParameter > maxRiceParameter {
+		t.Errorf("Unexpected average Rice parameter %f", report.AverageRiceParameter)
+	}
+	expectedBPS := float64(buf.Len()*8) / float64(2*len(samples[0]))
+	if report.BitsPerSample != expectedBPS {
+		t.Errorf("Expected %f bits per sample, got %f", expectedBPS, report.BitsPerSample)
+	}
+}
+
+func TestStatsCollector_NotEnabled(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	encoder.Close()
+	if _, err := encoder.CompressionReport(); err == nil {
+		t.Error("Expected error when statistics are not collected")
+	}
+}
@@ -0,0 +1,42 @@
+package goflac
+
+// WithStereoDecorrelation controls inter-channel decorrelation of stereo
+// streams. When enabled, which is the default, every two-channel frame is
+// coded as whichever of left/right, left/side, right/side and mid/side is
+// estimated to be smallest. Disabling it codes the channels independently,
+// which is faster to encode.
+func WithStereoDecorrelation(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.stereoDecorrelation = enabled
+		return nil
+	}
+}
+
+// chooseStereoAssignment estimates the coded size of the left, right, mid
+// and side signals of a stereo block and returns the channel assignment
+// whose pair is smallest. The side signal is estimated with the extra bit
+// it needs.
+func (e *Encoder) chooseStereoAssignment(samples [][]int32) uint8 {
+	bps := e.bitsPerSample
+	left := e.estimateSubframe(samples[0], bps)
+	right := e.estimateSubframe(samples[1], bps)
+
+	midSide, _ := e.decorrelate(samples, channelMidSide)
+	mid := e.estimateSubframe(midSide[0], bps)
+	side := e.estimateSubframe(midSide[1], bps+1)
+
+	assignment, bits := uint8(1), left+right
+	for _, c := range [...]struct {
+		assignment uint8
+		bits       uint64
+	}{
+		{channelLeftSide, left + side},
+		{channelRightSide, right + side},
+		{channelMidSide, mid + side},
+	} {
+		if c.bits < bits {
+			assignment, bits = c.assignment, c.bits
+		}
+	}
+	return assignment
+}
@@ -0,0 +1,65 @@
+package goflac
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestEncoder_StereoDecorrelation(t *testing.T) {
+	// Two channels sharing loud noise that no predictor can model, each
+	// with a little content of its own
+	const n = 44100
+	rng := rand.New(rand.NewPCG(1, 2))
+	samples := [][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		common := rng.Int32N(16000) - 8000
+		samples[0][i] = common + int32(200*math.Sin(2*math.Pi*440*float64(i)/44100))
+		samples[1][i] = common + rng.Int32N(16) - 8
+	}
+
+	encode := func(enabled bool) []byte {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(&buf, 44100, 2, 16, WithStereoDecorrelation(enabled))
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if err := encoder.Encode(samples); err != nil {
+			t.Fatalf("Failed to encode FLAC: %v", err)
+		}
+		return buf.Bytes()
+	}
+	independent := encode(false)
+	decorrelated := encode(true)
+	if len(decorrelated) >= len(independent) {
+		t.Errorf("Expected decorrelation to shrink the stream, got %d bytes vs %d independent",
+			len(decorrelated), len(independent))
+	}
+
+	// Every frame uses a stereo assignment, and the channels come back
+	decoder, err := NewDecoder(bytes.NewReader(decorrelated))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	var decoded [][]int32
+	for {
+		frame, err := decoder.ReadFrameCopy()
+		if err != nil {
+			break
+		}
+		if decoder.header.channelAssignment < channelLeftSide {
+			t.Errorf("Expected a stereo channel assignment, got %d", decoder.header.channelAssignment)
+		}
+		if decoded == nil {
+			decoded = make([][]int32, len(frame))
+		}
+		for ch := range frame {
+			decoded[ch] = append(decoded[ch], frame[ch]...)
+		}
+	}
+	assertSamplesEqual(t, samples, decoded)
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+}
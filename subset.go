@@ -0,0 +1,109 @@
+package goflac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Limits of the FLAC streamable subset
+const (
+	subsetMaxBitsPerSample  = 24
+	subsetMaxBlockSize      = 16384
+	subsetMaxPartitionOrder = 8
+
+	// Streams at subsetLowSampleRate or below are limited to
+	// subsetMaxBlockSizeLowRate samples per block
+	subsetLowSampleRate       = 48000
+	subsetMaxBlockSizeLowRate = 4608
+	subsetMaxLPCOrderLowRate  = 12
+)
+
+// WithSubsetCompliance restricts the encoder to the FLAC streamable subset,
+// which every decoder must be able to play without reading STREAMINFO:
+// at most 24 bits per sample with a bit depth the frame header can code,
+// blocks of at most 4608 samples up to 48 kHz and 16384 above, LPC orders
+// up to 12 at 48 kHz and below, and Rice partition orders up to 8.
+// Settings or blocks outside the subset are reported as errors.
+func WithSubsetCompliance(enabled bool) Option {
+	return func(e *Encoder) error {
+		e.subset = enabled
+		return nil
+	}
+}
+
+// checkSubsetFormat checks the stream-wide parameters against the subset
+func checkSubsetFormat(sampleRate uint32, bitsPerSample uint8) error {
+	if bitsPerSample > subsetMaxBitsPerSample {
+		return fmt.Errorf("not subset: %d bits per sample exceeds %d", bitsPerSample, subsetMaxBitsPerSample)
+	}
+	if getSampleSizeCode(bitsPerSample) == 0 {
+		return fmt.Errorf("not subset: %d bits per sample has no frame header code", bitsPerSample)
+	}
+	if sampleRate == 0 {
+		return errors.New("not subset: sample rate must be known")
+	}
+	return nil
+}
+
+// checkSubsetBlockSize checks a block size against the subset limit for
+// the sample rate
+func checkSubsetBlockSize(sampleRate uint32, blockSize int) error {
+	limit := subsetMaxBlockSize
+	if sampleRate <= subsetLowSampleRate {
+		limit = subsetMaxBlockSizeLowRate
+	}
+	if blockSize > limit {
+		return fmt.Errorf("not subset: block size %d exceeds %d at %d Hz", blockSize, limit, sampleRate)
+	}
+	return nil
+}
+
+// checkSubsetLPCOrder checks an LPC order against the subset limit for the
+// sample rate
+func checkSubsetLPCOrder(sampleRate uint32, order int) error {
+	if sampleRate <= subsetLowSampleRate && order > subsetMaxLPCOrderLowRate {
+		return fmt.Errorf("not subset: LPC order %d exceeds %d at %d Hz", order, subsetMaxLPCOrderLowRate, sampleRate)
+	}
+	return nil
+}
+
+// CheckSubset decodes a FLAC stream and reports the first way in which it
+// falls outside the streamable subset, or nil if it is subset compliant
+func CheckSubset(r io.Reader) error {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return err
+	}
+	if err := checkSubsetFormat(d.SampleRate(), d.BitsPerSample()); err != nil {
+		return err
+	}
+	if err := checkSubsetBlockSize(d.SampleRate(), int(d.info.MaxBlockSize)); err != nil {
+		return err
+	}
+
+	for frame := 0; ; frame++ {
+		if _, err := d.ReadFrame(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		h := d.header
+		if h.sampleRateCode == 0 {
+			return fmt.Errorf("not subset: frame %d takes its sample rate from STREAMINFO", frame)
+		}
+		if h.sampleSizeCode == 0 {
+			return fmt.Errorf("not subset: frame %d takes its sample size from STREAMINFO", frame)
+		}
+		if err := checkSubsetBlockSize(h.sampleRate, h.blockSize); err != nil {
+			return fmt.Errorf("frame %d: %w", frame, err)
+		}
+		if err := checkSubsetLPCOrder(h.sampleRate, d.maxLPCOrder); err != nil {
+			return fmt.Errorf("frame %d: %w", frame, err)
+		}
+		if d.maxPartitionOrder > subsetMaxPartitionOrder {
+			return fmt.Errorf("not subset: frame %d uses Rice partition order %d", frame, d.maxPartitionOrder)
+		}
+	}
+}
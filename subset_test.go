@@ -0,0 +1,84 @@
+package goflac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCheckSubset_Compliant(t *testing.T) {
+	_, flacData := encodeSineFLAC(t, 1.0, 2)
+	if err := CheckSubset(bytes.NewReader(flacData)); err != nil {
+		t.Errorf("Expected a subset stream, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, 44100, 2, 24, WithSubsetCompliance(true),
+		WithRicePartitionSearch(RicePartitionSearchExhaustive))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	samples := riceTestSignals()["burst"]
+	if err := encoder.Encode([][]int32{samples[0], samples[0]}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := CheckSubset(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("Expected a subset stream, got %v", err)
+	}
+}
+
+func TestCheckSubset_NonCompliant(t *testing.T) {
+	// 8192-sample blocks are too large for 44.1 kHz
+	var large bytes.Buffer
+	encoder, err := NewEncoder(&large, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.WriteStreamInfo(); err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	if err := encoder.EncodeFrame([][]int32{make([]int32, 8192)}, 0); err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	if err := CheckSubset(bytes.NewReader(large.Bytes())); err == nil {
+		t.Error("Expected 8192-sample blocks at 44.1 kHz to be rejected")
+	}
+
+	// 32-bit samples are outside the subset
+	var wide bytes.Buffer
+	encoder, err = NewEncoder(&wide, 44100, 1, 32)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode([][]int32{make([]int32, 100)}); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := CheckSubset(bytes.NewReader(wide.Bytes())); err == nil {
+		t.Error("Expected 32-bit samples to be rejected")
+	}
+}
+
+func TestEncoder_SubsetComplianceEnforced(t *testing.T) {
+	for _, bits := range []uint8{17, 32} {
+		if _, err := NewEncoder(io.Discard, 44100, 1, bits, WithSubsetCompliance(true)); err == nil {
+			t.Errorf("Expected %d bits per sample to be rejected", bits)
+		}
+	}
+
+	encoder, err := NewEncoder(io.Discard, 44100, 1, 16, WithSubsetCompliance(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeFrame([][]int32{make([]int32, 8192)}, 0); err == nil {
+		t.Error("Expected an 8192-sample block at 44.1 kHz to be rejected")
+	}
+
+	// Above 48 kHz the limit is 16384
+	encoder, err = NewEncoder(io.Discard, 96000, 1, 16, WithSubsetCompliance(true))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.EncodeFrame([][]int32{make([]int32, 8192)}, 0); err != nil {
+		t.Errorf("Unexpected error for an 8192-sample block at 96 kHz: %v", err)
+	}
+}
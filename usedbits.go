@@ -0,0 +1,58 @@
+package goflac
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// usedBitsTracker records the largest sample magnitude of each channel
+type usedBitsTracker struct {
+	report   func(ch int, usedBits int)
+	peaks    []uint32
+	reported bool
+}
+
+// WithUsedBitsReport calls fn once per channel when the stream finishes
+// with the number of bits the channel's samples actually needed: the
+// two's complement width of its largest magnitude sample. A 24-bit stream
+// holding 16-bit content reports 16, suggesting the depth could be
+// reduced. Silent channels report 1.
+func WithUsedBitsReport(fn func(ch int, usedBits int)) Option {
+	return func(e *Encoder) error {
+		if fn == nil {
+			return errors.New("used bits report function must not be nil")
+		}
+		e.usedBits = &usedBitsTracker{report: fn}
+		return nil
+	}
+}
+
+// update folds a block of samples ([channels][samples]) into the peaks
+func (u *usedBitsTracker) update(samples [][]int32) {
+	if u.peaks == nil {
+		u.peaks = make([]uint32, len(samples))
+	}
+	for ch, channel := range samples {
+		peak := u.peaks[ch]
+		for _, v := range channel {
+			// v^(v>>31) maps -n-1 onto n, which needs the same width
+			peak = max(peak, uint32(v^(v>>31)))
+		}
+		u.peaks[ch] = peak
+	}
+}
+
+// flush reports every channel, once
+func (u *usedBitsTracker) flush(channels uint8) {
+	if u.reported {
+		return
+	}
+	u.reported = true
+	for ch := 0; ch < int(channels); ch++ {
+		var peak uint32
+		if ch < len(u.peaks) {
+			peak = u.peaks[ch]
+		}
+		u.report(ch, bits.Len32(peak)+1)
+	}
+}
@@ -0,0 +1,45 @@
+package goflac
+
+import (
+	"io"
+	"testing"
+)
+
+func TestUsedBitsReport(t *testing.T) {
+	// 24-bit stream: channel 0 holds 16-bit content, channel 1 reaches the
+	// most negative 12-bit value, channel 2 is silent
+	samples := [][]int32{make([]int32, 10000), make([]int32, 10000), make([]int32, 10000)}
+	for i := range samples[0] {
+		samples[0][i] = int32(i%65536) - 32768
+	}
+	samples[0][9999] = 32767
+	samples[1][5000] = -2048
+
+	got := map[int]int{}
+	encoder, err := NewEncoder(io.Discard, 44100, 3, 24, WithUsedBitsReport(func(ch, usedBits int) {
+		if _, seen := got[ch]; seen {
+			t.Errorf("Channel %d reported twice", ch)
+		}
+		got[ch] = usedBits
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	expected := map[int]int{0: 16, 1: 12, 2: 1}
+	for ch, bits := range expected {
+		if got[ch] != bits {
+			t.Errorf("Channel %d: expected %d used bits, got %d", ch, bits, got[ch])
+		}
+	}
+
+	if _, err := NewEncoder(io.Discard, 44100, 1, 16, WithUsedBitsReport(nil)); err == nil {
+		t.Error("Expected error for a nil report function")
+	}
+}
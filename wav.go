@@ -1,9 +1,12 @@
 package goflac
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 )
 
 // WAVReader reads WAV file format
@@ -13,6 +16,31 @@ type WAVReader struct {
 	sampleRate    uint32
 	bitsPerSample uint16
 	dataSize      uint32
+
+	// framesRemaining counts the inter-channel samples of the data chunk
+	// not read yet
+	framesRemaining int
+
+	// sizeUnknown records a data chunk of unknown size, which runs to the
+	// end of the file
+	sizeUnknown bool
+
+	// audioFormat is the fmt chunk format tag: PCM, IEEE float,
+	// extensible, A-law or µ-law
+	audioFormat uint16
+
+	// float records IEEE float samples, which are converted to integers
+	// of floatBits bits
+	float     bool
+	floatBits uint16
+
+	// validBitsPerSample is the number of meaningful bits within each
+	// bitsPerSample-wide container, or 0 if the whole container is used
+	validBitsPerSample uint16
+
+	// channelMask is the speaker position mask of a WAVE_FORMAT_EXTENSIBLE
+	// fmt chunk
+	channelMask uint32
 }
 
 // NewWAVReader creates a new WAV reader
@@ -24,6 +52,103 @@ func NewWAVReader(r io.Reader) (*WAVReader, error) {
 	return w, nil
 }
 
+// WAV fmt chunk format tags
+const (
+	wavFormatPCM       = 1
+	wavFormatIEEEFloat = 3
+	wavFormatALaw      = 6
+	wavFormatMuLaw     = 7
+)
+
+// defaultFloatBits is the integer depth float samples are converted to
+// unless set otherwise: the precision of a float32 mantissa
+const defaultFloatBits = 24
+
+// maxFLACChannels is the largest channel count a FLAC stream can carry
+const maxFLACChannels = 8
+
+// NewEncoderFromWAV creates an encoder matching the format of a WAV file:
+// its sample rate, channel count and bits per sample. WAV files with more
+// channels than FLAC supports are rejected up front with an explanation,
+// as their samples can still be read and downmixed first.
+func NewEncoderFromWAV(w io.Writer, wav *WAVReader, opts ...Option) (*Encoder, error) {
+	if wav.Channels() > maxFLACChannels {
+		return nil, fmt.Errorf("WAV has %d channels but FLAC supports at most %d; "+
+			"downmix or select up to %d channels before encoding",
+			wav.Channels(), maxFLACChannels, maxFLACChannels)
+	}
+	if wav.Channels() == 0 {
+		return nil, errors.New("WAV has no channels")
+	}
+	return NewEncoder(w, wav.SampleRate(), uint8(wav.Channels()), uint8(wav.BitsPerSample()), opts...)
+}
+
+// EncodeWAV encodes the remaining samples of a WAV file to a FLAC stream on
+// w with the file's sample rate, channel count and bits per sample. The
+// samples are read and encoded one block at a time, so memory use does
+// not grow with the length of the file. The total sample count is taken
+// from the data chunk when the file can be checked to hold all of it, and
+// otherwise filled in only if w can seek, as is the MD5 signature. If the
+// data ends before the size its header declares, the samples read are
+// encoded, the stream is closed and an error wrapping io.ErrUnexpectedEOF
+// is returned.
+func EncodeWAV(w io.Writer, r *WAVReader, opts ...Option) error {
+	encoder, err := NewEncoderFromWAV(w, r, opts...)
+	if err != nil {
+		return err
+	}
+	declared := r.framesRemaining
+	if r.dataPresent() {
+		encoder.totalSamples = uint64(declared)
+	}
+
+	for {
+		block, err := r.ReadSamplesBlock(int(encoder.blockSize))
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if len(block) > 0 && len(block[0]) > 0 {
+			if err := encoder.WriteSamples(block); err != nil {
+				return err
+			}
+		}
+		if err == io.ErrUnexpectedEOF {
+			if err := encoder.Close(); err != nil {
+				return err
+			}
+			return fmt.Errorf("WAV data ends after %d of %d declared samples: %w",
+				encoder.samplesEncoded, declared, io.ErrUnexpectedEOF)
+		}
+	}
+	return encoder.Close()
+}
+
+// dataPresent reports whether the rest of the data chunk is known to be
+// there: its size is declared and the reader can seek to check that the
+// file is long enough to hold it
+func (w *WAVReader) dataPresent() bool {
+	s, ok := w.r.(io.Seeker)
+	if !ok || w.sizeUnknown {
+		return false
+	}
+	current, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false
+	}
+	if _, err := s.Seek(current, io.SeekStart); err != nil {
+		return false
+	}
+	frameBytes := int64(w.bitsPerSample/8) * int64(w.channels)
+	return end-current >= int64(w.framesRemaining)*frameBytes
+}
+
 // readHeader reads and parses the WAV header
 func (w *WAVReader) readHeader() error {
 	// Read RIFF header
@@ -45,7 +170,7 @@ func (w *WAVReader) readHeader() error {
 		chunkHeader := make([]byte, 8)
 		if _, err := io.ReadFull(w.r, chunkHeader); err != nil {
 			if err == io.EOF {
-				return errors.New("unexpected end of file")
+				return io.ErrUnexpectedEOF
 			}
 			return err
 		}
@@ -59,11 +184,22 @@ func (w *WAVReader) readHeader() error {
 			}
 		} else if chunkID == "data" {
 			w.dataSize = chunkSize
+			w.sizeUnknown = chunkSize == unknownWAVDataSize
+			if frameBytes := int(w.bitsPerSample/8) * int(w.channels); frameBytes > 0 {
+				w.framesRemaining = int(chunkSize) / frameBytes
+			}
 			return nil
 		} else {
 			// Skip unknown chunk
-			skip := make([]byte, chunkSize)
-			if _, err := io.ReadFull(w.r, skip); err != nil {
+			if _, err := io.CopyN(io.Discard, w.r, int64(chunkSize)); err != nil {
+				return err
+			}
+		}
+
+		// Chunks are word-aligned: an odd-sized chunk is followed by a
+		// pad byte
+		if chunkSize%2 == 1 {
+			if _, err := io.ReadFull(w.r, make([]byte, 1)); err != nil {
 				return err
 			}
 		}
@@ -81,48 +217,157 @@ func (w *WAVReader) readFmtChunk(size uint32) error {
 		return err
 	}
 
-	audioFormat := binary.LittleEndian.Uint16(fmtData[0:2])
-	if audioFormat != 1 {
-		return errors.New("only PCM format is supported")
-	}
-
+	w.audioFormat = binary.LittleEndian.Uint16(fmtData[0:2])
 	w.channels = binary.LittleEndian.Uint16(fmtData[2:4])
 	w.sampleRate = binary.LittleEndian.Uint32(fmtData[4:8])
 	w.bitsPerSample = binary.LittleEndian.Uint16(fmtData[14:16])
 
+	format := w.audioFormat
+	if format == wavFormatExtensible {
+		// The sub-format GUID at the end of the extension gives the real
+		// format; PCM and IEEE float share the GUID tail
+		if size < 40 || binary.LittleEndian.Uint16(fmtData[16:18]) < 22 {
+			return errors.New("WAVE_FORMAT_EXTENSIBLE fmt chunk too short")
+		}
+		format = binary.LittleEndian.Uint16(fmtData[24:26])
+		if format != wavFormatPCM && format != wavFormatIEEEFloat || !bytes.Equal(fmtData[26:40], wavSubFormatPCMTail) {
+			return errors.New("unsupported WAVE_FORMAT_EXTENSIBLE sub-format: only PCM and IEEE float are supported")
+		}
+		w.channelMask = binary.LittleEndian.Uint32(fmtData[20:24])
+	}
+
+	switch format {
+	case wavFormatPCM:
+	case wavFormatIEEEFloat:
+		if w.bitsPerSample != 32 && w.bitsPerSample != 64 {
+			return errors.New("IEEE float samples must be 32 or 64 bits")
+		}
+		w.float = true
+		w.floatBits = defaultFloatBits
+		return nil
+	case wavFormatALaw, wavFormatMuLaw:
+		if w.bitsPerSample != 8 {
+			return errors.New("A-law and µ-law samples must be 8 bits")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported WAV format %d: only PCM, IEEE float, A-law and µ-law are supported", w.audioFormat)
+	}
+
+	// An extension of at least 2 bytes starts with validBitsPerSample,
+	// for example 24 valid bits stored in 32-bit containers
+	if size >= 20 && binary.LittleEndian.Uint16(fmtData[16:18]) >= 2 {
+		valid := binary.LittleEndian.Uint16(fmtData[18:20])
+		if valid > w.bitsPerSample {
+			return errors.New("valid bits per sample exceeds container size")
+		}
+		if valid != 0 && valid < w.bitsPerSample {
+			w.validBitsPerSample = valid
+		}
+	}
+
 	return nil
 }
 
-// ReadSamples reads all PCM samples from the WAV file
+// ReadSamples reads all remaining PCM samples from the WAV file. If the
+// data chunk holds fewer samples than its header declares, the samples
+// read are returned with io.ErrUnexpectedEOF. A data chunk of unknown size
+// is read to the end of the file.
 func (w *WAVReader) ReadSamples() ([][]int32, error) {
+	if !w.sizeUnknown {
+		return w.readFrames(w.framesRemaining)
+	}
+
+	// The declared size is no bound, so grow the result as samples arrive
+	samples := make([][]int32, w.channels)
+	for {
+		block, err := w.ReadSamplesBlock(1 << 16)
+		if err == io.EOF {
+			return samples, nil
+		}
+		for ch := range block {
+			samples[ch] = append(samples[ch], block[ch]...)
+		}
+		if err != nil {
+			return samples, err
+		}
+	}
+}
+
+// ReadSamplesBlock reads up to n inter-channel samples, returning fewer
+// only at the end of the data and io.EOF once all samples have been read.
+// If the data ends before the size its header declares, the samples read
+// are returned with io.ErrUnexpectedEOF; a data chunk of unknown size ends
+// cleanly at the end of the file. Reading a long file block by
+// block into the encoder's WriteSamples keeps memory use constant.
+func (w *WAVReader) ReadSamplesBlock(n int) ([][]int32, error) {
+	if n <= 0 {
+		return nil, errors.New("block size must be positive")
+	}
+	if w.framesRemaining == 0 {
+		return nil, io.EOF
+	}
+	return w.readFrames(min(n, w.framesRemaining))
+}
+
+// readFrames reads and parses n inter-channel samples. If the data runs
+// out first, it returns the whole samples read with io.ErrUnexpectedEOF.
+func (w *WAVReader) readFrames(n int) ([][]int32, error) {
 	bytesPerSample := int(w.bitsPerSample / 8)
-	numSamples := int(w.dataSize) / (bytesPerSample * int(w.channels))
 
 	samples := make([][]int32, w.channels)
 	for i := range samples {
-		samples[i] = make([]int32, numSamples)
+		samples[i] = make([]int32, n)
 	}
 
-	for i := 0; i < numSamples; i++ {
+	buf := make([]byte, bytesPerSample)
+	for i := 0; i < n; i++ {
 		for ch := 0; ch < int(w.channels); ch++ {
-			sample, err := w.readSample()
+			if _, err := io.ReadFull(w.r, buf); err != nil {
+				if err == io.EOF && ch == 0 && w.sizeUnknown {
+					// The end of the file is the end of the data
+					w.framesRemaining = 0
+					for c := range samples {
+						samples[c] = samples[c][:i]
+					}
+					if i == 0 {
+						return nil, io.EOF
+					}
+					return samples, nil
+				}
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					for c := range samples {
+						samples[c] = samples[c][:i]
+					}
+					return samples, io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			sample, err := w.parseSample(buf)
 			if err != nil {
 				return nil, err
 			}
 			samples[ch][i] = sample
 		}
+		w.framesRemaining--
 	}
 
 	return samples, nil
 }
 
-// readSample reads a single sample
-func (w *WAVReader) readSample() (int32, error) {
-	bytesPerSample := int(w.bitsPerSample / 8)
-	buf := make([]byte, bytesPerSample)
-
-	if _, err := io.ReadFull(w.r, buf); err != nil {
-		return 0, err
+// parseSample converts the bytes of a single sample to its value
+func (w *WAVReader) parseSample(buf []byte) (int32, error) {
+	switch w.audioFormat {
+	case wavFormatALaw:
+		return int32(alawTable[buf[0]]), nil
+	case wavFormatMuLaw:
+		return int32(mulawTable[buf[0]]), nil
+	}
+	if w.float {
+		if w.bitsPerSample == 64 {
+			return floatToPCM(math.Float64frombits(binary.LittleEndian.Uint64(buf)), w.floatBits), nil
+		}
+		return floatToPCM(float64(math.Float32frombits(binary.LittleEndian.Uint32(buf))), w.floatBits), nil
 	}
 
 	var sample int32
@@ -133,7 +378,8 @@ func (w *WAVReader) readSample() (int32, error) {
 	case 16:
 		sample = int32(int16(binary.LittleEndian.Uint16(buf)))
 	case 24:
-		// 24-bit is stored as 3 bytes, little-endian
+		// 24-bit is stored packed as 3 bytes, little-endian; 24 bits in
+		// 4-byte containers arrive as 32-bit samples with 24 valid bits
 		val := int32(buf[0]) | int32(buf[1])<<8 | int32(buf[2])<<16
 		// Sign extend
 		if val&0x800000 != 0 {
@@ -146,9 +392,43 @@ func (w *WAVReader) readSample() (int32, error) {
 		return 0, errors.New("unsupported bits per sample")
 	}
 
+	// Valid bits are left-justified in the container
+	if w.validBitsPerSample != 0 {
+		sample >>= w.bitsPerSample - w.validBitsPerSample
+	}
+
 	return sample, nil
 }
 
+// floatToPCM converts a float sample, nominally in [-1.0, 1.0], to a
+// signed integer of bitsPerSample bits. Out-of-range values are clipped
+// and NaN becomes silence.
+func floatToPCM(v float64, bitsPerSample uint16) int32 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	scale := float64(int64(1) << (bitsPerSample - 1))
+	v = math.Round(max(-1, min(1, v)) * scale)
+	return int32(min(v, scale-1))
+}
+
+// IsFloat reports whether the WAV file holds IEEE float samples, which
+// are converted to integers as they are read
+func (w *WAVReader) IsFloat() bool {
+	return w.float
+}
+
+// SetFloatBitDepth sets the integer depth IEEE float samples are converted
+// to, 24 bits by default: a sample of 1.0 becomes the largest value of
+// that depth. It has no effect on integer WAV files.
+func (w *WAVReader) SetFloatBitDepth(bitsPerSample uint16) error {
+	if bitsPerSample < 4 || bitsPerSample > 32 {
+		return errors.New("bits per sample must be between 4 and 32")
+	}
+	w.floatBits = bitsPerSample
+	return nil
+}
+
 // Channels returns the number of channels
 func (w *WAVReader) Channels() uint16 {
 	return w.channels
@@ -159,7 +439,25 @@ func (w *WAVReader) SampleRate() uint32 {
 	return w.sampleRate
 }
 
-// BitsPerSample returns the bits per sample
+// ChannelMask returns the speaker position mask of a WAVE_FORMAT_EXTENSIBLE
+// file, such as 0x3F for 5.1, or 0 if the file does not declare one
+func (w *WAVReader) ChannelMask() uint32 {
+	return w.channelMask
+}
+
+// BitsPerSample returns the effective bits per sample, which is smaller
+// than the container size when the fmt chunk declares fewer valid bits.
+// A-law and µ-law samples expand to 16 bits, and float samples are
+// converted to the depth set with SetFloatBitDepth.
 func (w *WAVReader) BitsPerSample() uint16 {
+	if w.float {
+		return w.floatBits
+	}
+	if w.audioFormat == wavFormatALaw || w.audioFormat == wavFormatMuLaw {
+		return 16
+	}
+	if w.validBitsPerSample != 0 {
+		return w.validBitsPerSample
+	}
 	return w.bitsPerSample
 }
@@ -0,0 +1,744 @@
+package goflac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// buildWAV assembles a RIFF/WAVE file from a fmt chunk body, any extra
+// chunks placed before the data chunk, and the raw sample data
+func buildWAV(fmtChunk []byte, extra []byte, data []byte) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.WriteString("fmt ")
+	binary.Write(&body, binary.LittleEndian, uint32(len(fmtChunk)))
+	body.Write(fmtChunk)
+	body.Write(extra)
+	body.WriteString("data")
+	binary.Write(&body, binary.LittleEndian, uint32(len(data)))
+	body.Write(data)
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(body.Len()))
+	wav.Write(body.Bytes())
+	return wav.Bytes()
+}
+
+// fmtChunkWithValidBits builds a 40-byte fmt chunk whose extension declares
+// validBits meaningful bits per containerBits-wide sample
+func fmtChunkWithValidBits(audioFormat, channels uint16, containerBits, validBits uint16) []byte {
+	var fmtChunk bytes.Buffer
+	blockAlign := channels * containerBits / 8
+	binary.Write(&fmtChunk, binary.LittleEndian, audioFormat)
+	binary.Write(&fmtChunk, binary.LittleEndian, channels)
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100)*uint32(blockAlign))
+	binary.Write(&fmtChunk, binary.LittleEndian, blockAlign)
+	binary.Write(&fmtChunk, binary.LittleEndian, containerBits)
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(22)) // cbSize
+	binary.Write(&fmtChunk, binary.LittleEndian, validBits)
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(0)) // channel mask
+	fmtChunk.Write(make([]byte, 16))                        // sub-format GUID
+	return fmtChunk.Bytes()
+}
+
+func TestWAVReader_Extensible(t *testing.T) {
+	// 5.1: front left, front right, center, LFE, back left, back right
+	const mask51 = 0x3F
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(wavFormatExtensible))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(6))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(48000))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(48000*6*3))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(6*3))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(24))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(22)) // cbSize
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(24))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(mask51))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(wavFormatPCM))
+	fmtChunk.Write(wavSubFormatPCMTail)
+
+	expected := make([][]int32, 6)
+	var data bytes.Buffer
+	for i := 0; i < 10; i++ {
+		for ch := range expected {
+			v := int32((ch+1)*100000 - i*1000)
+			expected[ch] = append(expected[ch], v)
+			data.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16)})
+		}
+	}
+
+	wavReader, err := NewWAVReader(bytes.NewReader(buildWAV(fmtChunk.Bytes(), nil, data.Bytes())))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wavReader.Channels() != 6 || wavReader.BitsPerSample() != 24 || wavReader.SampleRate() != 48000 {
+		t.Errorf("Expected 6 channels of 24-bit audio at 48000 Hz, got %d channels of %d bits at %d Hz",
+			wavReader.Channels(), wavReader.BitsPerSample(), wavReader.SampleRate())
+	}
+	if wavReader.ChannelMask() != mask51 {
+		t.Errorf("Expected channel mask 0x%X, got 0x%X", mask51, wavReader.ChannelMask())
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, expected, samples)
+
+	// A compressed sub-format is rejected
+	chunk := bytes.Clone(fmtChunk.Bytes())
+	chunk[24] = 0x55 // MPEG Layer 3
+	if _, err := NewWAVReader(bytes.NewReader(buildWAV(chunk, nil, data.Bytes()))); err == nil {
+		t.Error("Expected an error for a compressed sub-format")
+	}
+}
+
+// floatFmtChunk builds a plain fmt chunk for IEEE float samples
+func floatFmtChunk(channels, bitsPerSample uint16) []byte {
+	var fmtChunk bytes.Buffer
+	blockAlign := channels * bitsPerSample / 8
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(wavFormatIEEEFloat))
+	binary.Write(&fmtChunk, binary.LittleEndian, channels)
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100)*uint32(blockAlign))
+	binary.Write(&fmtChunk, binary.LittleEndian, blockAlign)
+	binary.Write(&fmtChunk, binary.LittleEndian, bitsPerSample)
+	return fmtChunk.Bytes()
+}
+
+func TestWAVReader_FloatRoundTrip(t *testing.T) {
+	// A float sine wave, as exported by a DAW
+	const n = 44100
+	var data bytes.Buffer
+	sine := make([]float64, n)
+	for i := range sine {
+		sine[i] = 0.8 * math.Sin(2*math.Pi*440*float64(i)/44100)
+		binary.Write(&data, binary.LittleEndian, float32(sine[i]))
+	}
+
+	wavReader, err := NewWAVReader(bytes.NewReader(buildWAV(floatFmtChunk(1, 32), nil, data.Bytes())))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if !wavReader.IsFloat() {
+		t.Error("Expected the WAV to be reported as float")
+	}
+	if err := wavReader.SetFloatBitDepth(16); err != nil {
+		t.Fatalf("Failed to set float bit depth: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoderFromWAV(&flacBuf, wavReader)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	decoded, info, err := DecodeReader(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if info.BitsPerSample != 16 {
+		t.Errorf("Expected a 16-bit stream, got %d bits", info.BitsPerSample)
+	}
+	for i, v := range decoded[0] {
+		want := sine[i] * 32768
+		if math.Abs(float64(v)-want) > 1 {
+			t.Fatalf("Sample %d: expected %.2f within one LSB, got %d", i, want, v)
+		}
+	}
+}
+
+func TestWAVReader_FloatClipping(t *testing.T) {
+	values := []float64{0, 1, -1, 1.5, -2, 0.5, math.NaN()}
+	expected := []int32{0, 8388607, -8388608, 8388607, -8388608, 4194304, 0}
+
+	var data bytes.Buffer
+	for _, v := range values {
+		binary.Write(&data, binary.LittleEndian, v)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(buildWAV(floatFmtChunk(1, 64), nil, data.Bytes())))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wavReader.BitsPerSample() != 24 {
+		t.Errorf("Expected float samples to default to 24 bits, got %d", wavReader.BitsPerSample())
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{expected}, samples)
+
+	if _, err := NewWAVReader(bytes.NewReader(buildWAV(floatFmtChunk(1, 16), nil, nil))); err == nil {
+		t.Error("Expected an error for 16-bit float samples")
+	}
+}
+
+func TestWAVReader_OddChunkPadding(t *testing.T) {
+	values := []int32{0, 1, -1, 32767, -32768, 1234}
+	var data bytes.Buffer
+	for _, v := range values {
+		binary.Write(&data, binary.LittleEndian, int16(v))
+	}
+
+	// A LIST chunk of 13 bytes is followed by a pad byte that must not be
+	// read as the start of the next chunk header
+	var list bytes.Buffer
+	list.WriteString("LIST")
+	binary.Write(&list, binary.LittleEndian, uint32(13))
+	list.WriteString("INFOISFT\x01\x00\x00\x00x")
+	list.WriteByte(0)
+
+	// The fmt chunk is padded the same way when its extension is odd-sized
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(44100*2))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(2))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(16))
+	fmtChunk.WriteByte(0)
+	wav := buildWAV(fmtChunk.Bytes(), list.Bytes(), data.Bytes())
+
+	// buildWAV writes the odd fmt chunk unpadded; insert its pad byte
+	fmtEnd := 12 + 8 + fmtChunk.Len()
+	wav = append(wav[:fmtEnd:fmtEnd], append([]byte{0}, wav[fmtEnd:]...)...)
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{values}, samples)
+}
+
+func TestWAVReader_ReadSamplesBlock(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 0.5, 44100, 2, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	expected, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	wavReader, err = NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	got := make([][]int32, 2)
+	blocks := 0
+	for {
+		block, err := wavReader.ReadSamplesBlock(1000)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read block: %v", err)
+		}
+		if len(block[0]) > 1000 {
+			t.Fatalf("Block %d holds %d samples, more than requested", blocks, len(block[0]))
+		}
+		for ch := range got {
+			got[ch] = append(got[ch], block[ch]...)
+		}
+		blocks++
+	}
+	if blocks != 23 {
+		t.Errorf("Expected 23 blocks for 22050 samples, got %d", blocks)
+	}
+	assertSamplesEqual(t, expected, got)
+
+	if _, err := wavReader.ReadSamplesBlock(0); err == nil {
+		t.Error("Expected an error for a zero block size")
+	}
+}
+
+func TestWAVReader_Truncated(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 1.0, 44100, 1, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	full, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	// 5000 frames short, and then a further byte into the last sample
+	for _, cut := range []int{5000 * 2, 5000*2 + 1} {
+		truncated := wavBuf.Bytes()[:wavBuf.Len()-cut]
+		expected := [][]int32{full[0][:44100-(cut+1)/2]}
+
+		wavReader, err := NewWAVReader(bytes.NewReader(truncated))
+		if err != nil {
+			t.Fatalf("Failed to read WAV: %v", err)
+		}
+		samples, err := wavReader.ReadSamples()
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected io.ErrUnexpectedEOF from ReadSamples, got %v", err)
+		}
+		assertSamplesEqual(t, expected, samples)
+
+		// Block by block, the last block is returned with the error
+		wavReader, err = NewWAVReader(bytes.NewReader(truncated))
+		if err != nil {
+			t.Fatalf("Failed to read WAV: %v", err)
+		}
+		got := [][]int32{nil}
+		for {
+			block, err := wavReader.ReadSamplesBlock(4096)
+			if block != nil {
+				got[0] = append(got[0], block[0]...)
+			}
+			if err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Expected io.ErrUnexpectedEOF at the end of the data, got %v", err)
+			}
+		}
+		assertSamplesEqual(t, expected, got)
+	}
+}
+
+func TestEncodeWAV(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 1.5, 48000, 2, 24); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	expected, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	wavReader, err = NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	var flacBuf bytes.Buffer
+	if err := EncodeWAV(&flacBuf, wavReader); err != nil {
+		t.Fatalf("Failed to encode WAV: %v", err)
+	}
+
+	decoded, info, err := DecodeReader(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if info.SampleRate != 48000 || info.Channels != 2 || info.BitsPerSample != 24 {
+		t.Errorf("Expected 2 channels of 24-bit audio at 48000 Hz, got %+v", info)
+	}
+	if info.TotalSamples != uint64(len(expected[0])) {
+		t.Errorf("Expected %d total samples, got %d", len(expected[0]), info.TotalSamples)
+	}
+	assertSamplesEqual(t, expected, decoded)
+}
+
+func TestEncodeWAV_Truncated(t *testing.T) {
+	var wavBuf bytes.Buffer
+	if err := GenerateSineWAV(&wavBuf, 440.0, 1.0, 44100, 1, 16); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	full, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	truncated := wavBuf.Bytes()[:wavBuf.Len()-5000*2]
+	unknownSize := bytes.Clone(wavBuf.Bytes())
+	binary.LittleEndian.PutUint32(unknownSize[40:44], unknownWAVDataSize)
+
+	// A data chunk of unknown size is read to the end of the file
+	wavReader, err = NewWAVReader(bytes.NewReader(unknownSize))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples of unknown size: %v", err)
+	}
+	assertSamplesEqual(t, full, samples)
+
+	for _, tc := range []struct {
+		name     string
+		wav      []byte
+		seekable bool // the WAV reader, not the FLAC writer
+		frames   int
+		total    uint64 // declared by STREAMINFO on an unseekable writer
+		wantErr  bool
+	}{
+		{"complete", wavBuf.Bytes(), true, 44100, 44100, false},
+		{"complete unseekable", wavBuf.Bytes(), false, 44100, 0, false},
+		{"truncated", truncated, true, 39100, 0, true},
+		{"truncated unseekable", truncated, false, 39100, 0, true},
+		{"unknown size", unknownSize, true, 44100, 0, false},
+	} {
+		for _, seekableOutput := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader(tc.wav)
+			if !tc.seekable {
+				r = struct{ io.Reader }{r}
+			}
+			wavReader, err := NewWAVReader(r)
+			if err != nil {
+				t.Fatalf("%s: Failed to read WAV: %v", tc.name, err)
+			}
+
+			var flacData []byte
+			var encodeErr error
+			if seekableOutput {
+				out := &memSeeker{}
+				encodeErr = EncodeWAV(out, wavReader)
+				flacData = out.data
+			} else {
+				var out bytes.Buffer
+				encodeErr = EncodeWAV(&out, wavReader)
+				flacData = out.Bytes()
+			}
+			if tc.wantErr != (encodeErr != nil) {
+				t.Errorf("%s: expected error %v, got %v", tc.name, tc.wantErr, encodeErr)
+			}
+			if encodeErr != nil && !errors.Is(encodeErr, io.ErrUnexpectedEOF) {
+				t.Errorf("%s: expected io.ErrUnexpectedEOF, got %v", tc.name, encodeErr)
+			}
+
+			// Whatever was encoded is a valid stream whose STREAMINFO
+			// agrees with its frames
+			decoded, info, err := DecodeReader(bytes.NewReader(flacData))
+			if err != nil {
+				t.Fatalf("%s: Failed to decode: %v", tc.name, err)
+			}
+			assertSamplesEqual(t, [][]int32{full[0][:tc.frames]}, decoded)
+			total := tc.total
+			if seekableOutput {
+				total = uint64(tc.frames)
+			}
+			if info.TotalSamples != total {
+				t.Errorf("%s (seekable output %v): expected STREAMINFO total %d, got %d",
+					tc.name, seekableOutput, total, info.TotalSamples)
+			}
+		}
+	}
+}
+
+func TestEncodeWAV_24BitRoundTrip(t *testing.T) {
+	const maxValue, minValue = 1<<23 - 1, -1 << 23
+
+	// Sine, noise and silence sections, with full-scale extremes on
+	// opposite channels at the start of every block, where they become
+	// warm-up samples and give the side channel its 25th bit
+	rng := rand.New(rand.NewPCG(24, 24))
+	samples := [][]int32{make([]int32, 20000), make([]int32, 20000)}
+	for i := range samples[0] {
+		switch {
+		case i < 8000:
+			v := int32(math.Round(8000000 * math.Sin(2*math.Pi*440*float64(i)/48000)))
+			samples[0][i], samples[1][i] = v, v/2
+		case i < 14000:
+			samples[0][i] = rng.Int32N(1<<24) - 1<<23
+			samples[1][i] = rng.Int32N(1<<24) - 1<<23
+		}
+		if i%4096 < 3 {
+			samples[0][i], samples[1][i] = maxValue, minValue
+			if i%2 == 1 {
+				samples[0][i], samples[1][i] = minValue, maxValue
+			}
+		}
+	}
+
+	var wavBuf bytes.Buffer
+	if err := WriteWAV(&wavBuf, samples, 48000, 24, WAVPacked); err != nil {
+		t.Fatalf("Failed to write WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(wavBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	// A seekable output, so STREAMINFO gets its MD5 signature
+	ws := &memSeeker{}
+	if err := EncodeWAV(ws, wavReader); err != nil {
+		t.Fatalf("Failed to encode WAV: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(ws.data))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded := make([][]int32, 2)
+	for {
+		frame, err := decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		if code := decoder.header.sampleSizeCode; code != 0x06 {
+			t.Errorf("Expected sample size code 0x06, got 0x%X", code)
+		}
+		for ch := range frame {
+			decoded[ch] = append(decoded[ch], frame[ch]...)
+		}
+	}
+	assertSamplesEqual(t, samples, decoded)
+	if err := decoder.VerifyMD5(); err != nil {
+		t.Errorf("Failed to verify MD5: %v", err)
+	}
+
+	// The MD5 signature covers the samples as packed little-endian 3-byte
+	// values, exactly the WAV data chunk
+	data := wavBuf.Bytes()
+	data = data[bytes.Index(data, []byte("data"))+8:]
+	if sum := md5.Sum(data); decoder.StreamInfo().MD5 != sum {
+		t.Errorf("Expected MD5 of the WAV data % X, got % X", sum, decoder.StreamInfo().MD5)
+	}
+}
+
+func TestWAVReader_ValidBitsPerSample(t *testing.T) {
+	values := []int32{0, 1, -1, 8388607, -8388608, 12345, -54321}
+
+	// 24 valid bits left-justified in 32-bit containers
+	var data bytes.Buffer
+	for _, v := range values {
+		binary.Write(&data, binary.LittleEndian, v<<8)
+	}
+	wav := buildWAV(fmtChunkWithValidBits(1, 1, 32, 24), nil, data.Bytes())
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wavReader.BitsPerSample() != 24 {
+		t.Errorf("Expected 24 effective bits per sample, got %d", wavReader.BitsPerSample())
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{values}, samples)
+
+	// 20 valid bits left-justified in 24-bit containers
+	values20 := []int32{0, 1, -1, 524287, -524288, 4321}
+	data.Reset()
+	for _, v := range values20 {
+		shifted := v << 4
+		data.Write([]byte{byte(shifted), byte(shifted >> 8), byte(shifted >> 16)})
+	}
+	wav = buildWAV(fmtChunkWithValidBits(1, 1, 24, 20), nil, data.Bytes())
+
+	wavReader, err = NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wavReader.BitsPerSample() != 20 {
+		t.Errorf("Expected 20 effective bits per sample, got %d", wavReader.BitsPerSample())
+	}
+	samples, err = wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	assertSamplesEqual(t, [][]int32{values20}, samples)
+
+	// The effective depth carries through to a valid 20-bit FLAC stream
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoder(&flacBuf, wavReader.SampleRate(), uint8(wavReader.Channels()), uint8(wavReader.BitsPerSample()))
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode FLAC: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestNewEncoderFromWAV_TooManyChannels(t *testing.T) {
+	// One inter-channel sample of 10 16-bit channels
+	data := make([]byte, 10*2)
+	wav := buildWAV(fmtChunkWithValidBits(1, 10, 16, 16), nil, data)
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wavReader.Channels() != 10 {
+		t.Fatalf("Expected 10 channels, got %d", wavReader.Channels())
+	}
+
+	var flacBuf bytes.Buffer
+	_, err = NewEncoderFromWAV(&flacBuf, wavReader)
+	if err == nil {
+		t.Fatal("Expected error for a 10-channel WAV")
+	}
+	if !strings.Contains(err.Error(), "10 channels") || !strings.Contains(err.Error(), "downmix") {
+		t.Errorf("Expected a helpful error, got %q", err)
+	}
+	if flacBuf.Len() != 0 {
+		t.Error("Nothing should be written for a rejected WAV")
+	}
+
+	// The samples remain readable so they can be downmixed
+	samples, err := wavReader.ReadSamples()
+	if err != nil || len(samples) != 10 {
+		t.Errorf("Expected 10 readable channels, got %d, %v", len(samples), err)
+	}
+}
+
+func TestNewEncoderFromWAV(t *testing.T) {
+	data := make([]byte, 8*2)
+	wav := buildWAV(fmtChunkWithValidBits(1, 8, 16, 16), nil, data)
+
+	wavReader, err := NewWAVReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	encoder, err := NewEncoderFromWAV(&bytes.Buffer{}, wavReader)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if encoder.channels != 8 || encoder.bitsPerSample != 16 || encoder.sampleRate != 44100 {
+		t.Errorf("Encoder format does not match the WAV: %d channels, %d bits, %d Hz",
+			encoder.channels, encoder.bitsPerSample, encoder.sampleRate)
+	}
+}
+
+func TestWAVReader_MuLaw(t *testing.T) {
+	// Reference G.711 µ-law expansions of codes 0x00-0x0F and 0x70-0x7F;
+	// codes 0x80-0xFF are the same magnitudes with positive sign
+	reference := map[byte]int32{
+		0x00: -32124, 0x01: -31100, 0x02: -30076, 0x03: -29052,
+		0x04: -28028, 0x05: -27004, 0x06: -25980, 0x07: -24956,
+		0x08: -23932, 0x09: -22908, 0x0A: -21884, 0x0B: -20860,
+		0x0C: -19836, 0x0D: -18812, 0x0E: -17788, 0x0F: -16764,
+		0x10: -15996, 0x20: -7932, 0x30: -3900, 0x40: -1884,
+		0x50: -876, 0x60: -372,
+		0x70: -120, 0x71: -112, 0x72: -104, 0x73: -96,
+		0x74: -88, 0x75: -80, 0x76: -72, 0x77: -64,
+		0x78: -56, 0x79: -48, 0x7A: -40, 0x7B: -32,
+		0x7C: -24, 0x7D: -16, 0x7E: -8, 0x7F: 0,
+	}
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(7)) // WAVE_FORMAT_MULAW
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(8000))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(8000))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(8))
+
+	wav, err := NewWAVReader(bytes.NewReader(buildWAV(fmtChunk.Bytes(), nil, data)))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	if wav.BitsPerSample() != 16 {
+		t.Errorf("Expected µ-law to expand to 16 bits, got %d", wav.BitsPerSample())
+	}
+	samples, err := wav.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	for code, expected := range reference {
+		if got := samples[0][code]; got != expected {
+			t.Errorf("Code 0x%02X: expected %d, got %d", code, expected, got)
+		}
+		if got := samples[0][code|0x80]; got != -expected {
+			t.Errorf("Code 0x%02X: expected %d, got %d", code|0x80, -expected, got)
+		}
+	}
+
+	var flacBuf bytes.Buffer
+	encoder, err := NewEncoderFromWAV(&flacBuf, wav)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	if err := encoder.Encode(samples); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(flacBuf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.BitsPerSample() != 16 || decoder.SampleRate() != 8000 {
+		t.Errorf("Unexpected FLAC format: %d bits at %d Hz", decoder.BitsPerSample(), decoder.SampleRate())
+	}
+	decoded, err := decoder.DecodeAll()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSamplesEqual(t, samples, decoded)
+}
+
+func TestWAVReader_ALaw(t *testing.T) {
+	// Reference G.711 A-law expansions
+	reference := map[byte]int32{
+		0x00: -5504, 0x2A: -32256, 0x55: -8, 0xD5: 8, 0xAA: 32256, 0x80: 5504,
+	}
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(6)) // WAVE_FORMAT_ALAW
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(8000))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint32(8000))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(&fmtChunk, binary.LittleEndian, uint16(8))
+
+	wav, err := NewWAVReader(bytes.NewReader(buildWAV(fmtChunk.Bytes(), nil, data)))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wav.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+	for code, expected := range reference {
+		if got := samples[0][code]; got != expected {
+			t.Errorf("Code 0x%02X: expected %d, got %d", code, expected, got)
+		}
+	}
+}
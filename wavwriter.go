@@ -0,0 +1,170 @@
+package goflac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WAVContainer selects how 24-bit samples are laid out in a WAV file
+type WAVContainer int
+
+const (
+	// WAVPacked stores each 24-bit sample in 3 little-endian bytes, the
+	// layout of a plain PCM fmt chunk
+	WAVPacked WAVContainer = iota
+
+	// WAV24In32 stores each 24-bit sample left-justified in a 4-byte
+	// container, declared as 24 valid bits of 32 in a
+	// WAVE_FORMAT_EXTENSIBLE fmt chunk
+	WAV24In32
+)
+
+// wavFormatExtensible is the fmt chunk format tag of WAVE_FORMAT_EXTENSIBLE,
+// whose real format is given by a sub-format GUID
+const wavFormatExtensible = 0xFFFE
+
+// wavSubFormatPCMTail is the part of the KSDATAFORMAT_SUBTYPE_PCM GUID that
+// follows its leading format tag
+var wavSubFormatPCMTail = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71,
+}
+
+// wavLayout describes the sample format of a WAV file being written
+type wavLayout struct {
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16
+	containerBits uint16
+}
+
+// newWAVLayout validates a sample format for writing
+func newWAVLayout(channels uint16, sampleRate uint32, bitsPerSample uint16, container WAVContainer) (wavLayout, error) {
+	l := wavLayout{channels: channels, sampleRate: sampleRate, bitsPerSample: bitsPerSample, containerBits: bitsPerSample}
+	switch bitsPerSample {
+	case 8, 16, 24, 32:
+	default:
+		return l, errors.New("unsupported bits per sample")
+	}
+	switch container {
+	case WAVPacked:
+	case WAV24In32:
+		if bitsPerSample != 24 {
+			return l, errors.New("24-in-32 containers hold 24-bit samples only")
+		}
+		l.containerBits = 32
+	default:
+		return l, fmt.Errorf("unknown WAV container %d", container)
+	}
+	if channels == 0 {
+		return l, errors.New("WAV must have at least one channel")
+	}
+	return l, nil
+}
+
+// frameBytes returns the size of one inter-channel sample
+func (l wavLayout) frameBytes() uint32 {
+	return uint32(l.channels) * uint32(l.containerBits/8)
+}
+
+// writeHeader writes the RIFF header, fmt chunk and data chunk header for
+// frames inter-channel samples
+func (l wavLayout) writeHeader(w io.Writer, frames uint32) error {
+	blockAlign := l.channels * (l.containerBits / 8)
+	fmtChunk := binary.LittleEndian.AppendUint16(nil, wavFormatPCM)
+	if l.containerBits != l.bitsPerSample {
+		fmtChunk = binary.LittleEndian.AppendUint16(nil, wavFormatExtensible)
+	}
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, l.channels)
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, l.sampleRate)
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, l.sampleRate*uint32(blockAlign))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, blockAlign)
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, l.containerBits)
+	if l.containerBits != l.bitsPerSample {
+		// Extension: size, valid bits, channel mask (unassigned) and the
+		// PCM sub-format GUID
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 22)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, l.bitsPerSample)
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, 0)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, wavFormatPCM)
+		fmtChunk = append(fmtChunk, wavSubFormatPCMTail...)
+	}
+
+	dataSize := frames * l.frameBytes()
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, 4+8+uint32(len(fmtChunk))+8+dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(fmtChunk)))
+	header = append(header, fmtChunk...)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+	_, err := w.Write(header)
+	return err
+}
+
+// appendSample appends one sample in the layout's byte format: 8-bit
+// samples unsigned, wider ones signed little-endian, left-justified in a
+// larger container
+func (l wavLayout) appendSample(dst []byte, v int32) []byte {
+	v <<= l.containerBits - l.bitsPerSample
+	switch l.containerBits {
+	case 8:
+		return append(dst, byte(v+128))
+	case 16:
+		return binary.LittleEndian.AppendUint16(dst, uint16(v))
+	case 24:
+		return append(dst, byte(v), byte(v>>8), byte(v>>16))
+	}
+	return binary.LittleEndian.AppendUint32(dst, uint32(v))
+}
+
+// WriteWAV writes samples ([channel][sample]) as a PCM WAV file. 24-bit
+// samples are packed into 3 bytes or stored in 4-byte containers according
+// to container, which is ignored for other depths except that WAV24In32
+// requires 24 bits. Samples must fit in bitsPerSample bits.
+func WriteWAV(w io.Writer, samples [][]int32, sampleRate uint32, bitsPerSample uint16, container WAVContainer) error {
+	if len(samples) > 0xFFFF {
+		return errors.New("too many channels for a WAV file")
+	}
+	layout, err := newWAVLayout(uint16(len(samples)), sampleRate, bitsPerSample, container)
+	if err != nil {
+		return err
+	}
+	frames := len(samples[0])
+	for ch := range samples {
+		if len(samples[ch]) != frames {
+			return errors.New("all channels must have the same number of samples")
+		}
+	}
+	if uint64(frames)*uint64(layout.frameBytes()) > 0xFFFFFFFF-64 {
+		return errors.New("too many samples for a WAV file")
+	}
+
+	lo, hi := int32(-1)<<(bitsPerSample-1), int32(uint32(1)<<(bitsPerSample-1)-1)
+	for ch := range samples {
+		for i, v := range samples[ch] {
+			if v < lo || v > hi {
+				return fmt.Errorf("sample %d of channel %d is out of range for %d bits: %d", i, ch, bitsPerSample, v)
+			}
+		}
+	}
+
+	if err := layout.writeHeader(w, uint32(frames)); err != nil {
+		return err
+	}
+	var buf []byte
+	for i := 0; i < frames; i++ {
+		for ch := range samples {
+			buf = layout.appendSample(buf, samples[ch][i])
+		}
+		if len(buf) >= 64*1024 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err = w.Write(buf)
+	return err
+}
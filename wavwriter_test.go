@@ -0,0 +1,114 @@
+package goflac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteWAV_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		bitsPerSample uint16
+		container     WAVContainer
+		blockAlign    int
+	}{
+		{"8-bit", 8, WAVPacked, 1},
+		{"16-bit", 16, WAVPacked, 2},
+		{"24-bit packed", 24, WAVPacked, 3},
+		{"24-bit in 32", 24, WAV24In32, 4},
+		{"32-bit", 32, WAVPacked, 4},
+	}
+	for _, tt := range tests {
+		for _, channels := range []int{1, 2} {
+			// Extremes, the values around zero and a ramp
+			hi := int32(uint32(1)<<(tt.bitsPerSample-1) - 1)
+			lo := -hi - 1
+			samples := make([][]int32, channels)
+			for ch := range samples {
+				samples[ch] = []int32{lo, hi, 0, -1, 1, lo + 1, hi - 1}
+				for i := int32(0); i < 100; i++ {
+					samples[ch] = append(samples[ch], (i*int32(ch+3)*997)%hi)
+				}
+			}
+
+			var wav bytes.Buffer
+			if err := WriteWAV(&wav, samples, 48000, tt.bitsPerSample, tt.container); err != nil {
+				t.Fatalf("%s: Failed to write WAV: %v", tt.name, err)
+			}
+
+			wavReader, err := NewWAVReader(bytes.NewReader(wav.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: Failed to read WAV: %v", tt.name, err)
+			}
+			if wavReader.BitsPerSample() != tt.bitsPerSample || wavReader.Channels() != uint16(channels) ||
+				wavReader.SampleRate() != 48000 {
+				t.Errorf("%s: Unexpected format %d bits, %d channels, %d Hz", tt.name,
+					wavReader.BitsPerSample(), wavReader.Channels(), wavReader.SampleRate())
+			}
+			if size := int(wavReader.dataSize); size != len(samples[0])*channels*tt.blockAlign {
+				t.Errorf("%s: Expected %d data bytes, got %d", tt.name, len(samples[0])*channels*tt.blockAlign, size)
+			}
+			decoded, err := wavReader.ReadSamples()
+			if err != nil {
+				t.Fatalf("%s: Failed to read samples: %v", tt.name, err)
+			}
+			assertSamplesEqual(t, samples, decoded)
+
+			// Writing the samples read back reproduces the file exactly
+			var again bytes.Buffer
+			if err := WriteWAV(&again, decoded, 48000, tt.bitsPerSample, tt.container); err != nil {
+				t.Fatalf("%s: Failed to write WAV: %v", tt.name, err)
+			}
+			if !bytes.Equal(again.Bytes(), wav.Bytes()) {
+				t.Errorf("%s: Rewritten WAV differs from the original", tt.name)
+			}
+		}
+	}
+}
+
+func TestWriteWAV_MatchesGenerateSineWAV(t *testing.T) {
+	// The generator and the writer agree on the packed 24-bit layout
+	var generated bytes.Buffer
+	if err := GenerateSineWAV(&generated, 440, 0.1, 44100, 2, 24); err != nil {
+		t.Fatalf("Failed to generate WAV: %v", err)
+	}
+	wavReader, err := NewWAVReader(bytes.NewReader(generated.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read WAV: %v", err)
+	}
+	samples, err := wavReader.ReadSamples()
+	if err != nil {
+		t.Fatalf("Failed to read samples: %v", err)
+	}
+
+	var written bytes.Buffer
+	if err := WriteWAV(&written, samples, 44100, 24, WAVPacked); err != nil {
+		t.Fatalf("Failed to write WAV: %v", err)
+	}
+	if !bytes.Equal(written.Bytes(), generated.Bytes()) {
+		t.Error("WriteWAV output differs from GenerateSineWAV")
+	}
+}
+
+func TestWriteWAV_Errors(t *testing.T) {
+	samples := [][]int32{{0, 1, 2}}
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, samples, 44100, 16, WAV24In32); err == nil {
+		t.Error("Expected an error for a 24-in-32 container with 16-bit samples")
+	}
+	if err := WriteWAV(&buf, samples, 44100, 12, WAVPacked); err == nil {
+		t.Error("Expected an error for 12-bit samples")
+	}
+	if err := WriteWAV(&buf, [][]int32{{0, 128}}, 44100, 8, WAVPacked); err == nil {
+		t.Error("Expected an error for a sample out of range")
+	}
+	if err := WriteWAV(&buf, [][]int32{{0, 1}, {0}}, 44100, 16, WAVPacked); err == nil {
+		t.Error("Expected an error for channels of different lengths")
+	}
+	if err := WriteWAV(&buf, nil, 44100, 16, WAVPacked); err == nil {
+		t.Error("Expected an error for no channels")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written, got %d bytes", buf.Len())
+	}
+}